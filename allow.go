@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// allowList is a http.Handler passing requests to the wrapped handler only if
+// they come from allowed networks, responding with 403 status otherwise.
+type allowList struct {
+	next       http.Handler
+	nets       []*net.IPNet
+	trustProxy bool // take client address from X-Forwarded-For header
+}
+
+// parseAllowList parses comma-separated list of networks in CIDR notation,
+// like "10.0.0.0/8,192.168.1.0/24"; single addresses are also accepted.
+func parseAllowList(s string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if !strings.Contains(f, "/") {
+			ip := net.ParseIP(f)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", f)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty list of networks")
+	}
+	return out, nil
+}
+
+func (a *allowList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ip := net.ParseIP(clientAddr(r, a.trustProxy)); ip != nil {
+		for _, n := range a.nets {
+			if n.Contains(ip) {
+				a.next.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// clientAddr returns address of the client. If trustProxy is set, it's the
+// last address of X-Forwarded-For header, as added by the proxy in front of
+// the server.
+func clientAddr(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if v := r.Header.Values("X-Forwarded-For"); len(v) != 0 {
+			list := strings.Split(v[len(v)-1], ",")
+			return strings.TrimSpace(list[len(list)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// applyConfig sets flags of fs not given on command line from config file
+// name. File consists of "name = value" lines, where name is a flag name, and
+// value is either a quoted string, or a bare word like true or 8080. Empty
+// lines and comments starting with "#" are ignored. This is a subset of TOML,
+// so such file can be edited with TOML-aware tools.
+//
+// Only settings available as flags are supported: TOML tables, arrays and
+// structured settings like mounts or authentication are out of scope, as
+// server has no such features. Repeated flags like -rewrite or -theme are
+// given as repeated lines instead.
+func applyConfig(fs *flag.FlagSet, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			return fmt.Errorf("%s:%d: tables are not supported, use flat name = value lines", name, n)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: want name = value line", name, n)
+		}
+		key = strings.TrimSpace(key)
+		if value, err = configValue(strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		if fs.Lookup(key) == nil || key == "config" {
+			return fmt.Errorf("%s:%d: unknown setting %q", name, n, key)
+		}
+		if explicit[key] {
+			continue
+		}
+		if err := fs.Set(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", name, n, key, err)
+		}
+	}
+	return sc.Err()
+}
+
+// configValue parses value part of config file line, removing quotes and
+// trailing comment.
+func configValue(s string) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(s, `"`):
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %s", s)
+		}
+		value, _ = strconv.Unquote(q)
+		s = s[len(q):]
+	case strings.HasPrefix(s, "'"): // literal string, no escapes
+		i := strings.IndexByte(s[1:], '\'')
+		if i < 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		value, s = s[1:i+1], s[i+2:]
+	default:
+		value, _, _ = strings.Cut(s, "#")
+		value, s = strings.TrimSpace(value), ""
+		if value == "" {
+			return "", fmt.Errorf("empty value")
+		}
+	}
+	if s = strings.TrimSpace(s); s != "" && s[0] != '#' {
+		return "", fmt.Errorf("unexpected text after value: %s", s)
+	}
+	return value, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation, see sd_listen_fds(3).
+const listenFdsStart = 3
+
+// listen returns listener to serve requests on. If fd is positive, listener
+// is created from this inherited file descriptor. Otherwise, if process is
+// started by systemd socket activation, the first passed socket is used.
+// If neither is the case, it listens on addr.
+func listen(addr string, fd int) (net.Listener, error) {
+	if fd <= 0 {
+		fd = activationFd()
+	}
+	if fd <= 0 {
+		return net.Listen("tcp", addr)
+	}
+	f := os.NewFile(uintptr(fd), "listen-fd-"+strconv.Itoa(fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close() // net.FileListener works on a duplicate
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+	}
+	return ln, nil
+}
+
+// activationFd returns the first file descriptor passed with systemd socket
+// activation protocol, or 0 if there's none. It unsets related environment
+// variables, so they're not inherited by child processes.
+func activationFd() int {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return 0
+	}
+	if n, err := strconv.Atoi(os.Getenv("LISTEN_FDS")); err != nil || n < 1 {
+		return 0
+	}
+	return listenFdsStart
+}
@@ -5,23 +5,422 @@
 // Its main use-case is reading through directory with documentation written in
 // markdown format, i.e. local copy of Github wiki.
 //
+// Files with .md extension are rendered as markdown documents; to also render
+// files with other extensions, list them in -ext flag, like
+// -ext=.md,.markdown,.mdown. Other files are served as is.
+//
 // To access automatically generated index, request "/?index" path, as
-// http://localhost:8080/?index.
+// http://localhost:8080/?index. Large index is split into pages of 200
+// documents. Filter box on index page narrows down listed documents as you
+// type; submit it to filter the whole index by document titles and names.
+// Each document is listed with its estimated reading time. Request
+// "/?index=az" to get all documents sorted by title and grouped by its first
+// letter, with a bar of links to letters on top.
+//
+// If started with -search flag, index page also has a form for substring
+// search through document texts. Documents opened from search results have
+// matches highlighted, and are scrolled to the first one.
+//
+// To create home page available at / either create index.html, README.md or
+// index.md file, or start server with -rootindex flag to render automatically
+// generated index. Requests to other directories are handled the same way:
+// index.html is served if present, otherwise README.md or index.md is
+// rendered, falling back to plain directory listing.
+//
+// For a quick preview of a single document, start server with -file flag,
+// like "mdserver -file=notes.md": the document is rendered at /, and its
+// page reloads in browser when file changes. Other files of its directory,
+// like images, are served as usual. Run "mdserver -" to preview markdown
+// read from stdin, like "pandoc -t gfm doc.rst | mdserver -"; page is
+// reloaded as more input arrives.
+//
+// To render a single document without starting server, like in scripts or
+// makefiles, run "mdserver -render=doc.md > doc.html". Page is rendered
+// exactly as served, with all flags affecting rendering applied, except
+// that links to other documents point to their .html files, as in offline
+// copy of the site (see "?download=zip" below). If document is inside -dir
+// directory (current one by default), it's rendered as a part of it, so
+// navigation, header and footer documents are found as usual. With -git
+// flag, -render takes a path inside repository.
+//
+// Requests for missing files are resolved to existing documents where
+// possible: "/Page" is redirected to "/Page.md", and file names are matched
+// case-insensitively, so links written GitHub wiki style work locally.
+// Otherwise a "not found" page is shown, suggesting documents with the
+// closest names, so renamed pages are easy to find.
+//
+// Documents can be tagged either with "tags" key of front matter (block of
+// "key: value" lines delimited by "---" lines at the very start of document),
+// or with a line starting with "Tags:", listing comma-separated tags. Request
+// "/?tags" path to list all known tags, or "/?tag=name" to get index of
+// documents carrying given tag. Front matter "title" key, if set, takes
+// precedence over the first header when picking document title.
+//
+// Rendered pages, index and other text responses are transparently
+// gzip-compressed for clients that accept it.
+//
+// Index and documents are also available as JSON: "/api/index" returns list
+// of all documents with their titles, modification times and sizes;
+// "/api/doc/path/to/file.md" returns document title, its headings, link
+// destinations and rendered html; "/api/outline/path/to/file.md" returns
+// document title and its headings nested by sections.
+//
+// If started with -wikilinks flag, "[[Page Name]]" and "[[Page Name|label]]"
+// wikilinks are rendered as links to matching documents: "Page Name.md" or
+// "page-name.md" located anywhere in the served directory. Links to missing
+// documents are rendered with "wikilink broken" class.
+//
+// Fenced code blocks may number and highlight lines with attributes after the
+// language, in the form Hugo uses:
+//
+//	```go {linenos=true, hl_lines=[3, "5-7"], linenostart=10}
+//
+// Numbers in hl_lines refer to displayed line numbers.
+//
+// If document directory or any of its parents up to the root of served
+// directory has "_Sidebar.md" (GitHub wiki convention) or "SUMMARY.md"
+// (mdBook convention) file, the closest one is rendered as navigation sidebar
+// on the page, with link to the current page highlighted.
+//
+// Similarly, the closest "_Header.md" and "_Footer.md" files are rendered
+// above and below the body of every page, as GitHub wiki does.
+//
+// If started with -pagenav flag, every page gets links to the previous and
+// the next documents, so documents meant to be read in sequence can be read
+// without returning to the index. Reading order is defined by the order of
+// links in "_Sidebar.md" or "SUMMARY.md" file at the root of served
+// directory, or by the order of automatically generated index if there is no
+// such file.
+//
+// Blockquotes starting with GitHub-style alert markers like "[!NOTE]",
+// "[!TIP]", "[!IMPORTANT]", "[!WARNING]" or "[!CAUTION]" are rendered as
+// colored callout boxes; text after the marker on the same line, if any, is
+// used as callout title:
+//
+//	> [!WARNING] Before you upgrade
+//	> Back up the database first.
+//
+// Contents of <details> elements are rendered as markdown, so long sections
+// can be collapsed under a summary line:
+//
+//	<details>
+//	<summary>Troubleshooting</summary>
+//
+//	Restart the *service* first.
+//
+//	</details>
+//
+// If started with -emoji flag, GitHub emoji shortcodes like ":tada:" are
+// rendered as Unicode emoji. Shortcodes inside code are left intact.
+//
+// If started with -glossary flag, terms defined in "_Glossary.md" file with
+// a definition list are marked in text of documents, showing their
+// definitions on hover:
+//
+//	SLA
+//	: Service level agreement
+//
+// Glossary file is looked up in the document directory, then in its parents,
+// so each directory may have its own glossary; glossary itself is a regular
+// document rendered as a page. Terms in headings, links and code are not
+// marked.
+//
+// If started with -include flag, lines consisting of either
+// `<!--#include file="name.md"-->` or `{{include:name.md}}` directive are
+// replaced with contents of named document, so common fragments can be kept
+// in one place. Names are relative to the including document, or to the
+// served directory if they start with "/"; files outside of it can't be
+// included. Included documents may include others; directives forming a
+// cycle are rendered as errors. Pages are reported as modified no earlier
+// than documents they include.
+//
+// If started with -link-preview flag, resting pointer on a link to another
+// document shows a popover with its title and the first paragraph, so it's
+// easier to decide whether the link is worth following. Previews are served
+// as JSON from "/api/preview?path=/dir/page.md".
+//
+// If started with -keys flag, pages get keyboard shortcuts: "/" focuses
+// search box, "[" and "]" go to previous and next page, and Ctrl+K (Cmd+K on
+// macOS) opens a palette finding documents by fuzzy matching their titles.
+//
+// If started with -copy flag, code blocks get "copy" button copying their
+// text to clipboard, handy for commands readers paste into terminal.
+//
+// If started with -outline flag, pages with several headings get "On this
+// page" list of links to them instead of the plain table of contents. On wide
+// screens it's kept in view on the right side of the page, highlighting the
+// section being read; it can be collapsed.
+//
+// If started with -page-info flag, pages end with a line telling when their
+// document was last modified, like "Updated 3 days ago", and its size, so
+// readers can judge whether it's stale. If documents are kept in git, the
+// line also names author and subject of the last commit changing document.
+//
+// If started with -pwa flag, pages register a service worker keeping copies
+// of visited pages and the index, so readers can keep browsing them on a flaky
+// network or without one; copies are revalidated by their modification time
+// whenever server is reachable. Web app manifest is also served, so site can
+// be installed as an application, using icon given with -favicon flag.
+//
+// If started with -dir-themes flag, documents are styled by ".mdserver"
+// directory found in their directory or the nearest parent one, so sections
+// of the site may look differently: ".mdserver/style.css" is linked after
+// the default stylesheet, and ".mdserver/page.html" replaces page template
+// (see -templates flag). Templates are reloaded when changed; templates
+// failing to parse are logged and ignored.
 //
-// To create home page available at / either create index.html file or start
-// server with -rootindex flag to render automatically generated index.
+// If started with -backlinks flag, every page gets "Referenced by" section
+// listing other documents linking to it.
+//
+// Request "/?orphans" path to list documents no other document links to, or
+// "/?orphans=images" to list images not referenced by any document.
+//
+// Request "/?all" path to get all documents in reading order on a single
+// page, with links between documents pointing to their sections on this page.
+// This is handy for searching through all documents in browser, or printing
+// them at once.
+//
+// Request "/?download=zip" path to download zip archive of the whole site for
+// offline reading: documents rendered to html pages, other files and assets.
+// Request "/?download=src" to download archive of served files as is.
+// Request "/?download=epub" to download EPUB book with all documents in
+// reading order (see above) as chapters, for reading on e-book readers.
+//
+// Server also provides "/sitemap.xml" listing all documents, and
+// "/robots.txt" pointing crawlers to it. To serve custom robots.txt, either
+// put it into the served directory, or provide its path with -robots flag.
+//
+// Atom feed of recently changed documents is available at "/feed.atom", so
+// changes can be followed with a feed reader.
 //
 // If started with -github flag, it will render any absolute links to github
 // wikis like "https://github.com/user/project/wiki/Page" to relative ones like
 // "Page.md".
 //
+// Other links can be rewritten with -rewrite flag, which takes a rule in
+// "regexp => replacement" form and may be repeated, once per rule. Replacement
+// may refer to regexp submatches as $1. For example, this renders links to
+// GitLab wiki as local ones:
+//
+//	mdserver -rewrite '^https://gitlab\.com/group/project/-/wikis/([^#]+) => $1.md'
+//
+// In config file, each rule is given on its own "rewrite = '...'" line. The
+// first matching rule is applied to link, before -github rewriting.
+//
+// If started with -external flag, links to other sites are marked with an
+// icon, so readers can tell which links leave the local wiki. With -newtab
+// flag, such links open in a new tab; links between documents are not
+// affected.
+//
+// With -check-links flag, relative links to files that don't exist are
+// rendered with "broken" class and a tooltip, so authors notice them while
+// reading. Existence of link targets is cached for a few seconds.
+//
+// Headings get ids made from their text, like "usage" for "## Usage". Use
+// -id-prefix flag to prefix them, i.e. "-id-prefix=user-content-" gives
+// "user-content-usage", as on GitHub, so they don't clash with ids of page
+// elements. Links to headings within the same document are rewritten to
+// match, and ones copied from GitHub, which already have the prefix, work
+// as is. Footnote ids get the prefix too, like "fn:user-content-1".
+//
 // To apply custom styling provide css file with -css flag. By default, this
 // file is read on server start and then embedded into code of every page,
-// making them self-sufficient. If you instead wish to link stylesheet, provide
-// absolute root-related path to css file located under the same path as your
-// markdown files (-dir flag) and enable -csslink flag. This will link
+// making them self-sufficient; pages are reported as modified no earlier than
+// this file, so browsers don't keep pages with stale styling after stylesheet
+// is updated. If you instead wish to link stylesheet,
+// provide absolute root-related path to css file located under the same path
+// as your markdown files (-dir flag) and enable -csslink flag. This will link
 // stylesheet into head section of page with href being value of -css flag.
 //
+// Pages embedding sidebar, header or footer documents are also reported as
+// modified no earlier than these documents.
+//
+// Stylesheet embedded into pages is reloaded when its file changes, without
+// restarting the server.
+//
+// Alternative stylesheets readers can pick are given with -theme flag as
+// "name=file.css" values, one theme per flag:
+//
+//	mdserver -theme dark=dark.css -theme print=print.css
+//
+// Opening any page with "?theme=dark" query parameter selects theme for this
+// reader, keeping choice in a cookie; "?theme=" brings the default one back.
+// Theme stylesheet is linked after the main one, so it only needs to
+// override rules it changes.
+//
+// Page templates can be overridden with files from directory provided with
+// -templates flag: "page.html" for documents, "index.html" for index and search
+// results, "tags.html" for list of tags, "notfound.html" for missing
+// documents, "error.html" for internal errors and documents too large to
+// render, "history.html" and "diff.html" for document history and revision
+// differences, "edit.html" for editor. These are html/template files; use
+// built-in templates from source code as a starting point, since they define
+// data available to templates. Templates can use built-in "head" template,
+// linking stylesheets and icon, and "logo" one, linking logo to the root
+// page: {{template "head" .}}. Files are reloaded when they change; if file
+// can't be parsed, error is logged and previously loaded version is used.
+//
+// Files from directory provided with -assets flag are served under /_assets/
+// path, taking precedence over built-in scripts and stylesheet served from the
+// same path. If this directory has "custom.css" or "custom.js" files, they are
+// linked from every page, so they may refer to other files (fonts, logos)
+// from the same directory.
+//
+// Icon browsers show for pages is set with -favicon flag, and image shown at
+// the left of navigation header, linking to the root page, with -logo flag.
+// These files are served as /_assets/favicon and /_assets/logo with the
+// extension of the original files, favicon is also served as /favicon.ico.
+//
+// Settings can be read from file given with -config flag instead of command
+// line. This file has a "name = value" line per flag, using flag names
+// without leading dash; string values may be quoted. Flags given on command
+// line take precedence over this file. Flags that may be repeated, like
+// -rewrite or -theme, are given once per line. TOML tables and arrays are not
+// supported. Example:
+//
+//	# mdserver.toml
+//	dir = "/srv/wiki"
+//	addr = "localhost:8080"
+//	search = true
+//	wikilinks = true
+//
+// Server responds to "/healthz" requests with JSON object holding number of
+// served documents and uptime, which can be used for health checks. When run
+// in a container, start it with -public flag: then server listens on all
+// network interfaces (":8080") unless -addr flag is set, and -open flag is
+// ignored.
+//
+// To restrict access to clients from given networks, start server with -allow
+// flag set to comma-separated list of networks in CIDR notation, like
+// "10.0.0.0/8,192.168.1.0/24". If server runs behind a reverse proxy, add
+// -trust-proxy flag to check client address the proxy puts into
+// X-Forwarded-For header instead of address of the proxy itself. Note that
+// with this flag anyone who can reach server directly can forge this header.
+//
+// With -trust-proxy flag, absolute URLs in Atom feed, sitemap, robots.txt
+// and canonical links of pages are built from X-Forwarded-Proto and
+// X-Forwarded-Host headers set by reverse proxy, like nginx or an ingress
+// controller, so they point to the public address of the site rather than
+// to the address proxy connects to. Alternatively, set this address with
+// -public-url flag, like "-public-url=https://docs.example.com".
+//
+// Pages have description meta tag taken from front matter "description" key
+// or the first paragraph of document, and Open Graph and Twitter card tags
+// with canonical URL, title and description, so links to pages posted to
+// chats unfurl into previews.
+//
+// Generated pages are served with strict Content-Security-Policy, only
+// allowing scripts and stylesheets from the server itself (and highlight.js
+// from CDN with -hljs flag). All responses have X-Content-Type-Options,
+// Referrer-Policy ("strict-origin-when-cross-origin" by default, change with
+// -referrer-policy flag) and X-Frame-Options headers. Pages can only be
+// embedded in frames by the site itself, to allow other sites list them in
+// -frame-ancestors flag, like "-frame-ancestors='self' https://example.com",
+// or use "'none'" to forbid frames altogether.
+//
+// To protect a shared server from clients making too many requests, like
+// crawlers, start it with -rate-limit flag set to the number of requests per
+// second a single client may make on average; clients may make bursts of
+// requests up to 10 seconds worth of the limit. Requests over the limit get
+// 429 status. Client address is taken the same way as for -allow flag.
+// Memory used for rendering is bounded with -max-renders flag limiting the
+// number of pages rendered at the same time: requests over the limit wait
+// for a second, then get 503 status with Retry-After header.
+//
+// If reverse proxy makes server available under a path prefix, like
+// https://example.com/docs/, start it with -base-url=/docs/ so links on pages
+// point under this prefix. Server accepts requests both with and without the
+// prefix, so it doesn't matter whether proxy strips it.
+//
+// With -render-code flag, text and source files like .txt, .go, .yaml or .sh
+// are rendered as pages with line numbers, highlighted with highlight.js, so
+// documents can link to scripts which open readably in the browser. Lines can
+// be linked to as "script.sh#L10". Add "?raw" to URL to get the file itself.
+//
+// Documents in other formats, like AsciiDoc or reStructuredText, can be
+// rendered with external converters given with -convert flag as
+// ".ext=command" values, one converter per flag. Command gets document on
+// stdin and must write html to stdout; it's split into arguments on spaces,
+// without shell quoting:
+//
+//	mdserver -convert='.adoc=asciidoctor -s -o - -' -convert='.rst=pandoc -f rst -t html'
+//
+// Converted documents are listed in index and found by search. Add "?raw" to
+// document URL to get its source.
+//
+// Similarly, -render-csv flag makes .csv and .tsv files render as tables,
+// which can be sorted by clicking column headers. The first row of file is
+// used as table header.
+//
+// Markdown documents larger than 10 MiB are not rendered, responding with an
+// error page and 422 status instead; use -max-size flag to change this limit. Other files of any
+// size are served as is, with support for range requests, so large videos or
+// PDF files can be streamed and downloads resumed.
+//
+// To serve HTTPS, provide certificate and private key files with -tls-cert and
+// -tls-key flags. Server then also supports HTTP/2. Rendered pages carry Link
+// headers asking browsers to preload stylesheets and scripts they refer to.
+//
+// Server can be started with systemd socket activation: if it receives
+// listening sockets this way, it serves requests on the first of them,
+// ignoring -addr flag. Alternatively, number of inherited listening socket
+// file descriptor can be given with -listen-fd flag.
+//
+// To log requests, start server with -log-format flag set to either "common"
+// (common log format, followed by request kind and latency) or "json" (one
+// JSON object per line). Request kind is "static" for files served as is,
+// and "render" for everything else. Log is written to stdout, or to file
+// given with -log-file flag.
+//
+// To serve documents straight from a git repository without a checkout, pass
+// its path with -git flag, and optionally a reference (branch, tag, commit) to
+// serve files at with -ref flag ("HEAD" by default). Reference is resolved
+// on the fly, so new commits pushed to repository are served right away. Since
+// git doesn't track file modification times, all files are reported as
+// modified at the time of the commit. Repository is read directly, so git
+// command is only needed for document history in this mode.
+//
+// If documents have several versions kept in top-level directories like
+// "v1", "v2" and "main", list them with -versions flag, i.e.
+// "-versions=main,v2,v1", to get a version picker on their pages. Picker
+// links to the page with the same path in other versions, or to the root of
+// a version without such page. With -git flag, -versions lists git
+// references instead, like tags or branches; each one is served under
+// directory named after it, so "/v2/README.md" is README.md as of "v2" tag.
+//
+// If started with -editor-scheme flag, pages get "edit" link opening
+// document file in editor, so it's quick to jump from reading to changing
+// it. Flag value is either editor name: "vscode", "vscodium", "cursor",
+// "idea" (JetBrains IDEs), "txmt" (TextMate) or "subl" (Sublime Text), or a
+// URL template like "myeditor://open?file={path}", where "{path}" is
+// replaced with absolute path of the file. This requires editor to be
+// registered as a handler of such URLs, and is only useful when browser runs
+// on the same machine as the server. It cannot be used with -git flag.
+//
+// If started with -edit flag, documents can be edited in browser: request
+// document with "?edit" query to get an editor with live preview. Saved
+// changes are written to disk right away. Requesting missing document this way
+// creates it on save. If document was changed on disk while being edited,
+// saving is refused, so concurrent changes are not silently overwritten.
+// Unsaved text is kept as a draft in browser local storage and offered for
+// restore when editor is opened again. Note that this mode allows anyone who
+// can reach the server to change documents.
+//
+// If started with -dav flag, served files are also available over WebDAV at
+// /dav/ path, so they can be mounted by file managers and editors. Such access
+// is read-only, unless server is started with -dav-write flag.
+//
+// If served directory is inside a git work tree, or files are served with -git
+// flag, request document with "?history" query to list commits changing it,
+// with "?rev=<commit hash>" query to render it as of a given commit, and with
+// "?diff=<commit hash>..<commit hash>" query to see word-level changes of its
+// source between two commits.
+//
+// Markdown rendering used by the server is available for other programs as
+// github.com/artyom/mdserver/mdrender package. The server itself is available
+// as http.Handler serving documents from any fs.FS in
+// github.com/artyom/mdserver/mdhandler package, so programs can serve their
+// documentation embedded with go:embed.
 //
 // Note that table of contents generating javascript is a modified version of
 // code found at https://github.com/matthewkastor/html-table-of-contents which
@@ -30,16 +429,13 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"crypto/sha256"
-	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
-	"html/template"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -49,19 +445,31 @@ import (
 
 	"github.com/artyom/autoflags"
 	"github.com/artyom/httpgzip"
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/ast"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
-	"github.com/microcosm-cc/bluemonday"
+	"github.com/artyom/mdserver/mdhandler"
+	"github.com/artyom/mdserver/mdrender"
 	"github.com/pkg/browser"
-	"golang.org/x/text/language"
-	"golang.org/x/text/search"
 )
 
 func main() {
-	args := runArgs{Dir: ".", Addr: "localhost:8080"}
+	args := runArgs{Dir: ".", Addr: "localhost:8080", MaxSize: 10 << 20, Ext: ".md"}
 	autoflags.Parse(&args)
+	if args.Config != "" {
+		if err := applyConfig(flag.CommandLine, args.Config); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(2)
+		}
+	}
+	if flag.NArg() == 1 && flag.Arg(0) == "-" && args.File == "" {
+		args.File = "-"
+	}
+	if args.Public {
+		var withAddr bool
+		flag.Visit(func(f *flag.Flag) { withAddr = withAddr || f.Name == "addr" })
+		if !withAddr {
+			args.Addr = ":8080"
+		}
+		args.Open = false
+	}
 	if err := run(args); err != nil {
 		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
@@ -69,618 +477,416 @@ func main() {
 }
 
 type runArgs struct {
+	Config  string `flag:"config,read settings from this file, flags given on command line take precedence"`
 	Dir     string `flag:"dir,directory with markdown (.md) files"`
+	File    string `flag:"file,serve this single document at / instead of -dir, reloading page when it changes; - reads it from stdin"`
+	Render  string `flag:"render,write this document rendered to html page to stdout and exit"`
+	Editor  string `flag:"editor-scheme,link pages to their files in editor: vscode, vscodium, cursor, idea, txmt, subl, or URL template with {path}"`
+	Git     string `flag:"git,serve files from this git repository (may be bare) instead of -dir"`
+	Ref     string `flag:"ref,git reference to serve files at, used with -git (default HEAD)"`
+	Vers    string `flag:"versions,comma-separated list of top-level directories (or git refs, with -git) holding versions of documents"`
 	Addr    string `flag:"addr,address to listen"`
+	FD      int    `flag:"listen-fd,serve on this inherited listening socket file descriptor instead of -addr"`
+	Cert    string `flag:"tls-cert,serve HTTPS using this certificate file (PEM), requires -tls-key"`
+	Key     string `flag:"tls-key,private key file (PEM) for -tls-cert"`
 	Open    bool   `flag:"open,open index page in default browser on start"`
+	Public  bool   `flag:"public,listen on all interfaces unless -addr is set, never open browser; for use in containers"`
+	Allow   string `flag:"allow,comma-separated list of networks (CIDR) allowed to access server"`
+	PubURL  string `flag:"public-url,scheme and host site is reachable at, like https://docs.example.com, for absolute links in pages, sitemap and feed"`
+	Proxy   bool   `flag:"trust-proxy,take client address for -allow, scheme and host from X-Forwarded-* headers"`
+	Base    string `flag:"base-url,URL path prefix server is mounted at behind reverse proxy, like /docs/"`
+	Frames  string `flag:"frame-ancestors,sources allowed to embed pages in frames, in CSP syntax (default 'self')"`
+	Referer string `flag:"referrer-policy,Referrer-Policy header value (default strict-origin-when-cross-origin)"`
 	Ghub    bool   `flag:"github,rewrite github wiki links to local when rendering"`
 	Grep    bool   `flag:"search,enable substring search"`
 	Idx     bool   `flag:"rootindex,render autogenerated index at / in addition to /?index"`
+	Backref bool   `flag:"backlinks,show list of documents referencing current one on each page"`
+	Wiki    bool   `flag:"wikilinks,render [[Page Name]] and [[Page Name|label]] wikilinks"`
+	Emoji   bool   `flag:"emoji,render :shortcode: emoji as Unicode characters"`
+	Gloss   bool   `flag:"glossary,mark terms defined in _Glossary.md files with their definitions"`
+	Extern  bool   `flag:"external,mark links to other sites with an icon"`
+	NewTab  bool   `flag:"newtab,open links to other sites in a new tab"`
+	Check   bool   `flag:"check-links,mark links to missing local files as broken"`
+	IDPref  string `flag:"id-prefix,prefix for ids of document headings and footnotes, like user-content-"`
+	Preview bool   `flag:"link-preview,show title and the first paragraph of linked document on hover"`
+	Copy    bool   `flag:"copy,add buttons copying code blocks to clipboard"`
+	Outline bool   `flag:"outline,show collapsible \"On this page\" sidebar with document headings"`
+	Info    bool   `flag:"page-info,show modification time, size and last commit of document at the bottom of each page"`
+	PWA     bool   `flag:"pwa,keep visited pages for offline reading with a service worker"`
+	Keys    bool   `flag:"keys,enable keyboard shortcuts and Ctrl+K palette to jump to documents"`
+	DirTh   bool   `flag:"dir-themes,apply .mdserver/style.css and .mdserver/page.html from the nearest parent directory of each document"`
+	Include bool   `flag:"include,expand <!--#include file=\"name.md\"--> and {{include:name.md}} directives"`
+	PageNav bool   `flag:"pagenav,show links to previous and next documents on each page"`
+	Edit    bool   `flag:"edit,allow editing documents in browser, saving changes to disk"`
+	DAV     bool   `flag:"dav,serve files over WebDAV (read-only) under /dav/ path"`
+	DAVRW   bool   `flag:"dav-write,allow changing files over WebDAV, implies -dav"`
+	Robots  string `flag:"robots,path to robots.txt file to serve instead of the generated one"`
 	CSS     string `flag:"css,path to custom CSS file (embedded into page unless run with -csslink)"`
 	LinkCSS bool   `flag:"csslink,treat -css argument as local href inside <link rel=stylesheet>"`
 	HLJS    bool   `flag:"hljs,syntax-highlight code blocks with defined language using highlight.js"`
-}
-
-func run(args runArgs) error {
-	h := &mdHandler{
-		dir:        args.Dir,
-		fileServer: http.FileServer(http.Dir(args.Dir)),
-		githubWiki: args.Ghub,
-		withSearch: args.Grep,
-		rootIndex:  args.Idx,
-		hljs:       args.HLJS,
-		linkStyle:  args.LinkCSS,
-		style:      style,
-	}
-	if args.CSS != "" {
-		switch {
-		case args.LinkCSS:
-			if !path.IsAbs(args.CSS) {
-				return fmt.Errorf("with -csslink set, -css must be an absolute / separated path, but %q is not", args.CSS)
-			}
-			h.style = args.CSS
-			reportIfMissing(filepath.Join(args.Dir, filepath.FromSlash(args.CSS)))
-		default:
-			b, err := ioutil.ReadFile(args.CSS)
-			if err != nil {
-				return err
-			}
-			h.style = string(b)
-		}
-	}
-	if !args.LinkCSS {
-		sum := sha256.Sum256([]byte(h.style))
-		h.styleHash = "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	CSV     bool   `flag:"render-csv,render .csv and .tsv files as sortable tables"`
+	Code    bool   `flag:"render-code,render text and source files like .txt, .go or .sh as highlighted pages with line numbers"`
+	Assets  string `flag:"assets,directory with files served under /_assets/ path, overriding built-in ones"`
+	Tpls    string `flag:"templates,directory with html/template files overriding built-in page templates"`
+	Favicon string `flag:"favicon,path to icon file browsers show for pages"`
+	Logo    string `flag:"logo,path to image shown in navigation header of every page"`
+	MaxSize int64  `flag:"max-size,maximum size of markdown document to render, in bytes; 0 disables the limit"`
+	Ext     string `flag:"ext,comma-separated list of markdown document file extensions"`
+	LogFmt  string `flag:"log-format,access log format: common or json; no access log if empty"`
+	LogFile string `flag:"log-file,write access log to this file instead of stdout"`
+
+	Rate    float64 `flag:"rate-limit,maximum average number of requests per second from a single client; 0 disables the limit"`
+	Renders int     `flag:"max-renders,maximum number of pages rendered at the same time; 0 disables the limit"`
+
+	Rewrite rewriteRules `flag:"rewrite,link rewrite rule in \"regexp => replacement\" form, may be repeated"`
+	Convert converters   `flag:"convert,converter of documents in other formats to html in \".ext=command\" form, may be repeated"`
+	Themes  themeFiles   `flag:"theme,alternative stylesheet readers can pick with ?theme=name in \"name=file.css\" form, may be repeated"`
+}
+
+// rewriteRules is a flag.Value collecting link rewrite rules, one per flag
+type rewriteRules []mdrender.RewriteRule
+
+func (r *rewriteRules) String() string {
+	if r == nil {
+		return ""
 	}
-	srv := http.Server{
-		Addr:        args.Addr,
-		Handler:     httpgzip.New(h),
-		ReadTimeout: time.Second,
+	var out []string
+	for _, rule := range *r {
+		out = append(out, rule.String())
 	}
-	if args.Open {
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			browser.OpenURL("http://" + args.Addr + "/?index")
-		}()
-	}
-	return srv.ListenAndServe()
+	return strings.Join(out, "; ")
 }
 
-type mdHandler struct {
-	dir        string
-	fileServer http.Handler // initialized as http.FileServer(http.Dir(dir))
-	githubWiki bool
-	withSearch bool
-	rootIndex  bool
-	hljs       bool
-	linkStyle  bool
-	style      string
-	styleHash  string // sha256-{HASH} value for CSP
-}
-
-func (h *mdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("X-Frame-Options", "SAMEORIGIN")
-	if h.withSearch && r.URL.Path == "/" && strings.HasPrefix(r.URL.RawQuery, "q=") {
-		q := r.URL.Query().Get("q")
-		if len(q) < 3 {
-			http.Error(w, "Search term is too short", http.StatusBadRequest)
-			return
-		}
-		pat := search.New(language.English, search.Loose).CompileString(q)
-		h.renderIndex(w, fmt.Sprintf("Search results for %q", q), dirIndex(h.dir, pat))
-		return
-	}
-	if r.URL.Path == "/" && (h.rootIndex || r.URL.RawQuery == "index") {
-		h.renderIndex(w, "Index", dirIndex(h.dir, nil))
-		return
-	}
-	if !strings.HasSuffix(r.URL.Path, mdSuffix) {
-		h.fileServer.ServeHTTP(w, r)
-		return
-	}
-	// only markdown files are handled below
-	p := path.Clean(r.URL.Path)
-	if containsDotDot(p) {
-		http.Error(w, "invalid URL path", http.StatusBadRequest)
-		return
-	}
-	name := filepath.Join(h.dir, filepath.FromSlash(p))
-	rc, mtime, err := h.readerForFile(name)
+func (r *rewriteRules) Set(s string) error {
+	rule, err := mdrender.ParseRewriteRule(s)
 	if err != nil {
-		if os.IsNotExist(err) {
-			http.NotFound(w, r)
-			return
-		}
-		log.Printf("read %q: %v", name, err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return err
 	}
-	w.Header().Set("Content-Security-Policy", h.csp(h.hljs))
-	http.ServeContent(w, r, "page.html", mtime, rc)
+	*r = append(*r, rule)
+	return nil
 }
 
-func (h *mdHandler) renderIndex(w io.Writer, title string, index []indexRecord) error {
-	page := struct {
-		Title      string
-		StyleHref  string
-		Style      template.CSS
-		Index      []indexRecord
-		WithSearch bool
-	}{
-		Title:      title,
-		Index:      index,
-		WithSearch: h.withSearch,
+// converters is a flag.Value collecting external document converters, one
+// per flag, as ".ext=command" values.
+type converters map[string]string
+
+func (c *converters) String() string {
+	if c == nil {
+		return ""
 	}
-	switch {
-	case h.linkStyle:
-		page.StyleHref = h.style
-	default:
-		page.Style = template.CSS(h.style)
+	var out []string
+	for ext, cmd := range *c {
+		out = append(out, ext+"="+cmd)
 	}
-	return indexTemplate.Execute(w, page)
+	sort.Strings(out)
+	return strings.Join(out, "; ")
 }
 
-func (h *mdHandler) csp(withHL bool) string {
-	csp := []string{"default-src 'self';img-src http: https: data:;media-src https:"}
-	switch {
-	case withHL:
-		csp = append(csp, "script-src https://cdnjs.cloudflare.com "+
-			"'sha256-HGKuhVF4dzwg9Kt9XWXRYCoBYgGWsgnBiY1ynyCokzQ=' "+
-			"'sha256-qeFup2+SGOg8HaUXLE/qospaz+lv/lxjtZZVNa2AqTk='", // https://play.golang.org/p/0SUWatm_LGr
-		)
-		switch {
-		case h.linkStyle:
-			csp = append(csp, "style-src 'self' https://cdnjs.cloudflare.com")
-		default:
-			csp = append(csp, "style-src https://cdnjs.cloudflare.com '"+h.styleHash+"'")
-		}
-	default:
-		csp = append(csp, "script-src 'sha256-HGKuhVF4dzwg9Kt9XWXRYCoBYgGWsgnBiY1ynyCokzQ='")
-		switch {
-		case h.linkStyle:
-			csp = append(csp, "style-src 'self'")
-		default:
-			csp = append(csp, "style-src '"+h.styleHash+"'")
-		}
+func (c *converters) Set(s string) error {
+	ext, cmd, ok := strings.Cut(s, "=")
+	if ext, cmd = strings.TrimSpace(ext), strings.TrimSpace(cmd); !ok || ext == "" || cmd == "" {
+		return fmt.Errorf("invalid converter %q, want \".ext=command\"", s)
 	}
-	return strings.Join(csp, ";")
-}
-
-// readerForFile returns lazy io.ReadSeeker and mtime to be used as arguments of
-// http.ServeContent. It does not use ReadSeeker at all if http client already
-// has fresh content as signaled by "If-Modified-Since" request header;
-// lazyReadSeeker takes advantage of this by defering any file reading and
-// rendering until one of its method is called.
-func (h *mdHandler) readerForFile(name string) (*lazyReadSeeker, time.Time, error) {
-	fi, err := os.Stat(name)
-	if err != nil {
-		return nil, time.Time{}, err
+	if *c == nil {
+		*c = make(converters)
 	}
-	return &lazyReadSeeker{name: name, h: h}, fi.ModTime(), nil
+	(*c)[ext] = cmd
+	return nil
 }
 
-type lazyReadSeeker struct {
-	name string
-	h    *mdHandler
-	r    *bytes.Reader // initially nil, initialized with init()
-}
+// themeFiles is a flag.Value collecting alternative stylesheets, one per
+// flag, as "name=file.css" values.
+type themeFiles map[string]string
 
-func (l *lazyReadSeeker) init() error {
-	if l.r != nil {
-		return nil
-	}
-	if testRun {
-		log.Print("lazyReadSeeker init()")
-	}
-	b, err := ioutil.ReadFile(l.name)
-	if err != nil {
-		return err
-	}
-	opts := rendererOpts
-	if l.h.githubWiki {
-		opts.RenderNodeHook = rewriteGithubWikiLinks
-	}
-	doc := parser.NewWithExtensions(extensions).Parse(b)
-	body := markdown.Render(doc, html.NewRenderer(opts))
-	body = policy.SanitizeBytes(body)
-	title := firstHeaderText(doc)
-	if title == "" {
-		title = nameToTitle(filepath.Base(l.name))
-	}
-	withHL := l.h.hljs && bytes.Contains(body, []byte(`<pre><code class=`))
-	page := struct {
-		Title     string
-		StyleHref string
-		Style     template.CSS
-		Body      template.HTML
-		WithHL    bool
-	}{
-		Title:  title,
-		Body:   template.HTML(body),
-		WithHL: withHL,
-	}
-	switch {
-	case l.h.linkStyle:
-		page.StyleHref = l.h.style
-	default:
-		page.Style = template.CSS(l.h.style)
+func (t *themeFiles) String() string {
+	if t == nil {
+		return ""
 	}
-	buf := bytes.NewBuffer(b[:0]) // reuse b to reduce allocations
-	if err := pageTemplate.Execute(buf, page); err != nil {
-		return err
+	var out []string
+	for name, file := range *t {
+		out = append(out, name+"="+file)
 	}
-	l.r = bytes.NewReader(buf.Bytes())
-	return nil
+	sort.Strings(out)
+	return strings.Join(out, "; ")
 }
 
-func (l *lazyReadSeeker) Read(p []byte) (n int, err error) {
-	if l.r == nil {
-		if err := l.init(); err != nil {
-			return 0, err
-		}
+func (t *themeFiles) Set(s string) error {
+	name, file, ok := strings.Cut(s, "=")
+	if name, file = strings.TrimSpace(name), strings.TrimSpace(file); !ok || name == "" || file == "" {
+		return fmt.Errorf("invalid theme %q, want \"name=file.css\"", s)
 	}
-	return l.r.Read(p)
-}
-
-func (l *lazyReadSeeker) Seek(offset int64, whence int) (int64, error) {
-	if l.r == nil {
-		if err := l.init(); err != nil {
-			return 0, err
-		}
+	if *t == nil {
+		*t = make(themeFiles)
 	}
-	return l.r.Seek(offset, whence)
+	(*t)[name] = file
+	return nil
 }
 
-func dirIndex(dir string, pat *search.Pattern) []indexRecord {
-	var matches []string
-	fn := func(p string, info os.FileInfo, err error) error {
+func run(args runArgs) error {
+	var home string // document served at / with -file
+	switch {
+	case args.File != "" && args.Render != "":
+		return errors.New("-file and -render cannot be used together")
+	case args.File != "" && args.Git != "":
+		return errors.New("-file cannot be used with -git")
+	case args.File == "-":
+		home = stdinName
+	case args.File != "":
+		name, err := filepath.Abs(args.File)
 		if err != nil {
 			return err
 		}
-		if info.IsDir() && p != "." && strings.HasPrefix(filepath.Base(p), ".") {
-			return filepath.SkipDir
+		if st, err := os.Stat(name); err != nil {
+			return err
+		} else if !st.Mode().IsRegular() {
+			return fmt.Errorf("-file must be a regular file, but %q is not", args.File)
+		}
+		args.Dir, home = filepath.Dir(name), filepath.Base(name)
+	}
+	opts := &mdhandler.Options{
+		Dir:             args.Dir,
+		GithubWiki:      args.Ghub,
+		WikiLinks:       args.Wiki,
+		Emoji:           args.Emoji,
+		Includes:        args.Include,
+		Glossary:        args.Gloss,
+		External:        args.Extern,
+		NewTab:          args.NewTab,
+		CheckLinks:      args.Check,
+		Previews:        args.Preview,
+		Keys:            args.Keys,
+		PWA:             args.PWA,
+		CopyButtons:     args.Copy,
+		PageInfo:        args.Info,
+		Outline:         args.Outline,
+		DirThemes:       args.DirTh,
+		Backlinks:       args.Backref,
+		PageNav:         args.PageNav,
+		Search:          args.Grep,
+		RootIndex:       args.Idx,
+		HighlightJS:     args.HLJS,
+		RenderCode:      args.Code,
+		RenderCSV:       args.CSV,
+		Edit:            args.Edit,
+		DAV:             args.DAV,
+		DAVWrite:        args.DAVRW,
+		TrustProxy:      args.Proxy,
+		Assets:          args.Assets,
+		Templates:       args.Tpls,
+		MaxSize:         args.MaxSize,
+		Rewrite:         args.Rewrite,
+		BaseURL:         args.Base,
+		Converters:      args.Convert,
+		Themes:          args.Themes,
+		HeadingIDPrefix: args.IDPref,
+		PublicURL:       args.PubURL,
+		Favicon:         args.Favicon,
+		Logo:            args.Logo,
+		MaxRenders:      args.Renders,
+		FrameAncestors:  args.Frames,
+		ReferrerPolicy:  args.Referer,
+	}
+	if args.Editor != "" && home != stdinName {
+		if opts.EditorURL = editorSchemes[args.Editor]; opts.EditorURL == "" {
+			opts.EditorURL = args.Editor
+		}
+	}
+	for _, ext := range strings.Split(args.Ext, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			opts.Extensions = append(opts.Extensions, ext)
 		}
-		if info.IsDir() || !strings.HasSuffix(p, mdSuffix) {
-			return nil
+	}
+	for _, v := range strings.Split(args.Vers, ",") {
+		if v = strings.Trim(strings.TrimSpace(v), "/"); v != "" {
+			opts.Versions = append(opts.Versions, v)
 		}
-		matches = append(matches, p)
-		return nil
 	}
-	if err := filepath.Walk(dir, fn); err != nil {
-		log.Printf("walk %q: %v", dir, err)
+	fsys := os.DirFS(args.Dir)
+	if home != "" {
+		opts.Home, opts.AutoReload = home, true
 	}
-	var index []indexRecord
-	if pat == nil {
-		index = make([]indexRecord, 0, len(matches))
+	if home == stdinName {
+		if args.Edit || args.DAVRW {
+			return errors.New("-edit and -dav-write cannot be used with stdin")
+		}
+		fsys = newStdinFS(fsys, stdinName, os.Stdin)
 	}
-	for _, s := range matches {
-		if pat != nil && !matchPattern(pat, s) {
-			continue
+	var render string // document rendered to stdout with -render
+	if args.Render != "" && args.Git == "" {
+		root, rel, err := renderTarget(args.Dir, args.Render)
+		if err != nil {
+			return err
 		}
-		title := documentTitle(s)
-		if title == "" {
-			title = nameToTitle(filepath.Base(s))
+		fsys, opts.Dir, render = os.DirFS(root), root, rel
+	}
+	if args.Git != "" {
+		if args.Edit || args.DAVRW {
+			return errors.New("-edit and -dav-write cannot be used with -git")
+		}
+		var g fs.FS
+		var err error
+		switch {
+		case len(opts.Versions) != 0 && args.Ref != "":
+			return errors.New("-ref and -versions cannot be used together with -git")
+		case len(opts.Versions) != 0:
+			g, err = mdhandler.GitRefsFS(args.Git, opts.Versions)
+		default:
+			g, err = mdhandler.GitFS(args.Git, args.Ref)
 		}
-		file, err := filepath.Rel(dir, s)
 		if err != nil {
-			continue
+			return err
 		}
-		index = append(index, indexRecord{
-			Title:  title,
-			File:   filepath.ToSlash(file),
-			Subdir: filepath.ToSlash(filepath.Dir(file)),
-			// precalculate sort key to speed up comparisons on sort
-			sortKey: strings.ToLower(strings.TrimSuffix(filepath.Base(file), mdSuffix)),
-		})
-	}
-	sort.Slice(index, func(i, j int) bool {
-		si, sj := index[i].Subdir, index[j].Subdir
-		if si == sj {
-			return index[i].sortKey < index[j].sortKey
+		fsys, opts.Dir = g, ""
+		if args.Render != "" {
+			render = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(args.Render)), "/")
 		}
-		return si < sj
-	})
-	return index
-}
-
-type indexRecord struct {
-	Title, File string
-	Subdir      string // groups index records when rendering template
-	sortKey     string // if File is "dir/FileName.md", then sortKey is "filename"
-}
-
-// documentTitle extracts h1 header from markdown document
-func documentTitle(file string) string {
-	f, err := os.Open(file)
-	if err != nil {
-		return ""
 	}
-	defer f.Close()
-	b, err := ioutil.ReadAll(io.LimitReader(f, 1<<17))
-	if err != nil {
-		return ""
+	if (args.Cert == "") != (args.Key == "") {
+		return errors.New("-tls-cert and -tls-key must be used together")
 	}
-	return firstHeaderText(parser.New().Parse(b))
-}
-
-func firstHeaderText(doc ast.Node) string {
-	var title string
-	walkFn := func(node ast.Node, entering bool) ast.WalkStatus {
-		if !entering {
-			return ast.GoToNext
+	if args.Assets != "" {
+		if st, err := os.Stat(args.Assets); err != nil {
+			return err
+		} else if !st.IsDir() {
+			return fmt.Errorf("-assets must be a directory, but %q is not", args.Assets)
 		}
-		switch n := node.(type) {
-		case *ast.Heading:
-			if n.Level != 1 {
-				return ast.GoToNext
-			}
-			title = string(childLiterals(n))
-			return ast.Terminate
-		case *ast.Code, *ast.CodeBlock, *ast.BlockQuote:
-			return ast.SkipChildren
+	}
+	if args.Tpls != "" {
+		if st, err := os.Stat(args.Tpls); err != nil {
+			return err
+		} else if !st.IsDir() {
+			return fmt.Errorf("-templates must be a directory, but %q is not", args.Tpls)
 		}
-		return ast.GoToNext
 	}
-	_ = ast.Walk(doc, ast.NodeVisitorFunc(walkFn))
-	return title
-}
-
-func childLiterals(node ast.Node) []byte {
-	if l := node.AsLeaf(); l != nil {
-		return l.Literal
-	}
-	var out [][]byte
-	for _, n := range node.GetChildren() {
-		if lit := childLiterals(n); lit != nil {
-			out = append(out, lit)
+	if args.Robots != "" {
+		b, err := os.ReadFile(args.Robots)
+		if err != nil {
+			return err
 		}
+		opts.Robots = b
 	}
-	if out == nil {
-		return nil
+	if args.CSS != "" {
+		switch {
+		case args.LinkCSS:
+			if !path.IsAbs(args.CSS) {
+				return fmt.Errorf("with -csslink set, -css must be an absolute / separated path, but %q is not", args.CSS)
+			}
+			opts.StyleHref = args.CSS
+			reportIfMissing(filepath.Join(args.Dir, filepath.FromSlash(args.CSS)))
+		default:
+			opts.CSSFile = args.CSS
+		}
 	}
-	return bytes.Join(out, nil)
-}
-
-// matchPattern reports whether any line in file matches given pattern. On any
-// errors function return false.
-func matchPattern(pat *search.Pattern, file string) bool {
-	f, err := os.Open(file)
+	h, err := mdhandler.New(fsys, opts)
 	if err != nil {
-		return false
+		return err
 	}
-	defer f.Close()
-	sc := bufio.NewScanner(io.LimitReader(f, 1<<20))
-	for sc.Scan() {
-		if _, end := pat.Index(sc.Bytes()); end > 0 {
-			return true
+	if render != "" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := h.WriteDocument(w, render); err != nil {
+			return err
 		}
+		return w.Flush()
 	}
-	return false
-}
-
-// rewriteGithubWikiLinks is a html.RenderNodeFunc which renders links
-// with github wiki destinations as local ones.
-//
-// Link with "https://github.com/user/project/wiki/Page" destination would be
-// rendered as a link to "Page.md"
-func rewriteGithubWikiLinks(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
-	link, ok := node.(*ast.Link)
-	if !ok || !entering {
-		return ast.GoToNext, false
-	}
-	if u, err := url.Parse(string(link.Destination)); err == nil &&
-		u.Host == "github.com" && strings.HasSuffix(path.Dir(u.Path), "/wiki") {
-		dst := path.Base(u.Path) + mdSuffix
-		switch u.Fragment {
-		case "":
-			fmt.Fprintf(w, "<a href=\"%s\">", url.QueryEscape(dst))
-		default:
-			fmt.Fprintf(w, "<a href=\"%s#%s\">", url.QueryEscape(dst), url.QueryEscape(u.Fragment))
+	var handler http.Handler = httpgzip.New(h)
+	if args.Allow != "" {
+		nets, err := parseAllowList(args.Allow)
+		if err != nil {
+			return fmt.Errorf("-allow: %w", err)
 		}
-		return ast.GoToNext, true
+		handler = &allowList{next: handler, nets: nets, trustProxy: args.Proxy}
 	}
-	return ast.GoToNext, false
-}
-
-// reportIfMissing tests whether file exists and logs if not
-func reportIfMissing(name string) {
-	if st, err := os.Stat(name); os.IsNotExist(err) || (st != nil && !st.Mode().IsRegular()) {
-		log.Printf("called with -csslink, but path %q does not exist or not a regular file", name)
+	switch {
+	case args.Rate < 0:
+		return errors.New("-rate-limit must not be negative")
+	case args.Rate > 0:
+		handler = newRateLimiter(handler, args.Rate, args.Proxy)
+	}
+	switch args.LogFmt {
+	case "":
+	case "common", "json":
+		var w io.Writer = os.Stdout
+		if args.LogFile != "" {
+			f, err := os.OpenFile(args.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		handler = mdhandler.AccessLog(handler, w, args.LogFmt == "json")
+	default:
+		return fmt.Errorf("unsupported -log-format value %q, must be either common or json", args.LogFmt)
 	}
-}
-
-func nameToTitle(name string) string {
-	if strings.ContainsAny(name, " ") {
-		return strings.TrimSuffix(name, mdSuffix)
+	srv := http.Server{
+		Addr:              args.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Second,
+		ReadTimeout:       time.Second,
 	}
-	return repl.Replace(strings.TrimSuffix(name, mdSuffix))
-}
-
-var repl = strings.NewReplacer("-", " ")
-
-const mdSuffix = ".md"
-
-var indexTemplate = template.Must(template.New("index").Parse(indexTpl))
-var pageTemplate = template.Must(template.New("page").Parse(pageTpl))
-
-const indexTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
-<meta name="viewport" content="width=device-width, initial-scale=1">
-{{if .StyleHref}}<link rel="stylesheet" href="{{.StyleHref}}">{{end -}}
-{{if .Style}}<style>{{.Style}}</style>{{end}}</head><body id="mdserver-autoindex">{{if .WithSearch}}<form method="get">
-<input type="search" name="q" minlength="3" placeholder="Substring search" autofocus required>
-<input type="submit"></form>{{end}}
-<h1>{{.Title}}</h1><ul>{{$prev := "."}}
-{{range .Index}}{{if ne .Subdir $prev}}{{$prev = .Subdir}}</ul><h2>{{.Subdir}}</h2><ul>{{end}}<li><a href="{{.File}}">{{.Title}}</a></li>
-{{end}}</ul></body>
-`
-
-const pageTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
-<meta name="viewport" content="width=device-width, initial-scale=1">
-{{if .StyleHref}}<link rel="stylesheet" href="{{.StyleHref}}">{{end -}}
-{{if .Style}}<style>{{.Style}}</style>{{end}}<script>
-document.addEventListener('DOMContentLoaded', function() {
-	htmlTableOfContents();
-} );
-function htmlTableOfContents( documentRef ) {
-	var documentRef = documentRef || document;
-	var headings = [].slice.call(documentRef.body.querySelectorAll('article h1, article h2, article h3, article h4, article h5, article h6'));
-	if (headings.length < 2) { return };
-	var toc = documentRef.querySelector("nav#toc details");
-	var ul = documentRef.createElement( "ul" );
-	headings.forEach(function (heading, index) {
-		var ref = heading.getAttribute( "id" );
-		var link = documentRef.createElement( "a" );
-		link.setAttribute( "href", "#"+ ref );
-		link.textContent = heading.textContent;
-		var li = documentRef.createElement( "li" );
-		li.setAttribute( "class", heading.tagName.toLowerCase() );
-		li.appendChild( link );
-		ul.appendChild( li );
-	});
-	toc.appendChild( ul );
-}
-</script>{{if .WithHL}}
-<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/styles/default.min.css" integrity="sha256-zcunqSn1llgADaIPFyzrQ8USIjX2VpuxHzUwYisOwo8=" crossorigin="anonymous" referrerpolicy="no-referrer">
-<script src="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/highlight.min.js" integrity="sha256-aYTdUrn6Ow1DDgh5JTc3aDGnnju48y/1c8s1dgkYPQ8=" crossorigin="anonymous" referrerpolicy="no-referrer"></script>
-<script>
-document.addEventListener('DOMContentLoaded', (event) => {
-	document.querySelectorAll('pre code[class^="language-"]').forEach((block) => {
-		hljs.highlightBlock(block);
-	});
-});
-</script>{{end}}
-</head><body><nav id="site"><a href="/?index">index</a></nav>
-<nav id="toc"><details open><summary>Contents</summary></details></nav>
-<ul id="toc"></ul>
-<article>
-{{.Body}}
-</article></body>
-`
-
-const extensions = parser.CommonExtensions | parser.AutoHeadingIDs ^ parser.MathJax
-
-var rendererOpts = html.RendererOptions{Flags: html.CommonFlags}
-var policy = bluemonday.UGCPolicy().AllowAttrs("class").OnElements("code")
-
-func containsDotDot(v string) bool {
-	if !strings.Contains(v, "..") {
-		return false
+	if args.Edit {
+		// saving document over a slow link takes longer than a second
+		srv.ReadTimeout = time.Minute
 	}
-	for _, ent := range strings.FieldsFunc(v, func(r rune) bool { return r == '/' || r == '\\' }) {
-		if ent == ".." {
-			return true
-		}
+	ln, err := listen(args.Addr, args.FD)
+	if err != nil {
+		return err
 	}
-	return false
-}
-
-const style = `body {
-	font-family: Charter, Constantia, serif;
-	font-size: 1rem;
-	line-height: 170%;
-	max-width: 45em;
-	margin: auto;
-	padding-right: 1em;
-	padding-left: 1em;
-	color: #333;
-	background: white;
-	text-rendering: optimizeLegibility;
-}
-
-@media only screen and (max-width: 480px) {
-	body {
-		font-size: 125%;
-		text-rendering: auto;
+	defer ln.Close()
+	scheme := "http"
+	if args.Cert != "" {
+		scheme = "https"
 	}
+	if args.Open {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			u := scheme + "://" + ln.Addr().String() + "/?index"
+			if home != "" {
+				u = scheme + "://" + ln.Addr().String() + "/"
+			}
+			browser.OpenURL(u)
+		}()
+	}
+	if args.Cert != "" {
+		return srv.ServeTLS(ln, args.Cert, args.Key)
+	}
+	return srv.Serve(ln)
 }
 
-a {color: #a08941; text-decoration: none;}
-a:hover {color: #c6b754; text-decoration: underline;}
-
-h1 a, h2 a, h3 a, h4 a, h5 a {
-	text-decoration: none;
-	color: gray;
-	break-after: avoid;
-}
-h1 a:hover, h2 a:hover, h3 a:hover, h4 a:hover, h5 a:hover {
-	text-decoration: none;
-	color: gray;
-}
-h1, h2, h3, h4, h5 {
-	font-weight: bold;
-	color: gray;
-}
-
-h1 {
-	font-size: 150%;
-}
-
-h2 {
-	font-size: 130%;
-}
-
-h3 {
-	font-size: 110%;
-}
-
-h4, h5 {
-	font-size: 100%;
-	font-style: italic;
-}
-
-pre {
-	background-color: rgb(240,240,240);
-	color: #111111;
-	padding: 0.5em;
-	overflow: auto;
-}
-code, pre {
-	font-family: Consolas, "PT Mono", monospace;
-}
-pre { font-size: 90%; }
-
-hr { border:none; text-align:center; color:gray; }
-hr:after {
-	content:"\2766";
-	display:inline-block;
-	font-size:1.5em;
-}
-
-dt code {
-	font-weight: bold;
-}
-dd p {
-	margin-top: 0;
-}
-
-blockquote {
-	border-left:thick solid lightgrey;
-	color: #111111;
-	padding: 0 0.5em;
-}
-
-img {display:block;margin:auto;max-width:100%}
-
-table, td, th {
-	border:thin solid lightgrey;
-	border-collapse:collapse;
-	vertical-align:middle;
+// editorSchemes map editor names accepted by -editor-scheme flag to their
+// URL templates
+var editorSchemes = map[string]string{
+	"vscode":   "vscode://file{path}",
+	"vscodium": "vscodium://file{path}",
+	"cursor":   "cursor://file{path}",
+	"idea":     "idea://open?file={path}",
+	"txmt":     "txmt://open?url=file://{path}",
+	"subl":     "subl://open?url=file://{path}",
 }
-td, th {padding:0.2em 0.5em}
-tr:nth-child(even) {background-color: rgba(200,200,200,0.2)}
 
-nav#toc {margin:1em 0 1em 0}
-nav#toc summary {font-weight:bold; color:gray}
-nav#toc ul:after {
-	content:"\2042";
-	text-align:center;
-	display:block;
-	color:gray;
+// renderTarget returns directory to serve and path of document name inside
+// it to render it with -render flag: if name is inside served directory dir,
+// document is rendered as a part of it, otherwise as a part of its own
+// directory.
+func renderTarget(dir, name string) (root, rel string, err error) {
+	if root, err = filepath.Abs(dir); err != nil {
+		return "", "", err
+	}
+	if name, err = filepath.Abs(name); err != nil {
+		return "", "", err
+	}
+	rel, err = filepath.Rel(root, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		root, rel = filepath.Dir(name), filepath.Base(name)
+	}
+	return root, filepath.ToSlash(rel), nil
 }
-nav#toc ul {margin:0; list-style:none; padding-left:0}
-nav#toc ul li.h2 {padding-left:1em}
-nav#toc ul li.h3 {padding-left:2em}
-nav#toc ul li.h4 {padding-left:3em}
-nav#toc ul li.h5 {padding-left:4em}
-nav#toc ul li.h6 {padding-left:5em}
 
-nav#site {
-	font-size:90%;
-	text-align:right;
-	padding:.5em;
-	border-bottom: 1px solid gray;
+// reportIfMissing tests whether file exists and logs if not
+func reportIfMissing(name string) {
+	if st, err := os.Stat(name); os.IsNotExist(err) || (st != nil && !st.Mode().IsRegular()) {
+		log.Printf("called with -csslink, but path %q does not exist or not a regular file", name)
+	}
 }
-nav#site a:before {content:"\2767\0020"}
-
-footer summary {font-weight:bold; color:gray}
-
-summary {cursor:pointer; outline:none}
-summary:only-child {display:none}
-
-@media print {
-	nav {display: none}
-	pre {overflow-wrap:break-word; white-space:pre-wrap}
-}`
-
-var testRun bool // used in tests
 
 //go:generate sh -c "go doc >README"
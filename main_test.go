@@ -1,52 +1,181 @@
 package main
 
 import (
-	"bytes"
+	"flag"
 	"io"
-	"io/ioutil"
-	"log"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/artyom/autoflags"
 )
 
-func TestLazyRendering(t *testing.T) {
-	srv := httptest.NewServer(&mdHandler{dir: "testdata"})
-	defer srv.Close()
-	logBuf := new(bytes.Buffer)
-	log.SetOutput(logBuf)
-	r, err := http.Get(srv.URL + "/hello.md")
-	if err != nil {
+func TestConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "mdserver.toml")
+	text := "# comment\n\ndir = \"/srv/wiki\" # trailing comment\naddr = 'localhost:9000'\nsearch = true\n" +
+		"rewrite = '^https://a/(.*) => $1.md'\nrewrite = '^https://b/ => /b/'\n"
+	if err := os.WriteFile(name, []byte(text), 0666); err != nil {
 		t.Fatal(err)
 	}
-	if r.StatusCode != http.StatusOK {
-		t.Fatalf("invalid status on first call, want 200, got: %q", r.Status)
+	var args runArgs
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	autoflags.DefineFlagSet(fs, &args)
+	if err := fs.Parse([]string{"-addr=localhost:8080"}); err != nil {
+		t.Fatal(err)
 	}
-	if _, err := io.Copy(ioutil.Discard, r.Body); err != nil {
+	if err := applyConfig(fs, name); err != nil {
 		t.Fatal(err)
 	}
-	lastmod := r.Header.Get("Last-Modified")
-	if lastmod == "" {
-		t.Fatalf("no or empty Last-Modified header; response headers are:\n%v", r.Header)
+	if got, want := args.Rewrite.String(), "^https://a/(.*) => $1.md; ^https://b/ => /b/"; got != want {
+		t.Errorf("got rewrite rules %q, want %q", got, want)
 	}
-	r.Body.Close()
-	req, err := http.NewRequest(http.MethodGet, srv.URL+"/hello.md", nil)
-	if err != nil {
+	args.Rewrite = nil
+	want := runArgs{Dir: "/srv/wiki", Addr: "localhost:8080", Grep: true}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("got %+v, want %+v", args, want)
+	}
+	if err := os.WriteFile(name, []byte("nosuchflag = 1\n"), 0666); err != nil {
 		t.Fatal(err)
 	}
-	req.Header.Set("If-Modified-Since", lastmod)
-	r, err = http.DefaultClient.Do(req)
+	if err := applyConfig(fs, name); err == nil {
+		t.Fatal("unknown setting accepted")
+	}
+	if err := os.WriteFile(name, []byte("[auth]\nuser = \"x\"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs, name); err == nil || !strings.Contains(err.Error(), "tables are not supported") {
+		t.Fatalf("table accepted or reported with unexpected error: %v", err)
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	nets, err := parseAllowList("10.0.0.0/8, 192.168.1.5,::1")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if r.StatusCode != http.StatusNotModified {
-		t.Fatalf("unexpected status on second call, want 304, got: %q", r.Status)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		remote, forwarded string
+		trustProxy        bool
+		want              int
+	}{
+		{remote: "10.1.2.3:1234", want: http.StatusOK},
+		{remote: "192.168.1.5:1234", want: http.StatusOK},
+		{remote: "192.168.1.6:1234", want: http.StatusForbidden},
+		{remote: "[::1]:1234", want: http.StatusOK},
+		{remote: "10.1.2.3:1234", forwarded: "1.2.3.4", want: http.StatusOK},
+		{remote: "10.1.2.3:1234", forwarded: "1.2.3.4", trustProxy: true, want: http.StatusForbidden},
+		{remote: "127.0.0.1:1234", forwarded: "1.2.3.4, 10.0.0.1", trustProxy: true, want: http.StatusOK},
+	} {
+		a := &allowList{next: ok, nets: nets, trustProxy: tc.trustProxy}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%+v: got status %d", tc, w.Code)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(nil, 1, false)
+	now := time.Now()
+	for i := 0; i < rateBurst; i++ {
+		if wait := rl.take("10.0.0.1", now); wait != 0 {
+			t.Fatalf("request %d within burst limited, wait %v", i, wait)
+		}
+	}
+	if wait := rl.take("10.0.0.1", now); wait != time.Second {
+		t.Fatalf("request over burst: got wait %v, want 1s", wait)
+	}
+	if wait := rl.take("10.0.0.2", now); wait != 0 {
+		t.Fatalf("another client limited, wait %v", wait)
+	}
+	if wait := rl.take("10.0.0.1", now.Add(time.Second)); wait != 0 {
+		t.Fatalf("request after refill limited, wait %v", wait)
 	}
-	defer r.Body.Close()
-	if cnt := strings.Count(logBuf.String(), "lazyReadSeeker init()"); cnt != 1 {
-		t.Fatalf("want 1 logged lazyReadSeeker init call, got %d; full log:\n%s", cnt, logBuf.String())
+	rl.take("10.0.0.1", now.Add(2*time.Minute))
+	if _, ok := rl.clients["10.0.0.2"]; ok {
+		t.Fatal("idle client not forgotten")
+	}
+
+	rl = newRateLimiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 0.1, false)
+	codes := make(map[int]int)
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		rl.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes[w.Code]++
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("no Retry-After header")
+		}
+	}
+	if codes[http.StatusOK] != 1 || codes[http.StatusTooManyRequests] != 2 {
+		t.Fatalf("unexpected status codes: %v", codes)
+	}
+}
+
+func TestStdinFS(t *testing.T) {
+	pr, pw := io.Pipe()
+	fsys := newStdinFS(fstest.MapFS{"image.png": {Data: []byte("png")}}, stdinName, pr)
+	read := func() string {
+		t.Helper()
+		b, err := fs.ReadFile(fsys, stdinName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if s := read(); s != "" {
+		t.Fatalf("got %q before any input", s)
+	}
+	for _, s := range []string{"# Title\n", "\nText.\n"} {
+		if _, err := io.WriteString(pw, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pw.Close()
+	deadline := time.Now().Add(time.Second)
+	for read() != "# Title\n\nText.\n" {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %q", read())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := fs.Stat(fsys, "image.png"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderTarget(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct{ name, root, rel string }{
+		{filepath.Join(dir, "docs", "sub", "page.md"), filepath.Join(dir, "docs"), "sub/page.md"},
+		{filepath.Join(dir, "other", "page.md"), filepath.Join(dir, "other"), "page.md"},
+	} {
+		root, rel, err := renderTarget(filepath.Join(dir, "docs"), tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != tc.root || rel != tc.rel {
+			t.Errorf("%s: got %q, %q, want %q, %q", tc.name, root, rel, tc.root, tc.rel)
+		}
 	}
 }
 
-func init() { testRun = true }
+func TestGitRefWithVersions(t *testing.T) {
+	err := run(runArgs{Git: t.TempDir(), Ref: "HEAD", Vers: "v1,v2"})
+	if err == nil || !strings.Contains(err.Error(), "-ref and -versions") {
+		t.Fatalf("got error %v, want one about -ref and -versions", err)
+	}
+}
@@ -0,0 +1,122 @@
+package mdhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accessLog is a http.Handler logging requests served by the wrapped handler
+// in either common log format, or as JSON objects, one per line.
+type accessLog struct {
+	next   http.Handler
+	asJSON bool
+
+	mu sync.Mutex // guards w
+	w  io.Writer
+}
+
+// AccessLog returns http.Handler logging requests served by next to w, in
+// common log format followed by request kind ("static" for files served as
+// is, "render" for everything else) and latency, or as JSON objects, one per
+// line, if asJSON is true. To tell static requests from others, next must be
+// Handler, possibly wrapped by other handlers.
+func AccessLog(next http.Handler, w io.Writer, asJSON bool) http.Handler {
+	return &accessLog{next: next, w: w, asJSON: asJSON}
+}
+
+// logEntry holds details of a single request, populated while it is served.
+type logEntry struct {
+	static bool // request was served by static file server
+}
+
+type logEntryKey struct{}
+
+// markStatic marks request as served by static file server, if it is logged.
+func markStatic(r *http.Request) {
+	if e, ok := r.Context().Value(logEntryKey{}).(*logEntry); ok {
+		e.static = true
+	}
+}
+
+func (l *accessLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	begin := time.Now()
+	entry := &logEntry{}
+	sw := &statusWriter{ResponseWriter: w}
+	l.next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), logEntryKey{}, entry)))
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	kind := "render"
+	if entry.static {
+		kind = "static"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	var line []byte
+	switch {
+	case l.asJSON:
+		line, _ = json.Marshal(struct {
+			Time     time.Time `json:"time"`
+			Remote   string    `json:"remote"`
+			Method   string    `json:"method"`
+			URI      string    `json:"uri"`
+			Proto    string    `json:"proto"`
+			Status   int       `json:"status"`
+			Size     int64     `json:"size"`
+			Duration float64   `json:"duration_ms"`
+			Kind     string    `json:"kind"`
+		}{
+			Time:     begin,
+			Remote:   host,
+			Method:   r.Method,
+			URI:      r.RequestURI,
+			Proto:    r.Proto,
+			Status:   sw.status,
+			Size:     sw.size,
+			Duration: float64(time.Since(begin).Microseconds()) / 1000,
+			Kind:     kind,
+		})
+		line = append(line, '\n')
+	default:
+		line = []byte(fmt.Sprintf("%s - - [%s] %s %d %d %s %s\n",
+			host, begin.Format("02/Jan/2006:15:04:05 -0700"),
+			strconv.Quote(r.Method+" "+r.RequestURI+" "+r.Proto),
+			sw.status, sw.size, kind, time.Since(begin).Round(time.Microsecond)))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// statusWriter is a http.ResponseWriter keeping track of response status and
+// size.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,193 @@
+package mdhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/artyom/mdserver/mdrender"
+)
+
+// serveAPI handles JSON API requests:
+//
+//	GET /api/index               — list of all documents
+//	GET /api/doc/<path>          — metadata and rendered html of a single document
+//	GET /api/outline/<path>      — title and nested headings of a document
+//	GET /api/preview?path=<path> — title and the first paragraph of a document
+func (h *Handler) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	switch {
+	case r.URL.Path == "/api/index":
+		type record struct {
+			Title    string    `json:"title"`
+			File     string    `json:"file"`
+			Modified time.Time `json:"modified"`
+			Size     int64     `json:"size"`
+			Words    int       `json:"words"`
+		}
+		index := h.dirIndex(nil, "")
+		out := make([]record, 0, len(index))
+		for _, rec := range index {
+			out = append(out, record{
+				Title:    rec.Title,
+				File:     rec.File,
+				Modified: rec.ModTime.UTC(),
+				Size:     rec.Size,
+				Words:    rec.Words,
+			})
+		}
+		writeJSON(w, out)
+	case strings.HasPrefix(r.URL.Path, "/api/doc/"):
+		p := path.Clean(strings.TrimPrefix(r.URL.Path, "/api/doc"))
+		b, _, ok := h.readAPIDocument(w, r, p)
+		if !ok {
+			return
+		}
+		doc := h.render(b)
+		title := doc.Title
+		if title == "" {
+			title = nameToTitle(path.Base(p))
+		}
+		writeJSON(w, struct {
+			Title    string             `json:"title"`
+			Headings []mdrender.Heading `json:"headings"`
+			Links    []string           `json:"links"`
+			HTML     string             `json:"html"`
+		}{
+			Title:    title,
+			Headings: mdrender.Headings(doc.AST),
+			Links:    mdrender.Links(doc.AST),
+			HTML:     string(doc.HTML),
+		})
+	case strings.HasPrefix(r.URL.Path, "/api/outline/"):
+		p := path.Clean(strings.TrimPrefix(r.URL.Path, "/api/outline"))
+		b, _, ok := h.readAPIDocument(w, r, p)
+		if !ok {
+			return
+		}
+		doc := mdrender.Parse(b, h.renderOptions())
+		title := doc.Title
+		if title == "" {
+			title = nameToTitle(path.Base(p))
+		}
+		writeJSON(w, struct {
+			Title   string        `json:"title"`
+			Outline []outlineItem `json:"outline"`
+		}{
+			Title:   title,
+			Outline: outlineTree(mdrender.Headings(doc.AST)),
+		})
+	case r.URL.Path == "/api/preview":
+		p := path.Clean("/" + r.URL.Query().Get("path"))
+		b, _, ok := h.readAPIDocument(w, r, p)
+		if !ok {
+			return
+		}
+		doc := h.render(b)
+		title := doc.Title
+		if title == "" {
+			title = nameToTitle(path.Base(p))
+		}
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		writeJSON(w, struct {
+			Title string `json:"title"`
+			HTML  string `json:"html"`
+		}{
+			Title: title,
+			HTML:  firstParagraph(doc.HTML),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// readAPIDocument reads document with URL path p for API request. If p is
+// not a document path, or document can't be read, it responds with error
+// status and returns false. Otherwise response gets Last-Modified header of
+// document.
+func (h *Handler) readAPIDocument(w http.ResponseWriter, r *http.Request, p string) ([]byte, fs.FileInfo, bool) {
+	if containsDotDot(p) || !h.isDocument(p) {
+		http.Error(w, "invalid document path", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	fi, err := fs.Stat(h.fsys, fsPath(p))
+	var b []byte
+	if err == nil {
+		b, err = h.readDocument(fsPath(p))
+	}
+	switch {
+	case err == nil:
+		w.Header().Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+		return b, fi, true
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	case errors.Is(err, errTooLarge):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		log.Printf("read %q: %v", p, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+	return nil, nil, false
+}
+
+// serveHealth handles /healthz requests, reporting number of served documents
+// and server uptime. It responds with 503 status if documents can't be read.
+func (h *Handler) serveHealth(w http.ResponseWriter, r *http.Request) {
+	var out struct {
+		Status    string `json:"status"`
+		Documents int    `json:"documents"`
+		Uptime    string `json:"uptime,omitempty"`
+	}
+	err := fs.WalkDir(h.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != "." && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		if d.Type().IsRegular() && h.isDocument(p) {
+			out.Documents++
+		}
+		return nil
+	})
+	if !h.started.IsZero() {
+		out.Uptime = time.Since(h.started).Round(time.Second).String()
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		log.Printf("health check: %v", err)
+		out.Status = "error"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	out.Status = "ok"
+	writeJSON(w, out)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Printf("json encode: %v", err)
+	}
+}
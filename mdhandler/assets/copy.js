@@ -0,0 +1,42 @@
+// Adds "copy" button to every code block of the document, copying its text
+// to clipboard. Clipboard API is only available in secure contexts, so on
+// plain http served to other hosts selected text is copied with execCommand.
+document.addEventListener('DOMContentLoaded', function() {
+	function copy(text) {
+		if (navigator.clipboard && window.isSecureContext) {
+			return navigator.clipboard.writeText(text);
+		}
+		var area = document.createElement('textarea');
+		area.value = text;
+		area.style.position = 'fixed';
+		area.style.opacity = '0';
+		document.body.appendChild(area);
+		area.select();
+		var ok = document.execCommand('copy');
+		area.remove();
+		return ok ? Promise.resolve() : Promise.reject();
+	}
+	document.querySelectorAll('article pre > code').forEach(function(code) {
+		var pre = code.parentNode;
+		var wrapper = document.createElement('div');
+		wrapper.className = 'code-block';
+		pre.parentNode.insertBefore(wrapper, pre);
+		wrapper.appendChild(pre);
+		var button = document.createElement('button');
+		button.type = 'button';
+		button.className = 'copy';
+		button.textContent = 'copy';
+		button.title = 'Copy to clipboard';
+		button.addEventListener('click', function() {
+			var text = code.cloneNode(true);
+			text.querySelectorAll('span.lineno').forEach(function(num) { num.remove() });
+			copy(text.textContent.replace(/\n$/, '')).then(function() {
+				button.textContent = 'copied';
+			}, function() {
+				button.textContent = 'failed';
+			});
+			setTimeout(function() { button.textContent = 'copy' }, 1500);
+		});
+		wrapper.appendChild(button);
+	});
+});
@@ -0,0 +1,54 @@
+// Live preview and draft autosave for mdserver edit mode. Preview is
+// re-rendered on the server shortly after the user stops typing; text is
+// saved to localStorage, so it survives accidental tab close, and offered for
+// restore next time editor is opened.
+document.addEventListener('DOMContentLoaded', function() {
+	var form = document.getElementById('editor');
+	if (!form) { return };
+	var text = form.querySelector('textarea[name=text]');
+	var preview = document.getElementById('preview');
+	var key = 'mdserver-draft:' + location.pathname;
+	var timer = null;
+	var render = function() {
+		fetch('?preview', {method: 'POST', body: text.value, credentials: 'same-origin'})
+			.then(function(resp) { return resp.ok ? resp.text() : Promise.reject(resp.status) })
+			.then(function(html) { preview.innerHTML = html })
+			.catch(function(err) { console.log('preview failed:', err) });
+	};
+	text.addEventListener('input', function() {
+		clearTimeout(timer);
+		timer = setTimeout(function() {
+			try {
+				localStorage.setItem(key, JSON.stringify({text: text.value, version: form.dataset.version, saved: Date.now()}));
+			} catch (e) {}
+			render();
+		}, 300);
+	});
+	form.addEventListener('submit', function() {
+		try { localStorage.removeItem(key) } catch (e) {}
+	});
+	var draft = null;
+	try { draft = JSON.parse(localStorage.getItem(key)) } catch (e) {}
+	if (!draft || draft.text === text.value) { return };
+	var notice = document.createElement('p');
+	notice.id = 'draft';
+	notice.textContent = 'There is an unsaved draft of this document from ' + new Date(draft.saved).toLocaleString() +
+		(draft.version !== form.dataset.version ? ', made before the document was last changed on disk. ' : '. ');
+	var restore = document.createElement('button');
+	restore.type = 'button';
+	restore.textContent = 'Restore draft';
+	restore.addEventListener('click', function() {
+		text.value = draft.text;
+		notice.remove();
+		render();
+	});
+	var discard = document.createElement('button');
+	discard.type = 'button';
+	discard.textContent = 'Discard';
+	discard.addEventListener('click', function() {
+		try { localStorage.removeItem(key) } catch (e) {}
+		notice.remove();
+	});
+	notice.append(restore, ' ', discard);
+	form.parentNode.insertBefore(notice, form);
+});
@@ -0,0 +1,16 @@
+// Narrows down the list of documents on index page as user types into the
+// filter box, matching titles and file names. Submitting the form filters the
+// whole index on the server, across all pages.
+document.addEventListener('DOMContentLoaded', function() {
+	var input = document.querySelector('form#filter input[name=filter]');
+	if (!input) { return };
+	var items = [].slice.call(document.querySelectorAll('body > ul > li'));
+	input.addEventListener('input', function() {
+		var s = input.value.trim().toLowerCase();
+		items.forEach(function(li) {
+			var link = li.querySelector('a');
+			var text = (link.textContent + ' ' + link.getAttribute('href')).toLowerCase();
+			li.hidden = s !== '' && text.indexOf(s) < 0;
+		});
+	});
+});
@@ -0,0 +1,24 @@
+// Highlights code blocks with language set. Blocks rendered line by line,
+// with line numbers or highlighted lines, are highlighted one line at a time
+// carrying parser state over, so line elements are kept.
+document.addEventListener('DOMContentLoaded', (event) => {
+	document.querySelectorAll('pre code[class^="language-"]').forEach((block) => {
+		var lines = block.querySelectorAll('span.line');
+		if (lines.length === 0) {
+			hljs.highlightBlock(block);
+			return;
+		}
+		var lang = block.className.replace(/^language-/, '');
+		if (!hljs.getLanguage(lang)) { return }
+		block.classList.add('hljs');
+		var top;
+		lines.forEach((line) => {
+			var num = line.querySelector('span.lineno');
+			if (num) { num.remove() }
+			var res = hljs.highlight(lang, line.textContent, true, top);
+			top = res.top;
+			line.innerHTML = res.value;
+			if (num) { line.insertBefore(num, line.firstChild) }
+		});
+	});
+});
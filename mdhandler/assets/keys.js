@@ -0,0 +1,113 @@
+// Keyboard shortcuts: "/" focuses search box or opens palette, "[" and "]"
+// follow links to previous and next pages, Ctrl+K (Cmd+K) opens palette
+// finding documents by title. Document list is fetched from /api/index, which
+// is located relative to this script, so server may be mounted under a path
+// prefix.
+(function() {
+	var root = new URL('..', document.currentScript.src);
+	var docs, palette;
+
+	// score returns how well query matches s as a subsequence, or -1 if it
+	// doesn't; consecutive and word-starting matches score higher
+	function score(query, s) {
+		s = s.toLowerCase();
+		var total = 0, run = 0, j = 0;
+		for (var i = 0; i < query.length; i++) {
+			var k = s.indexOf(query[i], j);
+			if (k < 0) { return -1 }
+			run = k === j ? run + 1 : 1;
+			total += run + (k === 0 || /[\s\/_.-]/.test(s[k - 1]) ? 2 : 0);
+			j = k + 1;
+		}
+		return total - s.length / 100;
+	}
+
+	function openPalette() {
+		if (palette) { return }
+		palette = document.createElement('div');
+		palette.id = 'palette';
+		var input = document.createElement('input');
+		input.type = 'search';
+		input.placeholder = 'Go to document';
+		var list = document.createElement('ul');
+		palette.appendChild(input);
+		palette.appendChild(list);
+		document.body.appendChild(palette);
+		var selected = 0, found = [];
+		function render() {
+			var q = input.value.trim().toLowerCase();
+			found = (docs || []).map(function(d) {
+				return {doc: d, score: Math.max(score(q, d.title), score(q, d.file) - 1)};
+			}).filter(function(r) { return r.score >= 0 }).sort(function(a, b) {
+				return b.score - a.score;
+			}).slice(0, 20);
+			selected = Math.min(selected, Math.max(found.length - 1, 0));
+			list.textContent = '';
+			found.forEach(function(r, i) {
+				var li = document.createElement('li');
+				var a = document.createElement('a');
+				a.href = new URL(r.doc.file, root).href;
+				a.textContent = r.doc.title;
+				var small = document.createElement('small');
+				small.textContent = ' ' + r.doc.file;
+				li.appendChild(a);
+				li.appendChild(small);
+				if (i === selected) { li.className = 'selected'; li.scrollIntoView({block: 'nearest'}) }
+				list.appendChild(li);
+			});
+		}
+		input.addEventListener('input', function() { selected = 0; render() });
+		input.addEventListener('keydown', function(e) {
+			switch (e.key) {
+			case 'ArrowDown': selected = Math.min(selected + 1, found.length - 1); render(); break;
+			case 'ArrowUp': selected = Math.max(selected - 1, 0); render(); break;
+			case 'Enter':
+				if (found[selected]) { location.href = new URL(found[selected].doc.file, root).href }
+				break;
+			case 'Escape': closePalette(); break;
+			default: return;
+			}
+			e.preventDefault();
+		});
+		input.addEventListener('blur', function() { setTimeout(closePalette, 200) });
+		input.focus();
+		if (docs) {
+			render();
+			return;
+		}
+		fetch(root.href + 'api/index').then(function(resp) { return resp.json() }).then(function(index) {
+			docs = index;
+			if (palette) { render() }
+		}).catch(function() {});
+	}
+
+	function closePalette() {
+		if (palette) { palette.remove(); palette = null }
+	}
+
+	document.addEventListener('keydown', function(e) {
+		if ((e.ctrlKey || e.metaKey) && e.key === 'k') {
+			e.preventDefault();
+			openPalette();
+			return;
+		}
+		var t = e.target;
+		if (e.ctrlKey || e.metaKey || e.altKey || t.isContentEditable || /^(INPUT|TEXTAREA|SELECT)$/.test(t.tagName)) {
+			return;
+		}
+		var link;
+		switch (e.key) {
+		case '/':
+			e.preventDefault();
+			var search = document.querySelector('input[type=search]');
+			if (search) { search.focus() } else { openPalette() }
+			break;
+		case '[':
+			if ((link = document.querySelector('a[rel=prev]'))) { link.click() }
+			break;
+		case ']':
+			if ((link = document.querySelector('a[rel=next]'))) { link.click() }
+			break;
+		}
+	});
+})();
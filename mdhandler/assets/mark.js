@@ -0,0 +1,44 @@
+// Highlights occurrences of search query given as "q" URL parameter in the
+// document, and scrolls to the first one. Like server-side search, matching
+// ignores case and diacritics.
+document.addEventListener('DOMContentLoaded', function() {
+	var q = new URLSearchParams(location.search).get('q');
+	var article = document.querySelector('article');
+	if (!q || !article) { return }
+	// fold returns lowercased s without diacritics, and offsets of its
+	// characters in s
+	function fold(s) {
+		var out = '', offsets = [];
+		for (var i = 0; i < s.length; i++) {
+			var c = s[i].normalize('NFD').replace(/[\u0300-\u036f]/g, '').toLowerCase();
+			for (var j = 0; j < c.length; j++) { offsets.push(i) }
+			out += c;
+		}
+		offsets.push(s.length);
+		return {text: out, offsets: offsets};
+	}
+	var query = fold(q.trim()).text;
+	if (!query) { return }
+	var walker = document.createTreeWalker(article, NodeFilter.SHOW_TEXT);
+	var nodes = [];
+	while (walker.nextNode()) { nodes.push(walker.currentNode) }
+	var first;
+	nodes.forEach(function(node) {
+		var f = fold(node.data);
+		var matches = [];
+		for (var i = f.text.indexOf(query); i >= 0; i = f.text.indexOf(query, i + query.length)) {
+			matches.push([f.offsets[i], f.offsets[i + query.length]]);
+		}
+		// wrap matches from the end, so offsets of earlier ones stay valid
+		for (var k = matches.length - 1; k >= 0; k--) {
+			var m = node.splitText(matches[k][0]);
+			m.splitText(matches[k][1] - matches[k][0]);
+			var mark = document.createElement('mark');
+			mark.className = 'search';
+			m.parentNode.replaceChild(mark, m);
+			mark.appendChild(m);
+			if (k === 0 && !first) { first = mark }
+		}
+	});
+	if (first && !location.hash) { first.scrollIntoView({block: 'center'}) }
+});
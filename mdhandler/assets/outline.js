@@ -0,0 +1,27 @@
+// Highlights section being read in "On this page" outline: link to the last
+// heading scrolled past the top of the window gets "current" class.
+document.addEventListener('DOMContentLoaded', function() {
+	var links = [].slice.call(document.querySelectorAll('nav#outline a[href^="#"]'));
+	var headings = links.map(function(a) {
+		return document.getElementById(decodeURIComponent(a.getAttribute('href').slice(1)));
+	});
+	var current, pending;
+	function update() {
+		pending = false;
+		var found;
+		for (var i = 0; i < headings.length; i++) {
+			if (headings[i] && headings[i].getBoundingClientRect().top <= 100) found = links[i];
+		}
+		if (found === current) return;
+		if (current) current.classList.remove('current');
+		if (found) found.classList.add('current');
+		current = found;
+	}
+	window.addEventListener('scroll', function() {
+		if (!pending) {
+			pending = true;
+			requestAnimationFrame(update);
+		}
+	}, {passive: true});
+	update();
+});
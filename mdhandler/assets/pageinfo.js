@@ -0,0 +1,20 @@
+// Shows modification time in page footer relative to now, like "3 days ago",
+// keeping exact time in tooltip. Server renders exact time, as browsers may
+// keep the page for long.
+document.addEventListener('DOMContentLoaded', function() {
+	var el = document.querySelector('footer#page-info time[datetime]');
+	if (!el || !window.Intl || !Intl.RelativeTimeFormat) return;
+	var when = new Date(el.getAttribute('datetime'));
+	if (isNaN(when)) return;
+	var seconds = (when - Date.now()) / 1000;
+	var units = [['year', 365*24*3600], ['month', 30*24*3600], ['week', 7*24*3600],
+		['day', 24*3600], ['hour', 3600], ['minute', 60], ['second', 1]];
+	for (var i = 0; i < units.length; i++) {
+		if (Math.abs(seconds) >= units[i][1] || units[i][0] === 'second') {
+			var rtf = new Intl.RelativeTimeFormat(undefined, {numeric: 'auto'});
+			el.title = when.toLocaleString();
+			el.textContent = rtf.format(Math.round(seconds / units[i][1]), units[i][0]);
+			return;
+		}
+	}
+});
@@ -0,0 +1,55 @@
+// Shows popover with title and the first paragraph of a local document when
+// pointer rests on a link to it. Previews are fetched from /api/preview,
+// which is located relative to this script, so server may be mounted under
+// a path prefix.
+(function() {
+	var root = new URL('..', document.currentScript.src);
+	var cache = {};
+	var popover, timer;
+	function hide() {
+		clearTimeout(timer);
+		if (popover) { popover.remove(); popover = null }
+	}
+	function show(link, data) {
+		hide();
+		popover = document.createElement('div');
+		popover.id = 'link-preview';
+		var title = document.createElement('strong');
+		title.textContent = data.title;
+		popover.appendChild(title);
+		var body = document.createElement('div');
+		body.innerHTML = data.html; // sanitized by server
+		popover.appendChild(body);
+		document.body.appendChild(popover);
+		var rect = link.getBoundingClientRect();
+		popover.style.left = Math.max(0, Math.min(rect.left + window.scrollX,
+			window.scrollX + document.documentElement.clientWidth - popover.offsetWidth - 8)) + 'px';
+		popover.style.top = (rect.bottom + window.scrollY + 4) + 'px';
+	}
+	function preview(link) {
+		var u = new URL(link.href);
+		if (u.origin !== root.origin || u.search || !u.pathname.startsWith(root.pathname) ||
+			(u.pathname === location.pathname && u.hash)) { return }
+		var p = '/' + decodeURIComponent(u.pathname.slice(root.pathname.length));
+		if (p in cache) {
+			if (cache[p]) { show(link, cache[p]) }
+			return;
+		}
+		fetch(root.href + 'api/preview?path=' + encodeURIComponent(p)).then(function(resp) {
+			return resp.ok ? resp.json() : null;
+		}).then(function(data) {
+			cache[p] = data && data.html ? data : null;
+			if (cache[p] && link.matches(':hover')) { show(link, cache[p]) }
+		}).catch(function() {});
+	}
+	document.addEventListener('DOMContentLoaded', function() {
+		document.querySelectorAll('article a[href]').forEach(function(link) {
+			link.addEventListener('mouseenter', function() {
+				clearTimeout(timer);
+				timer = setTimeout(function() { preview(link) }, 400);
+			});
+			link.addEventListener('mouseleave', hide);
+			link.addEventListener('focusout', hide);
+		});
+	});
+})();
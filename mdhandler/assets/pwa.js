@@ -0,0 +1,12 @@
+// Registers service worker keeping visited pages for offline reading, and
+// links web app manifest. Both are located relative to this script, so server
+// may be mounted under a path prefix.
+(function() {
+	if (!('serviceWorker' in navigator)) { return }
+	var root = new URL('..', document.currentScript.src);
+	var link = document.createElement('link');
+	link.rel = 'manifest';
+	link.href = new URL('manifest.json', document.currentScript.src);
+	document.head.appendChild(link);
+	navigator.serviceWorker.register(new URL('sw.js', document.currentScript.src), {scope: root.pathname}).catch(function() {});
+})();
@@ -0,0 +1,11 @@
+// Reloads page when it changes on server: polls it with HEAD requests,
+// asking to respond with 304 status unless page was modified since it was
+// loaded.
+(function() {
+	var since = new Date(document.lastModified).toUTCString();
+	setInterval(function() {
+		fetch(location.href, {method: 'HEAD', cache: 'no-store', headers: {'If-Modified-Since': since}}).then(function(resp) {
+			if (resp.status === 200) { location.reload() }
+		}).catch(function() {});
+	}, 1000);
+})();
@@ -0,0 +1,28 @@
+// Sorts rows of tables with "sortable" class by column which header is
+// clicked; clicking it again reverses the order. Cells holding numbers are
+// compared as numbers.
+document.addEventListener('DOMContentLoaded', function() {
+	document.querySelectorAll('table.sortable').forEach(function(table) {
+		var body = table.tBodies[0];
+		var headers = [].slice.call(table.querySelectorAll('thead th'));
+		headers.forEach(function(th, col) {
+			th.addEventListener('click', function() {
+				var asc = th.getAttribute('aria-sort') !== 'ascending';
+				headers.forEach(function(h) { h.removeAttribute('aria-sort') });
+				th.setAttribute('aria-sort', asc ? 'ascending' : 'descending');
+				var text = function(row) { return row.cells[col] ? row.cells[col].textContent.trim() : '' };
+				var rows = [].slice.call(body.rows);
+				rows.sort(function(a, b) {
+					var x = text(a), y = text(b), c;
+					if (x !== '' && y !== '' && isFinite(x) && isFinite(y)) {
+						c = parseFloat(x) - parseFloat(y);
+					} else {
+						c = x.localeCompare(y, undefined, {numeric: true});
+					}
+					return asc ? c : -c;
+				});
+				rows.forEach(function(row) { body.appendChild(row) });
+			});
+		});
+	});
+});
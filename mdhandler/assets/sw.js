@@ -0,0 +1,55 @@
+// Service worker keeping pages and assets for offline reading. Every request
+// goes to the server first, revalidating cached copy with If-Modified-Since
+// header taken from its Last-Modified; cached copy is used if server responds
+// with 304 status or can't be reached. The index is cached on install, so
+// there's a way to navigate even before pages were visited.
+var cacheName = 'mdserver-v1';
+var scope = new URL(self.registration.scope);
+
+self.addEventListener('install', function(event) {
+	event.waitUntil(caches.open(cacheName).then(function(cache) {
+		return cache.add(new URL('?index', scope).href);
+	}).then(function() { return self.skipWaiting() }));
+});
+
+self.addEventListener('activate', function(event) {
+	event.waitUntil(caches.keys().then(function(keys) {
+		return Promise.all(keys.filter(function(key) { return key !== cacheName }).map(function(key) { return caches.delete(key) }));
+	}).then(function() { return self.clients.claim() }));
+});
+
+// cacheable reports whether request url is for a page or an asset worth
+// keeping: search, API and download responses aren't.
+function cacheable(url) {
+	if (url.origin !== scope.origin || url.pathname.indexOf(scope.pathname) !== 0) { return false }
+	var rest = url.pathname.slice(scope.pathname.length);
+	if (rest.indexOf('api/') === 0 || rest.indexOf('dav/') === 0) { return false }
+	return !/(^|&)(q|download|edit|preview)(=|&|$)/.test(url.search.slice(1));
+}
+
+self.addEventListener('fetch', function(event) {
+	var req = event.request;
+	var url = new URL(req.url);
+	if (req.method !== 'GET' || req.headers.has('Range') || !cacheable(url)) { return }
+	url.hash = '';
+	event.respondWith(caches.open(cacheName).then(function(cache) {
+		return cache.match(url.href).then(function(cached) {
+			var init = {credentials: 'same-origin', cache: 'no-store', headers: {}};
+			var mtime = cached && cached.headers.get('Last-Modified');
+			if (mtime) { init.headers['If-Modified-Since'] = mtime }
+			return fetch(url.href, init).then(function(resp) {
+				if (resp.status === 304 && cached) { return cached }
+				if (resp.ok && !/no-store/.test(resp.headers.get('Cache-Control') || '')) {
+					cache.put(url.href, resp.clone());
+				}
+				return resp;
+			}, function(err) {
+				if (cached) { return cached }
+				if (req.mode === 'navigate') {
+					return cache.match(new URL('?index', scope).href).then(function(index) { return index || Promise.reject(err) });
+				}
+				return Promise.reject(err);
+			});
+		});
+	}));
+});
@@ -0,0 +1,25 @@
+// Table of contents generating code, modified version of
+// https://github.com/matthewkastor/html-table-of-contents licensed under
+// GNU GENERAL PUBLIC LICENSE Version 3.
+document.addEventListener('DOMContentLoaded', function() {
+	htmlTableOfContents();
+} );
+function htmlTableOfContents( documentRef ) {
+	var documentRef = documentRef || document;
+	var headings = [].slice.call(documentRef.body.querySelectorAll('article h1, article h2, article h3, article h4, article h5, article h6'));
+	if (headings.length < 2) { return };
+	var toc = documentRef.querySelector("nav#toc details");
+	if (!toc) { return };
+	var ul = documentRef.createElement( "ul" );
+	headings.forEach(function (heading, index) {
+		var ref = heading.getAttribute( "id" );
+		var link = documentRef.createElement( "a" );
+		link.setAttribute( "href", "#"+ ref );
+		link.textContent = heading.textContent.replace(/\u00b6$/, "");
+		var li = documentRef.createElement( "li" );
+		li.setAttribute( "class", heading.tagName.toLowerCase() );
+		li.appendChild( link );
+		ul.appendChild( li );
+	});
+	toc.appendChild( ul );
+}
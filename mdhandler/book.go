@@ -0,0 +1,139 @@
+package mdhandler
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/artyom/mdserver/mdrender"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// serveBook renders all documents in reading order as a single page. Each
+// document becomes a section with its own id, heading ids are prefixed with
+// it, and links between documents are rewritten to point to these sections.
+func (h *Handler) serveBook(w http.ResponseWriter, r *http.Request) {
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	order := h.readingOrder()
+	ids := make(map[string]string, len(order))
+	for i, link := range order {
+		ids[link.File] = fmt.Sprintf("d%d", i+1)
+	}
+	var body bytes.Buffer
+	var mtime time.Time
+	for _, link := range order {
+		b, err := h.readDocument(link.File)
+		if err != nil {
+			log.Printf("read %q: %v", link.File, err)
+			continue
+		}
+		if fi, err := fs.Stat(h.fsys, link.File); err == nil && fi.ModTime().After(mtime) {
+			mtime = fi.ModTime()
+		}
+		id := ids[link.File]
+		opts := h.renderOptions()
+		var withTitle bool
+		opts.Transform = func(doc ast.Node) {
+			withTitle = h.bookLinks(link.File, ids)(doc)
+		}
+		doc := mdrender.Render(b, opts)
+		fmt.Fprintf(&body, "<section id=\"%s\">\n", id)
+		if !withTitle {
+			title := doc.Title
+			if title == "" {
+				title = nameToTitle(path.Base(link.File))
+			}
+			fmt.Fprintf(&body, "<h1 id=\"%s:title\">%s</h1>\n", id, template.HTMLEscapeString(title))
+		}
+		body.Write(doc.HTML)
+		body.WriteString("</section>\n")
+	}
+	page := pageData{
+		pageHead:  h.pageHead("All documents"),
+		IndexHref: h.base + "/?index",
+		Body:      template.HTML(body.String()),
+		WithHL:    h.hljs && bytes.Contains(body.Bytes(), []byte(`<pre><code class=`)),
+		CustomJS:  h.customJS,
+	}
+	th := h.theme()
+	if th.styleTime.After(mtime) {
+		mtime = th.styleTime
+	}
+	var buf bytes.Buffer
+	if err := th.template(pageTemplate).Execute(&buf, page); err != nil {
+		h.serverError(w, r, fmt.Errorf("book: %w", err))
+		return
+	}
+	h.setCSP(w, page.WithHL)
+	h.preload(w)
+	http.ServeContent(w, r, "page.html", mtime, bytes.NewReader(buf.Bytes()))
+}
+
+// bookLinks returns function rewriting AST of document file for the single
+// page view: ids of its headings and footnotes are prefixed with the section
+// id of document, links to documents that have sections (ids maps their
+// names to section ids) become fragment links, and other local links become
+// root-relative. Returned function reports whether document has h1 heading.
+func (h *Handler) bookLinks(file string, ids map[string]string) func(ast.Node) bool {
+	id := ids[file]
+	return func(doc ast.Node) bool {
+		var withTitle bool
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			if !entering {
+				return ast.GoToNext
+			}
+			switch n := node.(type) {
+			case *ast.Heading:
+				withTitle = withTitle || n.Level == 1
+				if n.HeadingID != "" {
+					n.HeadingID = id + ":" + n.HeadingID
+				}
+			case *ast.ListItem:
+				if n.RefLink != nil {
+					n.RefLink = append([]byte(id+"-"), n.RefLink...)
+				}
+			case *ast.Link:
+				if n.NoteID != 0 {
+					n.Destination = append([]byte(id+"-"), n.Destination...)
+					return ast.GoToNext
+				}
+				if frag := string(n.Destination); len(frag) > 1 && frag[0] == '#' {
+					n.Destination = []byte("#" + id + ":" + frag[1:])
+					return ast.GoToNext
+				}
+				target, fragment, ok := h.localLink(file, string(n.Destination))
+				if !ok {
+					return ast.GoToNext
+				}
+				switch sid, ok := ids[target]; {
+				case ok && fragment != "":
+					if !strings.HasPrefix(fragment, h.idPrefix) {
+						fragment = h.idPrefix + fragment
+					}
+					n.Destination = []byte("#" + sid + ":" + fragment)
+				case ok:
+					n.Destination = []byte("#" + sid)
+				default:
+					n.Destination = []byte(h.docHref(file, target, fragment, false))
+				}
+			case *ast.Image:
+				if target, ok := resolveLink(file, string(n.Destination)); ok {
+					n.Destination = []byte((&url.URL{Path: h.fileHref(file, target, false)}).String())
+				}
+			}
+			return ast.GoToNext
+		})
+		return withTitle
+	}
+}
@@ -0,0 +1,65 @@
+package mdhandler
+
+import (
+	"bytes"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// linkTargets caches existence of local link targets checked by
+// Options.CheckLinks. Cache is dropped every few seconds, so links to files
+// created or removed meanwhile are soon shown right.
+type linkTargets struct {
+	mu      sync.Mutex
+	created time.Time
+	found   map[string]bool
+}
+
+// linkTargetsTTL is how long linkTargets keeps results
+const linkTargetsTTL = 5 * time.Second
+
+// exists reports whether file or directory name exists in fsys.
+func (c *linkTargets) exists(fsys fs.FS, name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.found == nil || time.Since(c.created) > linkTargetsTTL {
+		c.found = make(map[string]bool)
+		c.created = time.Now()
+	}
+	ok, seen := c.found[name]
+	if !seen {
+		_, err := fs.Stat(fsys, name)
+		ok = err == nil
+		c.found[name] = ok
+	}
+	return ok
+}
+
+// brokenLinks returns mdrender.Options.Transform function marking local links
+// of document file to missing files with "broken" class and a tooltip, then
+// calling next, if it's not nil. Links are checked before next is called, as
+// it may rewrite them.
+func (h *Handler) brokenLinks(file string, next func(ast.Node)) func(ast.Node) {
+	return func(doc ast.Node) {
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			link, ok := node.(*ast.Link)
+			if !ok || !entering || link.NoteID != 0 || len(link.AdditionalAttributes) != 0 ||
+				bytes.HasPrefix(link.Destination, []byte("#")) {
+				return ast.GoToNext
+			}
+			target, _, ok := h.localLink(file, string(link.Destination))
+			if !ok || strings.HasPrefix(target, "_assets/") || h.targets.exists(h.fsys, target) {
+				return ast.GoToNext
+			}
+			link.AdditionalAttributes = []string{`class="broken"`, `title="Link target does not exist"`}
+			return ast.GoToNext
+		})
+		if next != nil {
+			next(doc)
+		}
+	}
+}
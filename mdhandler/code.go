@@ -0,0 +1,107 @@
+package mdhandler
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeLanguages maps extensions of text and source files rendered with
+// Options.RenderCode to highlight.js language names.
+var codeLanguages = map[string]string{
+	".txt":  "plaintext",
+	".log":  "plaintext",
+	".go":   "go",
+	".sh":   "bash",
+	".bash": "bash",
+	".zsh":  "bash",
+	".py":   "python",
+	".rb":   "ruby",
+	".pl":   "perl",
+	".js":   "javascript",
+	".ts":   "typescript",
+	".java": "java",
+	".kt":   "kotlin",
+	".rs":   "rust",
+	".c":    "c",
+	".h":    "c",
+	".cc":   "cpp",
+	".cpp":  "cpp",
+	".cs":   "cs",
+	".sql":  "sql",
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "ini",
+	".ini":  "ini",
+	".conf": "nginx",
+	".xml":  "xml",
+	".css":  "css",
+	".diff": "diff",
+	".mod":  "go",
+	".tf":   "hcl",
+}
+
+// codeNames maps names of source files without extensions to highlight.js
+// language names.
+var codeNames = map[string]string{
+	"Makefile":   "makefile",
+	"Dockerfile": "dockerfile",
+}
+
+// codeLanguage returns highlight.js language name for file p, if it's a
+// source file rendered with Options.RenderCode.
+func codeLanguage(p string) (string, bool) {
+	if lang, ok := codeNames[path.Base(p)]; ok {
+		return lang, true
+	}
+	lang, ok := codeLanguages[strings.ToLower(path.Ext(p))]
+	return lang, ok
+}
+
+// serveCode renders source file with URL path p as html page with line
+// numbers, highlighted as lang. It reports whether page was served: files
+// which are not valid UTF-8 text, or are larger than Options.MaxSize, are not
+// rendered and should be served as is.
+func (h *Handler) serveCode(w http.ResponseWriter, r *http.Request, p, lang string) bool {
+	file := fsPath(p)
+	fi, err := fs.Stat(h.fsys, file)
+	if err != nil || !fi.Mode().IsRegular() || h.checkSize(fi) != nil {
+		return false
+	}
+	b, err := fs.ReadFile(h.fsys, file)
+	if err != nil || !utf8.Valid(b) || bytes.IndexByte(b, 0) >= 0 {
+		return false
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return true
+	}
+	defer release()
+	lines := bytes.Count(b, []byte("\n"))
+	if len(b) != 0 && b[len(b)-1] != '\n' {
+		lines++
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<h1>%s</h1>\n<p class=\"source-meta\">%d lines · <a href=\"?raw\">raw</a></p>\n",
+		template.HTMLEscapeString(path.Base(file)), lines)
+	body.WriteString(`<div class="source"><pre class="linenos">`)
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&body, "<a id=\"L%d\" href=\"#L%[1]d\">%[1]d</a>\n", i)
+	}
+	fmt.Fprintf(&body, "</pre><pre><code class=\"language-%s\">", lang)
+	template.HTMLEscape(&body, b)
+	body.WriteString("</code></pre></div>\n")
+	page := pageData{
+		pageHead: h.pageHead(file),
+		Body:     template.HTML(body.String()),
+		WithHL:   lang != "plaintext",
+	}
+	h.servePage(w, r, page, fi.ModTime())
+	return true
+}
@@ -0,0 +1,130 @@
+package mdhandler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/artyom/mdserver/mdrender"
+	"golang.org/x/net/html"
+)
+
+// convertTimeout limits how long external converter may run
+const convertTimeout = 30 * time.Second
+
+// converter returns command line of Options.Converters command converting
+// file to html, if there's one for file extension.
+func (h *Handler) converter(file string) ([]string, bool) {
+	args, ok := h.converters[strings.ToLower(path.Ext(file))]
+	return args, ok && len(args) != 0
+}
+
+// convert converts document file with external converter command args,
+// returning sanitized html.
+func (h *Handler) convert(file string, args []string) ([]byte, error) {
+	fi, err := fs.Stat(h.fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.checkSize(fi); err != nil {
+		return nil, err
+	}
+	src, err := fs.ReadFile(h.fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), convertTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if h.dir != "" {
+		cmd.Dir = filepath.Join(h.dir, filepath.FromSlash(path.Dir(file)))
+	}
+	var stderr bytes.Buffer
+	cmd.Stdin, cmd.Stderr = bytes.NewReader(src), &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return nil, fmt.Errorf("%s: %w: %s", args[0], err, s)
+		}
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+	return convertPolicy.SanitizeBytes(out), nil
+}
+
+var convertPolicy = mdrender.Policy()
+
+// serveConverted renders document file with URL path p converted by external
+// converter command args as html page.
+func (h *Handler) serveConverted(w http.ResponseWriter, r *http.Request, p string, args []string) {
+	file := fsPath(p)
+	fi, err := fs.Stat(h.fsys, file)
+	if err != nil {
+		h.notFound(w, r)
+		return
+	}
+	mtime := fi.ModTime()
+	if th := h.theme(); th.styleTime.After(mtime) {
+		mtime = th.styleTime
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !mtime.Truncate(time.Second).After(t) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	body, err := h.convert(file, args)
+	if err != nil {
+		log.Printf("convert %q: %v", file, err)
+		http.Error(w, "cannot convert document", http.StatusInternalServerError)
+		return
+	}
+	title, _ := htmlTitle(body)
+	if title == "" {
+		title = nameToTitle(path.Base(file))
+	}
+	page := pageData{
+		pageHead: h.pageHead(title),
+		Body:     template.HTML(body),
+		WithHL:   h.hljs && bytes.Contains(body, []byte(`<code class=`)),
+	}
+	h.servePage(w, r, page, mtime)
+}
+
+// htmlTitle returns text of the first h1 element of html b, and the number
+// of words in its text.
+func htmlTitle(b []byte) (title string, words int) {
+	z := html.NewTokenizer(bytes.NewReader(b))
+	var inTitle, done bool
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(title), words
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "h1" && !done {
+				inTitle = true
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "h1" && inTitle {
+				inTitle, done = false, true
+			}
+		case html.TextToken:
+			text := z.Text()
+			words += len(bytes.Fields(text))
+			if inTitle {
+				title += string(text)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package mdhandler
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// offlineIndex is the name of index page in site archive; it's distinct from
+// "index.html", so it doesn't clash with rendered "index.md" document.
+const offlineIndex = "_index.html"
+
+// serveDownload streams zip archive of the whole site. If kind is "src",
+// archive holds served files as is; if kind is "zip", markdown documents are
+// rendered to html pages linking to each other, and built-in assets and index
+// page are added, so archive can be browsed offline. If kind is "epub", EPUB
+// publication is streamed instead, see writeEPUB.
+func (h *Handler) serveDownload(w http.ResponseWriter, r *http.Request, kind string) {
+	var name string
+	switch kind {
+	case "zip":
+		name = "site.zip"
+	case "src":
+		name = "source.zip"
+	case "epub":
+		name = "book.epub"
+	default:
+		http.Error(w, "unsupported download kind, must be one of: zip, src, epub", http.StatusBadRequest)
+		return
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	ctype, write := "application/zip", func(zw *zip.Writer) error { return h.writeArchive(zw, kind == "zip") }
+	if kind == "epub" {
+		ctype, write = "application/epub+zip", h.writeEPUB
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	zw := zip.NewWriter(w)
+	if err := write(zw); err != nil {
+		log.Printf("download: %v", err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("download: %v", err)
+	}
+}
+
+// WriteDocument writes markdown document file, a path in served fs.FS, to w
+// as html page rendered the same way as for offline copy of the site: links
+// to other documents point to their .html files, and links to assets are
+// relative.
+func (h *Handler) WriteDocument(w io.Writer, file string) error {
+	if !h.isDocument(file) {
+		return fmt.Errorf("%s is not a markdown document", file)
+	}
+	l, _, err := h.readerForFile(file)
+	if err != nil {
+		return err
+	}
+	l.offline = true
+	_, err = io.Copy(w, l)
+	return err
+}
+
+// writeArchive writes files of the site to zw, rendering markdown documents
+// to html if render is true.
+func (h *Handler) writeArchive(zw *zip.Writer, render bool) error {
+	fn := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// per-directory stylesheets are linked from rendered pages
+		if d.IsDir() && p != "." && strings.HasPrefix(d.Name(), ".") &&
+			!(render && h.dirThemes && d.Name() == path.Dir(dirStyleFile)) {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// documents too large to render are added as is
+		if !render || !h.isDocument(p) || h.checkSize(info) != nil {
+			f, err := h.fsys.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return addToArchive(zw, p, info, f)
+		}
+		l, mtime, err := h.readerForFile(p)
+		if err != nil {
+			return err
+		}
+		l.offline = true
+		hdr := &zip.FileHeader{Name: h.trimExt(p) + ".html", Method: zip.Deflate, Modified: mtime}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, l)
+		return err
+	}
+	if err := fs.WalkDir(h.fsys, ".", fn); err != nil {
+		return err
+	}
+	if !render {
+		return nil
+	}
+	if assets := h.assetFS; assets != nil {
+		fn := func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			f, err := assets.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return addToArchive(zw, path.Join("_assets", p), info, f)
+		}
+		if err := fs.WalkDir(assets, ".", fn); err != nil {
+			return err
+		}
+	}
+	for name, file := range h.brand {
+		if err := addFileToArchive(zw, path.Join("_assets", name), file); err != nil {
+			return err
+		}
+	}
+	if h.styles != nil {
+		// pages link selected theme, archive keeps the default one
+		if _, err := zw.Create(path.Join("_assets", themeCSS)); err != nil {
+			return err
+		}
+	}
+	index := h.dirIndex(nil, "")
+	for i := range index {
+		if !h.isDocument(index[i].File) {
+			continue // converted document, added as is
+		}
+		index[i].File = h.trimExt(index[i].File) + ".html"
+		index[i].Tags = nil
+	}
+	fw, err := zw.Create(offlineIndex)
+	if err != nil {
+		return err
+	}
+	return h.writeIndex(fw, "Index", index, false, nil, "")
+}
+
+// addFileToArchive adds file from disk to archive as name
+func addFileToArchive(zw *zip.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return addToArchive(zw, name, info, f)
+}
+
+func addToArchive(zw *zip.Writer, name string, info fs.FileInfo, r io.Reader) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name, hdr.Method = name, zip.Deflate
+	if info.ModTime().IsZero() { // embedded files have no mtime
+		hdr.Modified = time.Now()
+	}
+	fw, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
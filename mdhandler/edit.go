@@ -0,0 +1,215 @@
+package mdhandler
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxDocumentSize limits size of documents accepted by edit and preview
+// handlers
+const maxDocumentSize = 10 << 20
+
+// serveEdit handles "?edit" requests for document with URL path p: GET
+// renders editor, POST saves submitted text to disk.
+func (h *Handler) serveEdit(w http.ResponseWriter, r *http.Request, p string) {
+	file := fsPath(p)
+	if !h.isDocument(file) {
+		http.Error(w, "only markdown documents can be edited", http.StatusBadRequest)
+		return
+	}
+	// keep edits away from .git and other hidden directories
+	for _, s := range strings.Split(file, "/") {
+		if strings.HasPrefix(s, ".") {
+			http.Error(w, "hidden files cannot be edited", http.StatusForbidden)
+			return
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxDocumentSize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		text := strings.ReplaceAll(r.PostForm.Get("text"), "\r\n", "\n")
+		// document must not change on disk since editor was loaded
+		if cur := h.fileVersion(file); r.PostForm.Get("version") != cur {
+			h.renderEditor(w, r, http.StatusConflict, file, []byte(text), cur, true)
+			return
+		}
+		if err := writeFileAtomic(filepath.Join(h.dir, filepath.FromSlash(file)), []byte(text)); err != nil {
+			log.Printf("save %q: %v", file, err)
+			http.Error(w, "cannot save document", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, (&url.URL{Path: h.base + "/" + file}).String(), http.StatusSeeOther)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	version := h.fileVersion(file)
+	b, err := fs.ReadFile(h.fsys, file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("read %q: %v", file, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	h.renderEditor(w, r, http.StatusOK, file, b, version, false)
+}
+
+// fileVersion returns opaque string changing whenever document file is
+// modified, or an empty string if file does not exist.
+func (h *Handler) fileVersion(file string) string {
+	st, err := fs.Stat(h.fsys, file)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(st.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(st.Size(), 36)
+}
+
+// renderEditor renders editor for document file with given text. Version is
+// the fileVersion value text is based on. If conflict is true, editor warns
+// that document was changed on disk while being edited.
+func (h *Handler) renderEditor(w http.ResponseWriter, r *http.Request, status int, file string, b []byte, version string, conflict bool) {
+	page := struct {
+		pageHead
+		CustomJS bool
+		File     string
+		Text     string
+		Version  string
+		Conflict bool
+		Preview  template.HTML
+	}{
+		pageHead: h.pageHead("Editing " + file),
+		File:     path.Base(file),
+		Text:     string(b),
+		Version:  version,
+		Conflict: conflict,
+		Preview:  template.HTML(h.render(b).HTML),
+		CustomJS: h.customJS,
+	}
+	th := h.theme()
+	h.setCSP(w, false)
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeTemplate(w, r, status, th.template(editTemplate), page)
+}
+
+// servePreview handles POST "?preview" requests, rendering request body as
+// markdown document and responding with its html.
+func (h *Handler) servePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+		return
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocumentSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(h.render(b).HTML)
+}
+
+// sameOrigin reports whether request comes from a page served by this
+// server, as reported by browser in Origin header.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// browsers always send Origin on cross-origin POST requests
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// writeFileAtomic writes data to file name via temporary file in the same
+// directory renamed over the original, so readers never see partially
+// written file. Permissions of existing file are preserved.
+func writeFileAtomic(name string, data []byte) error {
+	mode := os.FileMode(0666)
+	if st, err := os.Stat(name); err == nil {
+		mode = st.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+var editTemplate = template.Must(parseTemplate("edit", editTpl))
+
+const editTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{template "head" .}}
+<script src="{{.Root}}_assets/edit.js"></script>{{if .CustomJS}}
+<script src="{{.Root}}_assets/custom.js"></script>{{end}}
+</head><body id="mdserver-edit">
+<nav id="site">{{template "logo" .}}<a href="{{.File}}">document</a> <a href="{{.Root}}?index">index</a></nav>
+{{if .Conflict}}<p id="conflict">Document was changed on disk since you started editing it.
+Your text is below; compare it with the <a href="{{.File}}" target="_blank">current version</a>,
+then save again to overwrite it.</p>
+{{end}}<form id="editor" method="post" action="?edit" data-version="{{.Version}}">
+<input type="hidden" name="version" value="{{.Version}}">
+<textarea name="text" spellcheck="true" autofocus>
+{{.Text}}</textarea>
+<article id="preview">
+{{.Preview}}
+</article>
+<p><input type="submit" value="Save"> <a href="{{.File}}">Cancel</a></p>
+</form></body>
+`
+
+// editorHref returns Options.EditorURL for document file
+func (h *Handler) editorHref(file string) template.URL {
+	name, err := filepath.Abs(filepath.Join(h.dir, filepath.FromSlash(file)))
+	if err != nil {
+		return ""
+	}
+	p := filepath.ToSlash(name)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // windows path like C:/dir/file.md
+	}
+	return template.URL(strings.ReplaceAll(h.editorURL, "{path}", (&url.URL{Path: p}).EscapedPath()))
+}
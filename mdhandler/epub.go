@@ -0,0 +1,246 @@
+package mdhandler
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/artyom/mdserver/mdrender"
+	"github.com/gomarkdown/markdown/ast"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Names of files in EPUB archive holding package metadata, navigation
+// document and stylesheet. Chapters keep paths of their documents, so they are
+// prefixed to not clash with them.
+const (
+	epubPackage    = "_content.opf"
+	epubNavigation = "_nav.xhtml"
+	epubStyle      = "_assets/style.css"
+)
+
+// epubItem is a file of EPUB publication
+type epubItem struct {
+	ID    string
+	Href  string // url-escaped path relative to package document
+	Type  string // media type
+	Title string // title of a chapter, empty for other items
+}
+
+// writeEPUB writes EPUB 3 publication to zw: documents in reading order (see
+// readingOrder) become its chapters, along with local images they refer to
+// and the page stylesheet. Links between chapters are rewritten the same way
+// they are in the site archive.
+func (h *Handler) writeEPUB(zw *zip.Writer) error {
+	// mimetype must be the first file, stored without compression or data
+	// descriptor
+	const mimetype = "application/epub+zip"
+	fw, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(mimetype)),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, mimetype); err != nil {
+		return err
+	}
+	if fw, err = zw.Create("META-INF/container.xml"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, xml.Header+`<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">`+
+		`<rootfiles><rootfile full-path="`+epubPackage+`" media-type="application/oebps-package+xml"/></rootfiles></container>`+"\n"); err != nil {
+		return err
+	}
+	var chapters, items []epubItem
+	var modified time.Time
+	var images []string
+	seen := make(map[string]struct{})
+	digest := sha1.New()
+	for i, link := range h.readingOrder() {
+		b, err := h.readDocument(link.File)
+		if errors.Is(err, errTooLarge) {
+			log.Printf("epub: %v", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fi, err := fs.Stat(h.fsys, link.File); err == nil && fi.ModTime().After(modified) {
+			modified = fi.ModTime()
+		}
+		digest.Write([]byte(link.File))
+		opts := h.renderOptions()
+		offline := h.offlineLinks(link.File)
+		opts.Transform = func(doc ast.Node) {
+			ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+				if img, ok := node.(*ast.Image); ok && entering {
+					if target, ok := resolveLink(link.File, string(img.Destination)); ok && isRegularFileFS(h.fsys, target) {
+						if _, ok := seen[target]; !ok {
+							seen[target] = struct{}{}
+							images = append(images, target)
+						}
+					}
+				}
+				return ast.GoToNext
+			})
+			offline(doc)
+		}
+		doc := mdrender.Render(b, opts)
+		title := doc.Title
+		if title == "" {
+			title = nameToTitle(path.Base(link.File))
+		}
+		name := h.trimExt(link.File) + ".html"
+		if fw, err = zw.Create(name); err != nil {
+			return err
+		}
+		if err := writeXHTML(fw, title, h.fileHref(link.File, epubStyle, true), doc.HTML); err != nil {
+			return err
+		}
+		chapters = append(chapters, epubItem{
+			ID:    fmt.Sprintf("c%d", i+1),
+			Href:  (&url.URL{Path: name}).String(),
+			Type:  "application/xhtml+xml",
+			Title: title,
+		})
+	}
+	if len(chapters) == 0 {
+		return fmt.Errorf("no documents to put into EPUB")
+	}
+	for _, name := range images {
+		b, err := fs.ReadFile(h.fsys, name)
+		if err != nil {
+			return err
+		}
+		if fw, err = zw.Create(name); err != nil {
+			return err
+		}
+		if _, err := fw.Write(b); err != nil {
+			return err
+		}
+		typ, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+		if typ == "" {
+			typ = "application/octet-stream"
+		}
+		items = append(items, epubItem{
+			ID:   fmt.Sprintf("i%d", len(items)+1),
+			Href: (&url.URL{Path: name}).String(),
+			Type: typ,
+		})
+	}
+	style := []byte(h.theme().style)
+	if h.linkStyle {
+		if style, err = fs.ReadFile(h.fsys, strings.TrimPrefix(string(style), "/")); err != nil {
+			return err
+		}
+	}
+	if fw, err = zw.Create(epubStyle); err != nil {
+		return err
+	}
+	if _, err := fw.Write(style); err != nil {
+		return err
+	}
+	if fw, err = zw.Create(epubNavigation); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, xml.Header); err != nil {
+		return err
+	}
+	if err := epubNavTemplate.Execute(fw, chapters); err != nil {
+		return err
+	}
+	if fw, err = zw.Create(epubPackage); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, xml.Header); err != nil {
+		return err
+	}
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	return epubPackageTemplate.Execute(fw, struct {
+		ID, Title, Modified string
+		Style               string
+		Chapters, Items     []epubItem
+	}{
+		ID:       fmt.Sprintf("urn:sha1:%x", digest.Sum(nil)),
+		Title:    chapters[0].Title,
+		Modified: modified.UTC().Format("2006-01-02T15:04:05Z"),
+		Style:    epubStyle,
+		Chapters: chapters,
+		Items:    items,
+	})
+}
+
+// writeXHTML writes html body as XHTML document with a given title and
+// stylesheet link. Body is re-serialized so void elements are closed, as XML
+// requires.
+func writeXHTML(w io.Writer, title, styleHref string, body []byte) error {
+	nodes, err := html.ParseFragment(bytes.NewReader(body), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<!DOCTYPE html>` + "\n" + `<html xmlns="http://www.w3.org/1999/xhtml"><head><meta charset="utf-8"/><title>`)
+	xml.EscapeText(&buf, []byte(title))
+	buf.WriteString(`</title><link rel="stylesheet" href="`)
+	xml.EscapeText(&buf, []byte((&url.URL{Path: styleHref}).String()))
+	buf.WriteString(`"/></head><body><article>`)
+	for _, n := range nodes {
+		if err := html.Render(&buf, n); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("</article></body></html>\n")
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+var epubPackageTemplate = template.Must(template.New("opf").Parse(epubPackageTpl))
+var epubNavTemplate = template.Must(template.New("nav").Parse(epubNavTpl))
+
+const epubPackageTpl = `<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="id">{{.ID}}</dc:identifier>
+<dc:title>{{.Title}}</dc:title>
+<dc:language>en</dc:language>
+<meta property="dcterms:modified">{{.Modified}}</meta>
+</metadata>
+<manifest>
+<item id="nav" href="_nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="style" href="{{.Style}}" media-type="text/css"/>
+{{range .Chapters}}<item id="{{.ID}}" href="{{.Href}}" media-type="{{.Type}}"/>
+{{end}}{{range .Items}}<item id="{{.ID}}" href="{{.Href}}" media-type="{{.Type}}"/>
+{{end}}</manifest>
+<spine>
+{{range .Chapters}}<itemref idref="{{.ID}}"/>
+{{end}}</spine>
+</package>
+`
+
+const epubNavTpl = `<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><meta charset="utf-8"/><title>Contents</title></head>
+<body><nav epub:type="toc" id="toc"><h1>Contents</h1><ol>
+{{range .}}<li><a href="{{.Href}}">{{.Title}}</a></li>
+{{end}}</ol></nav></body></html>
+`
@@ -0,0 +1,108 @@
+package mdhandler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// feedSize is the number of entries in Atom feed
+const feedSize = 20
+
+// serveFeed serves Atom feed of recently modified documents, see
+// https://www.rfc-editor.org/rfc/rfc4287
+func (h *Handler) serveFeed(w http.ResponseWriter, r *http.Request) {
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	type link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+	}
+	type summary struct {
+		Type string `xml:"type,attr"`
+		Base string `xml:"xml:base,attr"`
+		Text string `xml:",chardata"`
+	}
+	type entry struct {
+		Title   string   `xml:"title"`
+		ID      string   `xml:"id"`
+		Link    link     `xml:"link"`
+		Updated string   `xml:"updated"`
+		Summary *summary `xml:"summary,omitempty"`
+	}
+	_, host := h.requestHost(r)
+	base := h.baseURL(r)
+	feed := struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Title   string   `xml:"title"`
+		ID      string   `xml:"id"`
+		Links   []link   `xml:"link"`
+		Updated string   `xml:"updated"`
+		Author  string   `xml:"author>name"`
+		Entries []entry  `xml:"entry"`
+	}{
+		Title:  "Recently changed documents",
+		ID:     base + h.base + "/",
+		Links:  []link{{Href: base + h.base + "/feed.atom", Rel: "self"}, {Href: base + h.base + "/"}},
+		Author: host,
+	}
+	index := h.dirIndex(nil, "")
+	sort.SliceStable(index, func(i, j int) bool { return index[i].ModTime.After(index[j].ModTime) })
+	if len(index) > feedSize {
+		index = index[:feedSize]
+	}
+	var updated time.Time
+	for _, rec := range index {
+		if rec.ModTime.After(updated) {
+			updated = rec.ModTime
+		}
+		u := base + (&url.URL{Path: h.base + "/" + rec.File}).String()
+		e := entry{
+			Title:   rec.Title,
+			ID:      u,
+			Link:    link{Href: u},
+			Updated: rec.ModTime.UTC().Format(time.RFC3339),
+		}
+		var body []byte
+		if args, ok := h.converter(rec.File); ok {
+			body, _ = h.convert(rec.File, args)
+		} else if b, err := h.readDocument(rec.File); err == nil {
+			body = h.render(b).HTML
+		}
+		if s := firstParagraph(body); s != "" {
+			e.Summary = &summary{Type: "html", Base: u, Text: s}
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		return
+	}
+	io.WriteString(w, "\n")
+}
+
+// firstParagraph returns html of the first paragraph of rendered document, or
+// an empty string if it has none.
+func firstParagraph(b []byte) string {
+	i := bytes.Index(b, []byte("<p>"))
+	if i < 0 {
+		return ""
+	}
+	j := bytes.Index(b[i:], []byte("</p>"))
+	if j < 0 {
+		return ""
+	}
+	return string(b[i : i+j+len("</p>")])
+}
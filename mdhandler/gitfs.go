@@ -0,0 +1,394 @@
+package mdhandler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// gitFS is a fs.FS serving files of a git repository as of the given ref,
+// without a checkout. Repository is read with go-git, so git command is not
+// needed. Ref is resolved again at most once a second, so new commits are
+// picked up without restart. All files have commit time as their
+// modification time.
+type gitFS struct {
+	repo *git.Repository
+	dir  string // repository directory, as given to GitFS
+	ref  string
+
+	mu      sync.Mutex
+	checked time.Time // last time ref was resolved
+	tree    *gitTree
+}
+
+// gitTree is a snapshot of the repository tree at a given commit.
+type gitTree struct {
+	commit  string
+	mtime   time.Time
+	entries map[string]*gitEntry // keyed by path, "." is the root
+}
+
+type gitEntry struct {
+	name     string // base name
+	dir      bool
+	size     int64
+	hash     plumbing.Hash
+	children []*gitEntry // sorted by name, only set for directories
+}
+
+// GitFS returns fs.FS serving files of git repository repo, which may be bare,
+// as of reference ref (branch, tag, commit), which is "HEAD" if empty. See
+// gitFS for details.
+func GitFS(repo, ref string) (fs.FS, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+	r, err := git.PlainOpen(repo)
+	if err != nil {
+		return nil, fmt.Errorf("open git repository %s: %w", repo, err)
+	}
+	g := &gitFS{repo: r, dir: repo, ref: ref}
+	if _, err := g.snapshot(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// snapshot returns tree of the commit ref currently points to.
+func (g *gitFS) snapshot() (*gitTree, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.tree != nil && time.Since(g.checked) < time.Second {
+		return g.tree, nil
+	}
+	hash, err := g.repo.ResolveRevision(plumbing.Revision(g.ref))
+	if err != nil {
+		return nil, fmt.Errorf("resolve git ref %q: %w", g.ref, err)
+	}
+	g.checked = time.Now()
+	if g.tree != nil && g.tree.commit == hash.String() {
+		return g.tree, nil
+	}
+	tree, err := g.readTree(*hash)
+	if err != nil {
+		return nil, err
+	}
+	g.tree = tree
+	return tree, nil
+}
+
+func (g *gitFS) readTree(hash plumbing.Hash) (*gitTree, error) {
+	commit, err := g.repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	t, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	root := &gitEntry{name: ".", dir: true}
+	tree := &gitTree{commit: hash.String(), mtime: commit.Committer.When, entries: map[string]*gitEntry{".": root}}
+	walker := object.NewTreeWalker(t, true, nil)
+	defer walker.Close()
+	for {
+		name, te, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := &gitEntry{name: path.Base(name), hash: te.Hash}
+		switch te.Mode {
+		case filemode.Dir:
+			e.dir = true
+		case filemode.Regular, filemode.Deprecated, filemode.Executable:
+			if e.size, err = g.repo.Storer.EncodedObjectSize(te.Hash); err != nil {
+				return nil, err
+			}
+		default: // symlinks and submodules
+			continue
+		}
+		parent, ok := tree.entries[path.Dir(name)]
+		if !ok {
+			continue
+		}
+		parent.children = append(parent.children, e)
+		tree.entries[name] = e
+	}
+	for _, e := range tree.entries {
+		sort.Slice(e.children, func(i, j int) bool { return e.children[i].name < e.children[j].name })
+	}
+	return tree, nil
+}
+
+func (g *gitFS) lookup(op, name string) (*gitTree, *gitEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	tree, err := g.snapshot()
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	e, ok := tree.entries[name]
+	if !ok {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return tree, e, nil
+}
+
+func (g *gitFS) Stat(name string) (fs.FileInfo, error) {
+	tree, e, err := g.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return gitFileInfo{e, tree.mtime}, nil
+}
+
+func (g *gitFS) Open(name string) (fs.File, error) {
+	tree, e, err := g.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := gitFileInfo{e, tree.mtime}
+	if e.dir {
+		entries := make([]fs.DirEntry, 0, len(e.children))
+		for _, c := range e.children {
+			entries = append(entries, gitFileInfo{c, tree.mtime})
+		}
+		return &gitDir{info: info, entries: entries}, nil
+	}
+	b, err := g.blob(e.hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &gitFile{Reader: bytes.NewReader(b), info: info}, nil
+}
+
+// blob returns content of the blob with a given hash. Blobs are immutable, so
+// small ones are cached.
+func (g *gitFS) blob(hash plumbing.Hash) ([]byte, error) {
+	blobCache.Lock()
+	b, ok := blobCache.m[hash]
+	blobCache.Unlock()
+	if ok {
+		return b, nil
+	}
+	obj, err := g.repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	if b, err = io.ReadAll(rd); err != nil {
+		return nil, err
+	}
+	if len(b) > maxCachedBlob {
+		return b, nil
+	}
+	blobCache.Lock()
+	defer blobCache.Unlock()
+	if blobCache.size+len(b) > maxBlobCache {
+		blobCache.m, blobCache.size = nil, 0
+	}
+	if blobCache.m == nil {
+		blobCache.m = make(map[plumbing.Hash][]byte)
+	}
+	blobCache.m[hash] = b
+	blobCache.size += len(b)
+	return b, nil
+}
+
+const (
+	maxCachedBlob = 1 << 20
+	maxBlobCache  = 64 << 20
+)
+
+var blobCache struct {
+	sync.Mutex
+	m    map[plumbing.Hash][]byte
+	size int // total size of cached blobs
+}
+
+// gitFileInfo implements both fs.FileInfo and fs.DirEntry
+type gitFileInfo struct {
+	e     *gitEntry
+	mtime time.Time
+}
+
+func (fi gitFileInfo) Name() string       { return fi.e.name }
+func (fi gitFileInfo) Size() int64        { return fi.e.size }
+func (fi gitFileInfo) ModTime() time.Time { return fi.mtime }
+func (fi gitFileInfo) IsDir() bool        { return fi.e.dir }
+func (fi gitFileInfo) Sys() interface{}   { return nil }
+func (fi gitFileInfo) Mode() fs.FileMode {
+	if fi.e.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+func (fi gitFileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi gitFileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+type gitFile struct {
+	*bytes.Reader
+	info gitFileInfo
+}
+
+func (f *gitFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *gitFile) Close() error               { return nil }
+
+type gitDir struct {
+	info    gitFileInfo
+	entries []fs.DirEntry
+}
+
+func (d *gitDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *gitDir) Close() error               { return nil }
+func (d *gitDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *gitDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	out := d.entries[:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
+
+// gitRefsFS is a fs.FS serving files of several references of the same git
+// repository, each under top-level directory named after its reference.
+type gitRefsFS struct {
+	refs []string
+	fss  map[string]*gitFS
+}
+
+// GitRefsFS returns fs.FS serving files of git repository repo as of each of
+// refs, under top-level directories named after refs, so "v1/README.md" is
+// README.md file at ref "v1". Refs must not contain "/". See GitFS for
+// details.
+func GitRefsFS(repo string, refs []string) (fs.FS, error) {
+	if len(refs) == 0 {
+		return nil, errors.New("no git refs given")
+	}
+	out := &gitRefsFS{fss: make(map[string]*gitFS, len(refs))}
+	for _, ref := range refs {
+		if !fs.ValidPath(ref) || ref == "." || strings.Contains(ref, "/") {
+			return nil, fmt.Errorf("invalid git ref %q", ref)
+		}
+		if _, ok := out.fss[ref]; ok {
+			continue
+		}
+		g, err := GitFS(repo, ref)
+		if err != nil {
+			return nil, err
+		}
+		out.refs = append(out.refs, ref)
+		out.fss[ref] = g.(*gitFS)
+	}
+	sort.Strings(out.refs)
+	return out, nil
+}
+
+// split returns gitFS serving ref of the first element of name, and the
+// rest of name, which is "." for the top-level directory itself.
+func (r *gitRefsFS) split(op, name string) (*gitFS, string, error) {
+	if !fs.ValidPath(name) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	ref, rest, _ := strings.Cut(name, "/")
+	g, ok := r.fss[ref]
+	if !ok {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if rest == "" {
+		rest = "."
+	}
+	return g, rest, nil
+}
+
+// refDir returns info of the top-level directory holding ref
+func refDir(ref string, mtime time.Time) gitFileInfo {
+	return gitFileInfo{&gitEntry{name: ref, dir: true}, mtime}
+}
+
+// root returns info of the top-level directory and entries of directories
+// holding refs; modification times are times of the latest ref commit.
+func (r *gitRefsFS) root(op string) (gitFileInfo, []fs.DirEntry, error) {
+	info := gitFileInfo{e: &gitEntry{name: ".", dir: true}}
+	entries := make([]fs.DirEntry, 0, len(r.refs))
+	for _, ref := range r.refs {
+		tree, err := r.fss[ref].snapshot()
+		if err != nil {
+			return info, nil, &fs.PathError{Op: op, Path: ".", Err: err}
+		}
+		if tree.mtime.After(info.mtime) {
+			info.mtime = tree.mtime
+		}
+		entries = append(entries, refDir(ref, tree.mtime))
+	}
+	return info, entries, nil
+}
+
+func (r *gitRefsFS) Stat(name string) (fs.FileInfo, error) {
+	if name == "." {
+		info, _, err := r.root("stat")
+		return info, err
+	}
+	g, rest, err := r.split("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := g.Stat(rest)
+	if err == nil && rest == "." {
+		fi = refDir(name, fi.ModTime())
+	}
+	return fi, err
+}
+
+func (r *gitRefsFS) Open(name string) (fs.File, error) {
+	if name == "." {
+		info, entries, err := r.root("open")
+		if err != nil {
+			return nil, err
+		}
+		return &gitDir{info: info, entries: entries}, nil
+	}
+	g, rest, err := r.split("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := g.Open(rest)
+	if d, ok := f.(*gitDir); ok && rest == "." {
+		d.info = refDir(name, d.info.mtime)
+	}
+	return f, err
+}
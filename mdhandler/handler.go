@@ -0,0 +1,1765 @@
+// Package mdhandler implements http.Handler serving markdown documents from
+// fs.FS as rendered html pages, the way mdserver command does.
+//
+// It can be used to serve documentation embedded into a program:
+//
+//	//go:embed docs
+//	var docs embed.FS
+//
+//	func main() {
+//		fsys, _ := fs.Sub(docs, "docs")
+//		h, err := mdhandler.New(fsys, nil)
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		log.Fatal(http.ListenAndServe("localhost:8080", h))
+//	}
+package mdhandler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/artyom/mdserver/mdrender"
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Options configure Handler. Zero value is a valid configuration.
+type Options struct {
+	// Dir is a directory on disk served fsys is read from, if it is one. It's
+	// required for Edit and DAVWrite; if it's inside a git repository,
+	// document history is available.
+	Dir string
+
+	GithubWiki  bool // rewrite github wiki links to local ones
+	WikiLinks   bool // render [[Page Name]] wikilinks
+	Emoji       bool // render :shortcode: emoji
+	Includes    bool // expand include directives, see mdrender.ExpandIncludes
+	Glossary    bool // mark terms defined in _Glossary.md files with <abbr>
+	External    bool // mark links to other sites with an icon
+	NewTab      bool // open links to other sites in a new tab
+	CheckLinks  bool // mark local links to missing files as broken
+	Previews    bool // preview linked documents on hover, see /api/preview
+	Keys        bool // keyboard shortcuts and Ctrl+K document palette
+	CopyButtons bool // add "copy" buttons to code blocks
+	DirThemes   bool // apply .mdserver/style.css and .mdserver/page.html
+	Backlinks   bool // list documents referencing each page
+	PageNav     bool // link previous and next documents on each page
+	Search      bool // enable substring search
+	RootIndex   bool // render generated index at /
+	HighlightJS bool // highlight code with highlight.js
+	RenderCode  bool // render text and source files as highlighted pages
+	RenderCSV   bool // render CSV and TSV files as sortable tables
+	Edit        bool // allow editing documents in browser, requires Dir
+	DAV         bool // serve files over WebDAV at /dav/
+	DAVWrite    bool // allow changes over WebDAV, requires Dir
+	TrustProxy  bool // take scheme and host from X-Forwarded-* headers
+	AutoReload  bool // reload pages in browser when documents change
+	PWA         bool // keep visited pages for offline reading, see assets/sw.js
+	PageInfo    bool // show modification time, size and last commit of documents
+	Outline     bool // "On this page" sidebar with document headings
+
+	// CSSFile is a path to stylesheet embedded into every page instead of
+	// the built-in one. File is reloaded when it changes.
+	CSSFile string
+
+	// StyleHref, if set, is an absolute path of stylesheet in served fsys to
+	// link from every page instead of embedding stylesheet. It takes
+	// precedence over CSSFile.
+	StyleHref string
+
+	// Themes map names of alternative stylesheets to their files, read on
+	// every use. Readers pick one with "?theme=name" query parameter on any
+	// page, choice is kept in a cookie. Selected stylesheet is linked after
+	// the main one, so it only needs to override some of its rules.
+	Themes map[string]string
+
+	// Favicon and Logo are paths of image files: icon browsers show for
+	// pages, and logo shown in navigation header of every page. They're
+	// served under /_assets/ path as "favicon" and "logo" with extension of
+	// their files; Favicon is also served at /favicon.ico.
+	Favicon, Logo string
+
+	// Assets is a directory with files served under /_assets/ path,
+	// overriding built-in ones.
+	Assets string
+
+	// Templates is a directory with templates overriding built-in ones,
+	// which are reloaded when they change.
+	Templates string
+
+	// EditorURL, if set, is a template of URL opening document source in
+	// editor, like "vscode://file{path}", where "{path}" is replaced with
+	// absolute path of document file. Pages get "edit" link with this URL.
+	// It requires Dir.
+	EditorURL string
+
+	// Home, if set, is a path of document in fsys rendered at / instead of
+	// README.md or index.md.
+	Home string
+
+	// MaxSize, if positive, is the maximum size of markdown document in
+	// bytes that is rendered; larger documents get error page with 422
+	// status.
+	MaxSize int64
+
+	// MaxRenders, if positive, is the maximum number of pages rendered at
+	// the same time. Requests over the limit wait for a while, then get 503
+	// status, so a crawler can't exhaust server memory.
+	MaxRenders int
+
+	// FrameAncestors is a list of sources allowed to embed pages in frames,
+	// in Content-Security-Policy frame-ancestors directive syntax, like
+	// "'self' https://intranet.example.com". If empty, it's "'self'".
+	FrameAncestors string
+
+	// ReferrerPolicy is a value of Referrer-Policy header sent with every
+	// response. If empty, it's "strict-origin-when-cross-origin".
+	ReferrerPolicy string
+
+	// PublicURL, if set, is scheme and host server is reachable at, like
+	// "https://docs.example.com", used in absolute links of canonical and
+	// social preview tags, sitemap and feed instead of those taken from
+	// request.
+	PublicURL string
+
+	// HeadingIDPrefix, if set, is prepended to ids of document headings,
+	// like "user-content-" GitHub uses, so they can't collide with ids of
+	// page elements. It must start with an ASCII letter, followed by
+	// letters, digits, "-" and "_".
+	HeadingIDPrefix string
+
+	// Robots is a content of /robots.txt; if nil, robots.txt from fsys is
+	// served, or generated one.
+	Robots []byte
+
+	// Rewrite rules are applied to link destinations of documents.
+	Rewrite []mdrender.RewriteRule
+
+	// Extensions are file name extensions of markdown documents, like
+	// ".md" or ".markdown"; other files are served as is. If empty, only
+	// ".md" files are rendered. The first one is used for links to missing
+	// documents.
+	Extensions []string
+
+	// Converters map file extensions like ".adoc" or ".rst" to commands
+	// converting documents in other formats to html, like
+	// "asciidoctor -s -o - -". Command reads document from stdin and writes
+	// html to stdout; it's split into arguments on spaces and runs in the
+	// document directory if Dir is set. Converted documents are listed in
+	// index along with markdown ones.
+	Converters map[string]string
+
+	// Versions are names of top-level directories holding versions of the
+	// same documents, like "v1" and "v2", in order they're listed in
+	// version picker shown on their pages. Picker links to the document
+	// with the same path in other versions, if there is one.
+	Versions []string
+
+	// BaseURL is a path prefix like "/docs/" Handler is mounted at, i.e.
+	// behind a reverse proxy. Links on generated pages and root-relative
+	// links of documents get this prefix. Requests are served both with
+	// and without it, so proxy may or may not strip the prefix.
+	BaseURL string
+}
+
+// New returns Handler serving markdown documents and other files from fsys,
+// configured with opts, which may be nil. If fsys was returned by GitFS,
+// document history is read from its git repository.
+func New(fsys fs.FS, opts *Options) (*Handler, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if (opts.Edit || opts.DAVWrite) && opts.Dir == "" {
+		return nil, errors.New("editing requires documents directory")
+	}
+	if opts.PublicURL != "" {
+		if u, err := url.Parse(opts.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid public URL %q, want one like https://docs.example.com", opts.PublicURL)
+		}
+	}
+	if opts.HeadingIDPrefix != "" && !isIDPrefix(opts.HeadingIDPrefix) {
+		return nil, fmt.Errorf("invalid heading id prefix %q, want one like user-content-", opts.HeadingIDPrefix)
+	}
+	if opts.EditorURL != "" && opts.Dir == "" {
+		return nil, errors.New("editor links require documents directory")
+	}
+	if opts.EditorURL != "" && !strings.Contains(opts.EditorURL, "{path}") {
+		return nil, fmt.Errorf("editor URL %q has no {path} placeholder", opts.EditorURL)
+	}
+	h := &Handler{
+		dir:        opts.Dir,
+		fsys:       fsys,
+		githubWiki: opts.GithubWiki,
+		wikiLinks:  opts.WikiLinks,
+		emoji:      opts.Emoji,
+		includes:   opts.Includes,
+		glossary:   opts.Glossary,
+		external:   opts.External,
+		newTab:     opts.NewTab,
+		checkLinks: opts.CheckLinks,
+		previews:   opts.Previews,
+		keys:       opts.Keys,
+		pwa:        opts.PWA,
+		copyCode:   opts.CopyButtons,
+		pageInfo:   opts.PageInfo,
+		outline:    opts.Outline,
+		versions:   opts.Versions,
+		dirThemes:  opts.DirThemes,
+		backlinks:  opts.Backlinks,
+		pageNav:    opts.PageNav,
+		edit:       opts.Edit,
+		withSearch: opts.Search,
+		rootIndex:  opts.RootIndex,
+		hljs:       opts.HighlightJS,
+		renderCode: opts.RenderCode,
+		renderCSV:  opts.RenderCSV,
+		style:      style,
+		assetFS:    overlayFS{dir: opts.Assets, base: builtinAssetsFS},
+		robots:     opts.Robots,
+		trustProxy: opts.TrustProxy,
+		autoReload: opts.AutoReload,
+		home:       strings.TrimPrefix(opts.Home, "/"),
+		editorURL:  opts.EditorURL,
+		publicURL:  strings.TrimSuffix(opts.PublicURL, "/"),
+		idPrefix:   opts.HeadingIDPrefix,
+		maxSize:    opts.MaxSize,
+		rewrite:    opts.Rewrite,
+		exts:       opts.Extensions,
+		started:    time.Now(),
+	}
+	h.assets = http.StripPrefix("/_assets", http.FileServer(http.FS(h.assetFS)))
+	for _, ext := range opts.Extensions {
+		if len(ext) < 2 || ext[0] != '.' || strings.Contains(ext, "/") {
+			return nil, fmt.Errorf("invalid document extension %q, want one like .md", ext)
+		}
+	}
+	for ext, cmd := range opts.Converters {
+		if len(ext) < 2 || ext[0] != '.' || strings.Contains(ext, "/") {
+			return nil, fmt.Errorf("invalid converter extension %q, want one like .adoc", ext)
+		}
+		if h.isDocument("file" + ext) {
+			return nil, fmt.Errorf("converter extension %s is already a markdown document extension", ext)
+		}
+		args := strings.Fields(cmd)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty converter command for %s", ext)
+		}
+		if h.converters == nil {
+			h.converters = make(map[string][]string)
+		}
+		h.converters[strings.ToLower(ext)] = args
+	}
+	for name, file := range opts.Themes {
+		if !isThemeName(name) {
+			return nil, fmt.Errorf("invalid theme name %q, want letters, digits, - or _", name)
+		}
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("theme %s: %w", name, err)
+		}
+		if h.styles == nil {
+			h.styles = make(map[string]string)
+		}
+		h.styles[name] = file
+	}
+	for _, f := range []struct {
+		name, file string
+		asset      *string
+	}{{"favicon", opts.Favicon, &h.favicon}, {"logo", opts.Logo, &h.logo}} {
+		if f.file == "" {
+			continue
+		}
+		if !isRegularFile(f.file) {
+			return nil, fmt.Errorf("%s %q is not a regular file", f.name, f.file)
+		}
+		*f.asset = f.name + strings.ToLower(filepath.Ext(f.file))
+		if h.brand == nil {
+			h.brand = make(map[string]string)
+		}
+		h.brand[*f.asset] = f.file
+	}
+	if opts.MaxRenders > 0 {
+		h.renders = make(chan struct{}, opts.MaxRenders)
+	}
+	h.frames, h.referrer = "'self'", "strict-origin-when-cross-origin"
+	if s := strings.TrimSpace(opts.FrameAncestors); s != "" {
+		if strings.ContainsAny(s, ";,\r\n") {
+			return nil, fmt.Errorf("invalid frame ancestors %q", s)
+		}
+		h.frames = s
+	}
+	if s := strings.TrimSpace(opts.ReferrerPolicy); s != "" {
+		if strings.ContainsAny(s, ";\r\n") {
+			return nil, fmt.Errorf("invalid referrer policy %q", s)
+		}
+		h.referrer = s
+	}
+	if opts.BaseURL != "" {
+		if !path.IsAbs(opts.BaseURL) {
+			return nil, fmt.Errorf("base URL must be an absolute / separated path, but %q is not", opts.BaseURL)
+		}
+		h.base = strings.TrimSuffix(path.Clean(opts.BaseURL), "/")
+	}
+	switch g, ok := fsys.(*gitFS); {
+	case ok && gitAvailable():
+		h.history = &gitHistory{repo: g.dir, ref: g.ref}
+	case opts.Dir != "":
+		h.history = newGitHistory(opts.Dir)
+	}
+	h.fileServer = http.FileServer(http.FS(h.fsys))
+	if opts.DAV || opts.DAVWrite {
+		h.dav = h.newDAVHandler(opts.DAVWrite)
+	}
+	if opts.Assets != "" {
+		h.customCSS = isRegularFile(filepath.Join(opts.Assets, "custom.css"))
+		h.customJS = isRegularFile(filepath.Join(opts.Assets, "custom.js"))
+	}
+	switch {
+	case opts.StyleHref != "":
+		if !path.IsAbs(opts.StyleHref) {
+			return nil, fmt.Errorf("stylesheet href must be an absolute / separated path, but %q is not", opts.StyleHref)
+		}
+		h.style, h.linkStyle = opts.StyleHref, true
+	case opts.CSSFile != "":
+		b, err := os.ReadFile(opts.CSSFile)
+		if err != nil {
+			return nil, err
+		}
+		h.style = string(b)
+		if fi, err := os.Stat(opts.CSSFile); err == nil {
+			h.styleTime = fi.ModTime()
+		}
+	}
+	if !h.linkStyle {
+		sum := sha256.Sum256([]byte(h.style))
+		h.styleHash = "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	if opts.Templates != "" || (opts.CSSFile != "" && !h.linkStyle) {
+		h.themes = &themeWatcher{dir: opts.Templates}
+		if !h.linkStyle {
+			h.themes.css = opts.CSSFile
+		}
+		h.theme() // report template errors early
+	}
+	return h, nil
+}
+
+// Handler is a http.Handler serving markdown documents, see New.
+type Handler struct {
+	dir        string
+	base       string       // Options.BaseURL without trailing slash, empty for /
+	exts       []string     // Options.Extensions
+	fsys       fs.FS        // served files, initialized as os.DirFS(dir)
+	fileServer http.Handler // initialized as http.FileServer(http.FS(fsys))
+	githubWiki bool
+	rewrite    []mdrender.RewriteRule
+	converters map[string][]string // Options.Converters split into arguments
+	styles     map[string]string   // Options.Themes
+	brand      map[string]string   // /_assets/ names of Options.Favicon and Options.Logo to their files
+	wikiLinks  bool
+	emoji      bool
+	includes   bool
+	glossary   bool
+	external   bool
+	newTab     bool
+	checkLinks bool
+	targets    linkTargets // cached link targets for checkLinks
+	previews   bool
+	keys       bool
+	pwa        bool
+	copyCode   bool
+	pageInfo   bool
+	outline    bool
+	versions   []string // Options.Versions
+	dirThemes  bool
+	backlinks  bool
+	pageNav    bool
+	history    *gitHistory // nil if documents are not kept in git
+	edit       bool
+	dav        http.Handler // serves /dav/ if not nil
+	assetFS    fs.FS        // files served under /_assets/
+	graph      linkGraph
+	meta       docCache
+	dirTpls    dirTemplates
+	withSearch bool
+	rootIndex  bool
+	hljs       bool
+	renderCode bool
+	renderCSV  bool
+	linkStyle  bool
+	style      string
+	styleHash  string        // sha256-{HASH} value for CSP
+	styleTime  time.Time     // modification time of Options.CSSFile
+	themes     *themeWatcher // reloads style and templates, if not nil
+	started    time.Time     // server start time, reported by /healthz
+	maxSize    int64         // maximum size of rendered document, if positive
+	renders    chan struct{} // limits concurrent renders, if not nil
+	robots     []byte        // custom robots.txt content, if nil generated one is used
+	trustProxy bool          // Options.TrustProxy
+	autoReload bool          // Options.AutoReload
+	home       string        // Options.Home without leading slash
+	editorURL  string        // Options.EditorURL
+	publicURL  string        // Options.PublicURL without trailing slash
+	idPrefix   string        // Options.HeadingIDPrefix
+	favicon    string        // /_assets/ name of Options.Favicon
+	logo       string        // /_assets/ name of Options.Logo
+	frames     string        // Options.FrameAncestors or default
+	referrer   string        // Options.ReferrerPolicy or default
+	assets     http.Handler  // serves /_assets/ path
+	customCSS  bool          // whether Options.Assets directory has custom.css
+	customJS   bool          // whether Options.Assets directory has custom.js
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rw := &responseState{ResponseWriter: w}
+	defer h.recoverPanic(rw, r)
+	h.serveHTTP(rw, r)
+}
+
+func (h *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", h.referrer)
+	// legacy header for browsers not supporting frame-ancestors, only has
+	// equivalents for the simplest policies
+	switch h.frames {
+	case "'self'":
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	case "'none'":
+		w.Header().Set("X-Frame-Options", "DENY")
+	}
+	if h.base != "" {
+		if r.URL.Path == h.base {
+			u := *r.URL
+			u.Path, u.RawPath = h.base+"/", ""
+			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, h.base+"/") {
+			r = withPath(r, strings.TrimPrefix(r.URL.Path, h.base))
+		}
+	}
+	if h.styles != nil {
+		if r.URL.Path == "/_assets/"+themeCSS {
+			h.serveThemeCSS(w, r)
+			return
+		}
+		if r.URL.Query().Has("theme") {
+			h.selectTheme(w, r)
+			return
+		}
+	}
+	if strings.HasPrefix(r.URL.Path, "/_assets/") {
+		markStatic(r)
+		if h.pwa {
+			switch r.URL.Path {
+			case "/_assets/manifest.json":
+				h.serveManifest(w, r)
+				return
+			case "/_assets/sw.js":
+				// worker controls the whole site, not only /_assets/
+				w.Header().Set("Service-Worker-Allowed", h.base+"/")
+			}
+		}
+		if file, ok := h.brand[strings.TrimPrefix(r.URL.Path, "/_assets/")]; ok {
+			http.ServeFile(w, r, file)
+			return
+		}
+		h.assets.ServeHTTP(w, r)
+		return
+	}
+	if h.dav != nil && (r.URL.Path == "/dav" || strings.HasPrefix(r.URL.Path, "/dav/")) {
+		markStatic(r)
+		h.dav.ServeHTTP(w, withPath(r, h.rootHref(r.URL.Path)))
+		return
+	}
+	if r.URL.Path == "/healthz" {
+		h.serveHealth(w, r)
+		return
+	}
+	if h.withSearch && r.URL.Path == "/" && strings.HasPrefix(r.URL.RawQuery, "q=") {
+		q := r.URL.Query().Get("q")
+		if len(q) < 3 {
+			http.Error(w, "Search term is too short", http.StatusBadRequest)
+			return
+		}
+		release, ok := h.renderSlot(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+		pat := search.New(language.English, search.Loose).CompileString(q)
+		if err := h.writeIndex(w, fmt.Sprintf("Search results for %q", q), h.dirIndex(pat, ""), true, nil, q); err != nil {
+			h.serverError(w, r, err)
+		}
+		return
+	}
+	if r.URL.Path == "/" && r.URL.RawQuery == "tags" {
+		if err := h.renderTags(w, tagsIndex(h.dirIndex(nil, ""))); err != nil {
+			h.serverError(w, r, err)
+		}
+		return
+	}
+	if r.URL.Path == "/" && strings.HasPrefix(r.URL.RawQuery, "tag=") {
+		tag := normalizeTag(r.URL.Query().Get("tag"))
+		if tag == "" {
+			http.Error(w, "Empty tag", http.StatusBadRequest)
+			return
+		}
+		if err := h.renderIndex(w, fmt.Sprintf("Documents tagged %q", tag), h.dirIndex(nil, tag)); err != nil {
+			h.serverError(w, r, err)
+		}
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		h.serveAPI(w, r)
+		return
+	}
+	switch r.URL.Path {
+	case "/favicon.ico":
+		if h.favicon != "" {
+			markStatic(r)
+			http.ServeFile(w, r, h.brand[h.favicon])
+			return
+		}
+	case "/sitemap.xml":
+		h.serveSitemap(w, r)
+		return
+	case "/robots.txt":
+		h.serveRobots(w, r)
+		return
+	case "/feed.atom":
+		h.serveFeed(w, r)
+		return
+	}
+	if r.URL.Path == "/" && (r.URL.RawQuery == "orphans" || r.URL.RawQuery == "orphans=images") {
+		h.graph.update(h)
+		if r.URL.RawQuery == "orphans=images" {
+			if err := h.renderIndex(w, "Unused images", h.graph.unusedImages(h.fsys)); err != nil {
+				h.serverError(w, r, err)
+			}
+			return
+		}
+		if err := h.renderIndex(w, "Orphaned documents", h.graph.orphans()); err != nil {
+			h.serverError(w, r, err)
+		}
+		return
+	}
+	if r.URL.Path == "/" && strings.HasPrefix(r.URL.RawQuery, "download=") {
+		h.serveDownload(w, r, r.URL.Query().Get("download"))
+		return
+	}
+	if r.URL.Path == "/" && r.URL.RawQuery == "all" {
+		h.serveBook(w, r)
+		return
+	}
+	if r.URL.Path == "/" && (h.rootIndex || r.URL.Query().Has("index")) {
+		h.serveIndex(w, r)
+		return
+	}
+	if r.URL.Path == "/" && h.home != "" {
+		h.serveMarkdown(w, r, "/"+h.home)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") && !containsDotDot(r.URL.Path) {
+		if p, ok := h.dirReadme(r.URL.Path); ok {
+			h.serveMarkdown(w, r, p)
+			return
+		}
+	}
+	if h.edit && h.isDocument(r.URL.Path) {
+		switch r.URL.RawQuery {
+		case "edit":
+			h.serveEdit(w, r, r.URL.Path)
+			return
+		case "preview":
+			h.servePreview(w, r)
+			return
+		}
+	}
+	if !h.isDocument(r.URL.Path) {
+		if !containsDotDot(r.URL.Path) && !strings.HasSuffix(r.URL.Path, "/") {
+			if _, err := fs.Stat(h.fsys, fsPath(r.URL.Path)); errors.Is(err, fs.ErrNotExist) {
+				if h.redirectMissing(w, r) {
+					return
+				}
+				if path.Ext(r.URL.Path) == "" {
+					h.notFound(w, r)
+					return
+				}
+			}
+		}
+		if args, ok := h.converter(r.URL.Path); ok && r.URL.RawQuery != "raw" && !containsDotDot(r.URL.Path) {
+			h.serveConverted(w, r, r.URL.Path, args)
+			return
+		}
+		if h.renderCode && r.URL.RawQuery != "raw" && !containsDotDot(r.URL.Path) {
+			if lang, ok := codeLanguage(r.URL.Path); ok && h.serveCode(w, r, r.URL.Path, lang) {
+				return
+			}
+		}
+		if h.renderCSV && r.URL.RawQuery != "raw" && !containsDotDot(r.URL.Path) {
+			comma, ok := tableSeparators[strings.ToLower(path.Ext(r.URL.Path))]
+			if ok && h.serveTable(w, r, r.URL.Path, comma) {
+				return
+			}
+		}
+		markStatic(r)
+		h.fileServer.ServeHTTP(w, r)
+		return
+	}
+	if h.history != nil {
+		switch {
+		case r.URL.RawQuery == "history":
+			h.serveHistory(w, r, r.URL.Path)
+			return
+		case strings.HasPrefix(r.URL.RawQuery, "rev="):
+			h.serveRevision(w, r, r.URL.Path, r.URL.Query().Get("rev"))
+			return
+		case strings.HasPrefix(r.URL.RawQuery, "diff="):
+			h.serveDiff(w, r, r.URL.Path, r.URL.Query().Get("diff"))
+			return
+		}
+	}
+	h.serveMarkdown(w, r, r.URL.Path)
+}
+
+// serveMarkdown renders markdown file with URL path p
+func (h *Handler) serveMarkdown(w http.ResponseWriter, r *http.Request, p string) {
+	p = path.Clean(p)
+	if containsDotDot(p) {
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	rc, mtime, err := h.readerForFile(fsPath(p))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if !h.redirectMissing(w, r) {
+				h.notFound(w, r)
+			}
+			return
+		}
+		if errors.Is(err, errTooLarge) {
+			h.errorPage(w, r, http.StatusUnprocessableEntity, "Document is too large",
+				fmt.Sprintf("This document is larger than the %d byte limit for rendered documents.", h.maxSize))
+			return
+		}
+		log.Printf("read %q: %v", p, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	rc.canonical = h.baseURL(r) + (&url.URL{Path: h.base + "/" + fsPath(p)}).String()
+	// render page upfront unless client has it already, so rendering errors
+	// get error page rather than plain text one of http.ServeContent
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err != nil || mtime.Truncate(time.Second).After(t) {
+		if err := rc.init(); err != nil {
+			h.serverError(w, r, err)
+			return
+		}
+	}
+	h.setCSP(w, h.hljs)
+	h.preload(w)
+	http.ServeContent(w, r, "page.html", mtime, rc)
+}
+
+// servePage renders page generated for file modified at mtime, filling
+// its fields common for all pages.
+func (h *Handler) servePage(w http.ResponseWriter, r *http.Request, page pageData, mtime time.Time) {
+	page.IndexHref, page.CustomJS = h.base+"/?index", h.customJS
+	th := h.theme()
+	var buf bytes.Buffer
+	if err := th.template(pageTemplate).Execute(&buf, page); err != nil {
+		h.serverError(w, r, fmt.Errorf("render page: %w", err))
+		return
+	}
+	if th.styleTime.After(mtime) {
+		mtime = th.styleTime
+	}
+	h.setCSP(w, page.WithHL)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "page.html", mtime, bytes.NewReader(buf.Bytes()))
+}
+
+// preload adds Link headers asking browser to preload stylesheets and scripts
+// page links, so it can fetch them before parsing the page, reusing HTTP/2
+// connection.
+func (h *Handler) preload(w http.ResponseWriter) {
+	links := []string{"_assets/toc.js>; rel=preload; as=script"}
+	if h.linkStyle {
+		links = append(links, strings.TrimPrefix(h.theme().style, "/")+">; rel=preload; as=style")
+	}
+	if h.customCSS {
+		links = append(links, "_assets/custom.css>; rel=preload; as=style")
+	}
+	if h.customJS {
+		links = append(links, "_assets/custom.js>; rel=preload; as=script")
+	}
+	for _, link := range links {
+		w.Header().Add("Link", "<"+(&url.URL{Path: h.base + "/"}).String()+link)
+	}
+}
+
+// dirReadme returns path of README.md or index.md file found in directory
+// with URL path dir. It returns false if directory has index.html file, which
+// is served by file server, or has none of these markdown files.
+func (h *Handler) dirReadme(dir string) (string, bool) {
+	name := fsPath(dir)
+	if isRegularFileFS(h.fsys, path.Join(name, "index.html")) {
+		return "", false
+	}
+	for _, s := range [...]string{"README", "index"} {
+		for _, ext := range h.extensions() {
+			if isRegularFileFS(h.fsys, path.Join(name, s+ext)) {
+				return path.Join(dir, s+ext), true
+			}
+		}
+	}
+	return "", false
+}
+
+func (h *Handler) renderIndex(w io.Writer, title string, index []indexRecord) error {
+	return h.writeIndex(w, title, index, h.withSearch, nil, "")
+}
+
+// indexPageSize is the number of documents on a single page of index
+const indexPageSize = 200
+
+// indexPager describes a single page of index split into pages
+type indexPager struct {
+	Page, Pages        int
+	Filter             string // only documents with title or name containing this are listed
+	PrevHref, NextHref string
+	View               string   // "az" for index grouped by first letters of titles
+	Letters            []string // groups of "az" view
+}
+
+// serveIndex renders page of automatically generated index, given with "page"
+// query parameter. If "filter" parameter is set, index only lists documents
+// with title or file name containing it, ignoring case. Request with
+// "index=az" parameter gets all documents sorted by title and grouped by
+// its first letter, with a bar of links to these groups.
+func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	index := h.dirIndex(nil, "")
+	q := r.URL.Query()
+	pager := &indexPager{Page: 1, Filter: strings.TrimSpace(q.Get("filter"))}
+	if q.Get("index") == "az" {
+		pager.View = "az"
+	}
+	if pager.Filter != "" {
+		s := strings.ToLower(pager.Filter)
+		filtered := index[:0]
+		for _, rec := range index {
+			if strings.Contains(strings.ToLower(rec.Title), s) || strings.Contains(strings.ToLower(rec.File), s) {
+				filtered = append(filtered, rec)
+			}
+		}
+		index = filtered
+	}
+	if pager.View == "az" {
+		index, pager.Letters = byLetter(index)
+		pager.Pages = 1
+		if err := h.writeIndex(w, "Index A–Z", index, h.withSearch, pager, ""); err != nil {
+			h.serverError(w, r, err)
+		}
+		return
+	}
+	if n, err := strconv.Atoi(q.Get("page")); err == nil && n > 0 {
+		pager.Page = n
+	}
+	pager.Pages = (len(index) + indexPageSize - 1) / indexPageSize
+	if pager.Page > pager.Pages && pager.Pages > 0 {
+		http.NotFound(w, r)
+		return
+	}
+	href := func(page int) string {
+		v := url.Values{"page": {strconv.Itoa(page)}}
+		if pager.Filter != "" {
+			v.Set("filter", pager.Filter)
+		}
+		return h.base + "/?index&" + v.Encode()
+	}
+	if pager.Page > 1 {
+		pager.PrevHref = href(pager.Page - 1)
+	}
+	if pager.Page < pager.Pages {
+		pager.NextHref = href(pager.Page + 1)
+	}
+	if end := pager.Page * indexPageSize; end < len(index) {
+		index = index[:end]
+	}
+	if start := (pager.Page - 1) * indexPageSize; start < len(index) {
+		index = index[start:]
+	}
+	if err := h.writeIndex(w, "Index", index, h.withSearch, pager, ""); err != nil {
+		h.serverError(w, r, err)
+	}
+}
+
+// writeIndex renders index page, optionally with search form. If pager is not
+// nil, page also has filter form and links to other pages of index. If query
+// is not empty, index lists results of this search query, and links to
+// documents carry it, so matches are highlighted on pages.
+func (h *Handler) writeIndex(w io.Writer, title string, index []indexRecord, withSearch bool, pager *indexPager, query string) error {
+	page := struct {
+		pageHead
+		Index      []indexRecord
+		WithSearch bool
+		Query      string
+		Pager      *indexPager
+		Scripts    []string // additional scripts from /_assets/
+	}{
+		pageHead:   h.pageHead(title),
+		Index:      index,
+		WithSearch: withSearch,
+		Query:      query,
+		Pager:      pager,
+	}
+	// index saved for offline reading has neither pager nor query, and
+	// can't use API scripts rely on
+	if h.keys && (pager != nil || query != "") {
+		page.Scripts = append(page.Scripts, "keys.js")
+	}
+	if h.pwa && (pager != nil || query != "") {
+		page.Scripts = append(page.Scripts, "pwa.js")
+	}
+	th := h.theme()
+	return h.executeTo(w, th.template(indexTemplate), page)
+}
+
+func (h *Handler) renderTags(w io.Writer, tags []tagRecord) error {
+	page := struct {
+		pageHead
+		Tags []tagRecord
+	}{
+		pageHead: h.pageHead("Tags"),
+		Tags:     tags,
+	}
+	th := h.theme()
+	return h.executeTo(w, th.template(tagsTemplate), page)
+}
+
+// setCSP sets Content-Security-Policy header of generated page, see csp
+func (h *Handler) setCSP(w http.ResponseWriter, withHL bool) {
+	w.Header().Set("Content-Security-Policy", h.csp(withHL))
+}
+
+// csp returns Content-Security-Policy for generated pages, only allowing
+// scripts and stylesheets from the server itself, the embedded stylesheet,
+// and highlight.js from CDN if withHL is true.
+func (h *Handler) csp(withHL bool) string {
+	styleHash := h.theme().styleHash
+	csp := []string{"default-src 'self';img-src http: https: data:;media-src https:",
+		"object-src 'none';base-uri 'self';form-action 'self'", "frame-ancestors " + h.frames}
+	switch {
+	case withHL:
+		csp = append(csp, "script-src 'self' https://cdnjs.cloudflare.com")
+		switch {
+		case h.linkStyle:
+			csp = append(csp, "style-src 'self' https://cdnjs.cloudflare.com")
+		default:
+			csp = append(csp, "style-src 'self' https://cdnjs.cloudflare.com '"+styleHash+"'")
+		}
+	default:
+		csp = append(csp, "script-src 'self'")
+		switch {
+		case h.linkStyle:
+			csp = append(csp, "style-src 'self'")
+		default:
+			csp = append(csp, "style-src 'self' '"+styleHash+"'")
+		}
+	}
+	return strings.Join(csp, ";")
+}
+
+// readerForFile returns lazy io.ReadSeeker and mtime to be used as arguments of
+// http.ServeContent. It does not use ReadSeeker at all if http client already
+// has fresh content as signaled by "If-Modified-Since" request header;
+// lazyReadSeeker takes advantage of this by defering any file reading and
+// rendering until one of its method is called.
+func (h *Handler) readerForFile(file string) (*lazyReadSeeker, time.Time, error) {
+	fi, err := fs.Stat(h.fsys, file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if err := h.checkSize(fi); err != nil {
+		return nil, time.Time{}, err
+	}
+	l := &lazyReadSeeker{file: file, h: h}
+	mtime := fi.ModTime()
+	if h.pageInfo {
+		l.info = &pageInfo{Modified: mtime.UTC(), Size: fi.Size()}
+	}
+	if h.includes {
+		// page changes along with included documents, so they have to be
+		// found before the document is rendered
+		src, err := h.readSource(file)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		var included []string
+		l.src, included = mdrender.ExpandIncludes(h.fsys, file, src)
+		for _, name := range included {
+			if st, err := fs.Stat(h.fsys, name); err == nil && st.ModTime().After(mtime) {
+				mtime = st.ModTime()
+			}
+		}
+	}
+	l.sidebar = h.findUp(l.file, navFiles...)
+	l.header = h.findUp(l.file, "_Header.md")
+	l.footer = h.findUp(l.file, "_Footer.md")
+	if h.glossary {
+		l.glossary = h.findUp(l.file, glossaryFile)
+	}
+	if h.dirThemes {
+		l.dirStyle = h.findUp(l.file, dirStyleFile)
+		l.dirTpl = h.findUp(l.file, dirTemplateFile)
+	}
+	// page embeds stylesheet and navigation documents, so it changes along
+	// with them
+	for _, name := range []string{l.sidebar, l.header, l.footer, l.glossary, l.dirStyle, l.dirTpl} {
+		if name == "" {
+			continue
+		}
+		if st, err := fs.Stat(h.fsys, name); err == nil && st.ModTime().After(mtime) {
+			mtime = st.ModTime()
+		}
+	}
+	if st := h.theme().styleTime; st.After(mtime) {
+		mtime = st
+	}
+	if h.pageNav {
+		l.prev, l.next = h.pageNeighbours(l.file)
+	}
+	if h.backlinks {
+		h.graph.update(h)
+		l.backlinks = h.graph.backlinks(l.file)
+		// page also depends on documents referencing it
+		for _, link := range l.backlinks {
+			if st, err := fs.Stat(h.fsys, link.File); err == nil && st.ModTime().After(mtime) {
+				mtime = st.ModTime()
+			}
+		}
+	}
+	return l, mtime, nil
+}
+
+// pageHead holds fields common for all page templates, the ones "head" and
+// "logo" templates of headTpl use
+type pageHead struct {
+	Title     string
+	Root      string // prefix of root-relative links
+	StyleHref string
+	Style     template.CSS
+	CustomCSS bool
+	ThemeCSS  bool   // link stylesheet selected from Options.Themes
+	Favicon   string // /_assets/ name of Options.Favicon, if any
+	Logo      string // /_assets/ name of Options.Logo, if any
+}
+
+// pageHead returns pageHead of page with a given title, linking or embedding
+// stylesheet of the current theme.
+func (h *Handler) pageHead(title string) pageHead {
+	head := pageHead{
+		Title:     title,
+		Root:      h.base + "/",
+		CustomCSS: h.customCSS,
+		ThemeCSS:  h.styles != nil,
+		Favicon:   h.favicon,
+		Logo:      h.logo,
+	}
+	switch th := h.theme(); {
+	case h.linkStyle:
+		head.StyleHref = h.rootHref(th.style)
+	default:
+		head.Style = template.CSS(th.style)
+	}
+	return head
+}
+
+// pageData is the data pageTemplate is executed with
+type pageData struct {
+	pageHead
+	Canonical string // absolute URL of the page, if known
+	Summary   string // plain text description of the page, if any
+	IndexHref string
+	Href      func(file string) string // returns link to a document
+	CustomJS  bool
+	DirStyle  string // href of stylesheet from .mdserver directory, if any
+	Versions  []versionLink
+	Body      template.HTML
+	Sidebar   template.HTML
+	Outline   template.HTML // "On this page" links to document headings, if enabled
+	Header    template.HTML
+	Footer    template.HTML
+	Backlinks []graphLink
+	Prev      *graphLink
+	Next      *graphLink
+	Revision  *gitCommit
+	Info      *pageInfo // shown below document, if set
+	History   bool
+	Editable  bool
+	EditorURL template.URL // link opening document in editor, if any
+	WithHL    bool
+	Scripts   []string // additional scripts from /_assets/
+}
+
+// pageInfo describes document file in the footer of its page
+type pageInfo struct {
+	Modified time.Time
+	Size     int64
+	Commit   *gitCommit // the last commit changing document, if known
+}
+
+// SizeText returns human-readable document size, like "12.3 KB"
+func (p *pageInfo) SizeText() string {
+	switch {
+	case p.Size < 1<<10:
+		return strconv.FormatInt(p.Size, 10) + " bytes"
+	case p.Size < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(p.Size)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MB", float64(p.Size)/(1<<20))
+}
+
+type lazyReadSeeker struct {
+	file      string     // path in h.fsys
+	src       []byte     // document source, read from file if nil
+	revision  *gitCommit // set if src is a past revision of file
+	info      *pageInfo  // document file details for page footer, if enabled
+	offline   bool       // render for offline copy, see docHref
+	canonical string     // absolute URL of the page, if known
+	sidebar   string     // navigation document path in h.fsys, if any
+	header    string     // document rendered above page body, if any
+	footer    string     // document rendered below page body, if any
+	glossary  string     // glossary document path in h.fsys, if any
+	dirStyle  string     // stylesheet from the nearest .mdserver directory, if any
+	dirTpl    string     // page template from the nearest .mdserver directory, if any
+	h         *Handler
+	backlinks []graphLink
+	prev      *graphLink    // previous document in reading order, if any
+	next      *graphLink    // next document in reading order, if any
+	r         *bytes.Reader // initially nil, initialized with init()
+}
+
+func (l *lazyReadSeeker) init() error {
+	if l.r != nil {
+		return nil
+	}
+	if testRun {
+		log.Print("lazyReadSeeker init()")
+	}
+	b := l.src
+	if b == nil {
+		var err error
+		if b, err = l.h.readDocument(l.file); err != nil {
+			return err
+		}
+	}
+	opts := l.h.renderOptions()
+	if l.offline {
+		opts.Transform = l.h.offlineLinks(l.file)
+	}
+	if l.h.checkLinks && l.revision == nil {
+		opts.Transform = l.h.brokenLinks(l.file, opts.Transform)
+	}
+	if l.glossary != "" && l.glossary != l.file {
+		opts.Glossary = l.h.readGlossary(l.glossary)
+	}
+	doc := mdrender.Render(b, opts)
+	body, title := doc.HTML, doc.Title
+	summary := mdrender.FrontMatterValue(doc.Meta, "description")
+	if summary == "" {
+		summary = shortenText(mdrender.Summary(doc.AST), summaryLength)
+	}
+	if title == "" {
+		title = nameToTitle(path.Base(l.file))
+	}
+	withHL := l.h.hljs && bytes.Contains(body, []byte(`<pre><code class=`))
+	page := pageData{
+		pageHead:  l.h.pageHead(title),
+		Canonical: l.canonical,
+		Summary:   summary,
+		IndexHref: l.h.base + "/?index",
+		Href:      func(file string) string { return l.h.docHref(l.file, file, "", l.offline) },
+		Body:      template.HTML(body),
+		WithHL:    withHL,
+		Backlinks: l.backlinks,
+		Prev:      l.prev,
+		Next:      l.next,
+		Revision:  l.revision,
+		Info:      l.info,
+		History:   l.h.history != nil && !l.offline,
+		Editable:  l.h.edit && l.revision == nil && !l.offline,
+		CustomJS:  l.h.customJS,
+	}
+	if l.offline {
+		page.Root = strings.Repeat("../", strings.Count(l.file, "/"))
+		page.IndexHref = page.Root + offlineIndex
+	} else {
+		if l.h.withSearch {
+			page.Scripts = append(page.Scripts, "mark.js")
+		}
+		if l.h.previews {
+			page.Scripts = append(page.Scripts, "preview.js")
+		}
+		if l.h.keys {
+			page.Scripts = append(page.Scripts, "keys.js")
+		}
+		if l.h.autoReload {
+			page.Scripts = append(page.Scripts, "reload.js")
+		}
+		if l.h.pwa {
+			page.Scripts = append(page.Scripts, "pwa.js")
+		}
+		if l.h.copyCode && bytes.Contains(body, []byte("<pre><code")) {
+			page.Scripts = append(page.Scripts, "copy.js")
+		}
+		if l.info != nil {
+			page.Scripts = append(page.Scripts, "pageinfo.js")
+		}
+	}
+	if l.h.outline {
+		if page.Outline = outlineHTML(outlineTree(mdrender.Headings(doc.AST))); page.Outline != "" && !l.offline {
+			page.Scripts = append(page.Scripts, "outline.js")
+		}
+	}
+	if l.info != nil && l.h.history != nil {
+		if c, err := l.h.history.lastCommit(l.file); err == nil {
+			l.info.Commit = &c
+		}
+	}
+	if l.h.editorURL != "" && l.revision == nil && !l.offline {
+		page.EditorURL = l.h.editorHref(l.file)
+	}
+	if len(l.h.versions) != 0 {
+		page.Versions = l.h.versionLinks(l.file, l.offline)
+	}
+	if l.sidebar != "" && l.sidebar != l.file {
+		page.Sidebar = l.h.renderPartial(l.sidebar, l.file, l.offline)
+	}
+	if l.header != "" && l.header != l.file {
+		page.Header = l.h.renderPartial(l.header, l.file, l.offline)
+	}
+	if l.footer != "" && l.footer != l.file {
+		page.Footer = l.h.renderPartial(l.footer, l.file, l.offline)
+	}
+	th := l.h.theme()
+	if l.h.linkStyle && l.offline {
+		page.StyleHref = page.Root + strings.TrimPrefix(th.style, "/")
+	}
+	if l.dirStyle != "" {
+		page.DirStyle = page.Root + l.dirStyle
+	}
+	tpl := th.template(pageTemplate)
+	if l.dirTpl != "" {
+		if t := l.h.dirTemplate(l.dirTpl); t != nil {
+			tpl = t
+		}
+	}
+	buf := bytes.NewBuffer(b[:0]) // reuse b to reduce allocations
+	if err := tpl.Execute(buf, page); err != nil {
+		return err
+	}
+	l.r = bytes.NewReader(buf.Bytes())
+	return nil
+}
+
+// errTooLarge is returned for documents larger than Options.MaxSize
+var errTooLarge = errors.New("document is too large to render")
+
+// checkSize returns error wrapping errTooLarge if document described by fi is
+// larger than Options.MaxSize.
+func (h *Handler) checkSize(fi fs.FileInfo) error {
+	if h.maxSize > 0 && fi.Size() > h.maxSize {
+		return fmt.Errorf("%w: %s is %d bytes, limit is %d", errTooLarge, fi.Name(), fi.Size(), h.maxSize)
+	}
+	return nil
+}
+
+// readDocument reads markdown document file, failing with error wrapping
+// errTooLarge if it's larger than Options.MaxSize. With Options.Includes,
+// include directives of returned document are expanded.
+func (h *Handler) readDocument(file string) ([]byte, error) {
+	b, err := h.readSource(file)
+	if err != nil || !h.includes {
+		return b, err
+	}
+	b, _ = mdrender.ExpandIncludes(h.fsys, file, b)
+	return b, nil
+}
+
+// readSource is readDocument without expanding include directives.
+func (h *Handler) readSource(file string) ([]byte, error) {
+	f, err := h.fsys.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.checkSize(fi); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+// render renders markdown document to sanitized html. Title of returned
+// document is empty if document has neither front matter title, nor h1
+// header.
+func (h *Handler) render(b []byte) *mdrender.Document {
+	return mdrender.Render(b, h.renderOptions())
+}
+
+// renderOptions returns options documents are rendered with
+func (h *Handler) renderOptions() mdrender.Options {
+	opts := mdrender.Options{
+		GithubWiki:      h.githubWiki,
+		Emoji:           h.emoji,
+		Rewrite:         h.rewrite,
+		ExternalLinks:   h.external,
+		ExternalTab:     h.newTab,
+		HeadingIDPrefix: h.idPrefix,
+	}
+	if h.wikiLinks {
+		opts.WikiLinks = h.wikiLinkResolver()
+	}
+	if h.base != "" {
+		opts.Transform = h.baseLinks
+	}
+	return opts
+}
+
+// rootHref returns href of root-relative path p, like "/_assets/toc.js", with
+// Options.BaseURL prefix.
+func (h *Handler) rootHref(p string) string { return h.base + "/" + strings.TrimPrefix(p, "/") }
+
+// withPath returns shallow copy of r with URL path set to p
+func withPath(r *http.Request, p string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path, r2.URL.RawPath = p, ""
+	return r2
+}
+
+func (l *lazyReadSeeker) Read(p []byte) (n int, err error) {
+	if l.r == nil {
+		if err := l.init(); err != nil {
+			return 0, err
+		}
+	}
+	return l.r.Read(p)
+}
+
+func (l *lazyReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	if l.r == nil {
+		if err := l.init(); err != nil {
+			return 0, err
+		}
+	}
+	return l.r.Seek(offset, whence)
+}
+
+// dirIndex returns index of all markdown documents found in fsys. If pat is
+// not nil, only documents matching pattern are returned; if tag is not empty,
+// only documents carrying this tag are returned.
+func (h *Handler) dirIndex(pat *search.Pattern, tag string) []indexRecord {
+	fsys := h.fsys
+	type match struct {
+		name  string
+		mtime time.Time
+		size  int64
+	}
+	var matches []match
+	fn := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != "." && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		if _, ok := h.converter(p); d.IsDir() || !h.isDocument(p) && !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		matches = append(matches, match{name: p, mtime: info.ModTime(), size: info.Size()})
+		return nil
+	}
+	if err := fs.WalkDir(fsys, ".", fn); err != nil {
+		log.Printf("walk: %v", err)
+	}
+	seen := make(map[string]struct{}, len(matches))
+	for _, m := range matches {
+		seen[m.name] = struct{}{}
+	}
+	h.meta.prune(seen)
+	// documents are read and parsed by a pool of workers, each filling
+	// results at indexes of the matches it handles, so order is preserved
+	type result struct {
+		ok   bool
+		meta docMeta
+	}
+	results := make([]result, len(matches))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := runtime.GOMAXPROCS(0); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				m := matches[i]
+				if pat != nil && !matchPattern(pat, fsys, m.name) {
+					continue
+				}
+				meta := h.meta.get(h, m.name, m.mtime, m.size)
+				if tag != "" && !hasTag(meta.tags, tag) {
+					continue
+				}
+				results[i] = result{ok: true, meta: meta}
+			}
+		}()
+	}
+	for i := range matches {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	var index []indexRecord
+	if pat == nil && tag == "" {
+		index = make([]indexRecord, 0, len(matches))
+	}
+	for i, m := range matches {
+		if !results[i].ok {
+			continue
+		}
+		s, meta := m.name, results[i].meta
+		title := meta.title
+		if title == "" {
+			title = nameToTitle(path.Base(s))
+		}
+		index = append(index, indexRecord{
+			Title:   title,
+			Tags:    meta.tags,
+			Words:   meta.words,
+			File:    s,
+			ModTime: m.mtime,
+			Size:    m.size,
+			Subdir:  path.Dir(s),
+			// precalculate sort key to speed up comparisons on sort
+			sortKey: strings.ToLower(h.trimExt(path.Base(s))),
+		})
+	}
+	sortIndex(index)
+	return index
+}
+
+// sortIndex sorts index records by subdirectory, then by file name
+func sortIndex(index []indexRecord) {
+	sort.Slice(index, func(i, j int) bool {
+		si, sj := index[i].Subdir, index[j].Subdir
+		if si == sj {
+			return index[i].sortKey < index[j].sortKey
+		}
+		return si < sj
+	})
+}
+
+type indexRecord struct {
+	Title, File string
+	Tags        []string
+	ModTime     time.Time
+	Size        int64
+	Words       int    // number of words, zero if unknown
+	Subdir      string // groups index records when rendering template
+	sortKey     string // if File is "dir/FileName.md", then sortKey is "filename"
+}
+
+// ReadingTime returns estimated time to read document in minutes, assuming
+// 200 words per minute.
+func (rec indexRecord) ReadingTime() int { return (rec.Words + 199) / 200 }
+
+// docMeta holds metadata of markdown document
+type docMeta struct {
+	mtime time.Time
+	size  int64
+	title string // front matter "title" value, or the first h1 header text
+	tags  []string
+	words int // zero if document is too large to be read whole
+}
+
+// docCache caches metadata of documents, so they're only read again if they
+// change.
+type docCache struct {
+	mu sync.Mutex
+	m  map[string]docMeta
+}
+
+// get returns metadata of document file with given modification time and
+// size, reading it from h.fsys if it's not cached.
+func (c *docCache) get(h *Handler, file string, mtime time.Time, size int64) docMeta {
+	c.mu.Lock()
+	meta, ok := c.m[file]
+	c.mu.Unlock()
+	if ok && meta.mtime.Equal(mtime) && meta.size == size {
+		return meta
+	}
+	meta = h.documentMeta(file)
+	meta.mtime, meta.size = mtime, size
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]docMeta)
+	}
+	c.m[file] = meta
+	return meta
+}
+
+// prune removes cached metadata of documents other than the ones in keep.
+func (c *docCache) prune(keep map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for file := range c.m {
+		if _, ok := keep[file]; !ok {
+			delete(c.m, file)
+		}
+	}
+}
+
+// documentMeta extracts title, tags and number of words from markdown
+// document. Title is taken from front matter "title" key, or from the first h1
+// header. If document is larger than Options.MaxSize, only its beginning is
+// read to find title and tags, and number of words is not counted.
+func (h *Handler) documentMeta(file string) docMeta {
+	if args, ok := h.converter(file); ok {
+		b, err := h.convert(file, args)
+		if err != nil {
+			log.Printf("convert %q: %v", file, err)
+			return docMeta{}
+		}
+		title, words := htmlTitle(b)
+		return docMeta{title: title, words: words}
+	}
+	b, err := h.readDocument(file)
+	if errors.Is(err, errTooLarge) {
+		f, err := h.fsys.Open(file)
+		if err != nil {
+			return docMeta{}
+		}
+		defer f.Close()
+		if b, err = ioutil.ReadAll(io.LimitReader(f, 1<<17)); err != nil {
+			return docMeta{}
+		}
+		meta, body := mdrender.FrontMatter(b)
+		return docMeta{title: mdrender.DocumentTitle(b), tags: documentTags(meta, body)}
+	}
+	if err != nil {
+		return docMeta{}
+	}
+	meta, body := mdrender.FrontMatter(b)
+	doc := mdrender.NewParser().Parse(body)
+	title := mdrender.FrontMatterValue(meta, "title")
+	if title == "" {
+		title = mdrender.Title(doc)
+	}
+	return docMeta{title: title, tags: documentTags(meta, body), words: mdrender.Words(doc)}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, s := range tags {
+		if s == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether any line in file matches given pattern. On any
+// errors function return false.
+func matchPattern(pat *search.Pattern, fsys fs.FS, file string) bool {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(io.LimitReader(f, 1<<20))
+	for sc.Scan() {
+		if _, end := pat.Index(sc.Bytes()); end > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayFS is a fs.FS serving files from optional directory dir, falling back
+// to base fs.FS for files missing in dir.
+type overlayFS struct {
+	dir  string
+	base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if o.dir != "" {
+		if f, err := os.DirFS(o.dir).Open(name); err == nil {
+			return f, nil
+		}
+	}
+	return o.base.Open(name)
+}
+
+var builtinAssetsFS = func() fs.FS {
+	fsys, err := fs.Sub(builtinAssets, "assets")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}()
+
+func isRegularFile(name string) bool {
+	st, err := os.Stat(name)
+	return err == nil && st.Mode().IsRegular()
+}
+
+// isIDPrefix reports whether s is a valid Options.HeadingIDPrefix, which
+// needs no escaping in id attributes and fragment links.
+var isIDPrefix = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`).MatchString
+
+// isRegularFileFS reports whether name is a regular file in fsys.
+func isRegularFileFS(fsys fs.FS, name string) bool {
+	st, err := fs.Stat(fsys, name)
+	return err == nil && st.Mode().IsRegular()
+}
+
+// fsPath converts /-separated URL path p to a name valid for fs.FS.
+func fsPath(p string) string {
+	if p = strings.TrimPrefix(path.Clean("/"+p), "/"); p == "" {
+		return "."
+	}
+	return p
+}
+
+// summaryLength is the maximum length of page description in runes, so
+// previews of links to pages stay short
+const summaryLength = 200
+
+// shortenText returns s cut at the last space before n runes, with ellipsis
+// appended, or s itself if it is short enough.
+func shortenText(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)[:n]
+	if i := strings.LastIndexByte(string(r), ' '); i > 0 {
+		return strings.TrimRight(string(r)[:i], " ,;:.") + "…"
+	}
+	return string(r) + "…"
+}
+
+// nameToTitle returns title for document file name: "Page-Name.md" becomes
+// "Page Name". Name is normalized to NFC form, as file names on some systems
+// are stored decomposed, i.e. with "é" written as "e" followed by a combining
+// accent.
+func nameToTitle(name string) string {
+	name = norm.NFC.String(strings.TrimSuffix(name, path.Ext(name)))
+	if strings.ContainsAny(name, " ") {
+		return name
+	}
+	return repl.Replace(name)
+}
+
+var repl = strings.NewReplacer("-", " ")
+
+const mdSuffix = ".md"
+
+// isDocument reports whether file name has one of Options.Extensions
+func (h *Handler) isDocument(name string) bool {
+	_, ok := h.docExt(name)
+	return ok
+}
+
+// docExt returns extension of document file name if it's one of
+// Options.Extensions.
+func (h *Handler) docExt(name string) (string, bool) {
+	for _, ext := range h.extensions() {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// trimExt returns file name without document extension
+func (h *Handler) trimExt(name string) string {
+	ext, _ := h.docExt(name)
+	return strings.TrimSuffix(name, ext)
+}
+
+// extensions returns Options.Extensions, or the default ".md" one
+func (h *Handler) extensions() []string {
+	if len(h.exts) == 0 {
+		return []string{mdSuffix}
+	}
+	return h.exts
+}
+
+// parseTemplate parses page template text, making templates of headTpl
+// available to it.
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(headTpl)
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(text)
+}
+
+// headTpl defines templates shared by all pages: "head" links stylesheets
+// and icon, "logo" is a link to the root page with Options.Logo image. Both
+// are executed with pageHead fields.
+const headTpl = `{{define "head"}}{{if .StyleHref}}<link rel="stylesheet" href="{{.StyleHref}}">{{end -}}
+{{if .Style}}<style>{{.Style}}</style>{{end}}
+{{- with .Favicon}}<link rel="icon" href="{{$.Root}}_assets/{{.}}">{{end}}
+{{- if .ThemeCSS}}<link rel="stylesheet" href="{{.Root}}_assets/theme.css">{{end}}
+{{- if .CustomCSS}}<link rel="stylesheet" href="{{.Root}}_assets/custom.css">{{end}}{{end}}
+{{define "logo"}}{{with .Logo}}<a id="logo" href="{{$.Root}}"><img src="{{$.Root}}_assets/{{.}}" alt="Home"></a>{{end}}{{end}}
+`
+
+var indexTemplate = template.Must(parseTemplate("index", indexTpl))
+var pageTemplate = template.Must(parseTemplate("page", pageTpl))
+var tagsTemplate = template.Must(parseTemplate("tags", tagsTpl))
+
+const indexTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{template "head" .}}
+<script src="{{.Root}}_assets/filter.js"></script>{{range .Scripts}}
+<script src="{{$.Root}}_assets/{{.}}"></script>{{end}}</head><body id="mdserver-autoindex">{{with .Logo}}<nav id="site">{{template "logo" $}}</nav>{{end}}{{if .WithSearch}}<form method="get">
+<input type="search" name="q" value="{{.Query}}" minlength="3" placeholder="Substring search" autofocus required>
+<input type="submit"></form>{{end}}
+<h1>{{.Title}}</h1>{{with .Pager}}<form method="get" id="filter"><input type="hidden" name="index" value="{{.View}}">
+<input type="search" name="filter" value="{{.Filter}}" placeholder="Filter by title or name"></form>
+<nav id="letters">{{if .Letters}}{{range .Letters}}<a href="#letter-{{.}}">{{.}}</a> {{end}}<a href="{{$.Root}}?index">by directory</a>
+{{- else}}<a href="{{$.Root}}?index=az">A–Z</a>{{end}}</nav>{{end}}<ul>{{$prev := "."}}{{$az := and .Pager .Pager.Letters}}
+{{range .Index}}{{if ne .Subdir $prev}}{{$prev = .Subdir}}</ul><h2{{if $az}} id="letter-{{.Subdir}}"{{end}}>{{.Subdir}}</h2><ul>{{end}}<li><a href="{{.File}}{{with $.Query}}?q={{.}}{{end}}">{{.Title}}</a>
+{{- if .Words}} <small class="meta" title="{{.Words}} words">{{.ReadingTime}}&nbsp;min</small>{{end}}
+{{- with .Tags}} <small class="tags">{{range .}}<a href="{{$.Root}}?tag={{.}}">#{{.}}</a> {{end}}</small>{{end}}</li>
+{{end}}</ul>{{with .Pager}}{{if gt .Pages 1}}
+<nav id="pages">{{with .PrevHref}}<a href="{{.}}" rel="prev">&larr; previous</a> {{end}}page {{.Page}} of {{.Pages}}
+{{- with .NextHref}} <a href="{{.}}" rel="next">next &rarr;</a>{{end}}</nav>{{end}}{{end}}</body>
+`
+
+const tagsTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{template "head" .}}</head><body id="mdserver-tags">
+<nav id="site">{{template "logo" .}}<a href="{{.Root}}?index">index</a></nav>
+<h1>{{.Title}}</h1><ul>
+{{range .Tags}}<li><a href="{{$.Root}}?tag={{.Name}}">{{.Name}}</a> ({{.Count}})</li>
+{{end}}</ul></body>
+`
+
+const pageTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{with .Summary}}<meta name="description" content="{{.}}">
+{{end}}{{with .Canonical}}<link rel="canonical" href="{{.}}">
+<meta property="og:type" content="article"><meta property="og:url" content="{{.}}"><meta property="og:title" content="{{$.Title}}">
+{{- with $.Summary}}<meta property="og:description" content="{{.}}">{{end}}<meta name="twitter:card" content="summary">
+{{end}}{{template "head" .}}
+{{- with .DirStyle}}<link rel="stylesheet" href="{{.}}">{{end}}
+<script src="{{.Root}}_assets/toc.js"></script>{{range .Scripts}}
+<script src="{{$.Root}}_assets/{{.}}"></script>{{end}}{{if .WithHL}}
+<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/styles/default.min.css" integrity="sha256-zcunqSn1llgADaIPFyzrQ8USIjX2VpuxHzUwYisOwo8=" crossorigin="anonymous" referrerpolicy="no-referrer">
+<script src="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/highlight.min.js" integrity="sha256-aYTdUrn6Ow1DDgh5JTc3aDGnnju48y/1c8s1dgkYPQ8=" crossorigin="anonymous" referrerpolicy="no-referrer"></script>
+<script src="{{.Root}}_assets/hljs.js"></script>{{end}}{{if .CustomJS}}
+<script src="{{.Root}}_assets/custom.js"></script>{{end}}
+</head><body><nav id="site">{{template "logo" .}}{{with .Versions}}<details id="versions"><summary>{{range .}}{{if .Current}}{{.Name}}{{end}}{{end}}</summary><ul>
+{{range .}}<li><a href="{{.Href}}"{{if .Current}} class="current"{{else if .Missing}} class="missing" title="No such page in this version"{{end}}>{{.Name}}</a></li>
+{{end}}</ul></details>{{end}}{{if .Editable}}<a href="?edit">edit</a> {{end}}{{with .EditorURL}}<a href="{{.}}" title="Open source file in editor">{{if $.Editable}}editor{{else}}edit{{end}}</a> {{end}}{{if .History}}<a href="?history">history</a> {{end}}<a href="{{.IndexHref}}">index</a></nav>
+{{with .Sidebar}}<aside id="sidebar">
+{{.}}
+</aside>{{end}}
+{{with .Outline}}<nav id="outline"><details open><summary>On this page</summary>
+{{.}}
+</details></nav>{{else}}<nav id="toc"><details open><summary>Contents</summary></details></nav>{{end}}
+<ul id="toc"></ul>{{with .Header}}
+<header id="page-header">
+{{.}}
+</header>{{end}}
+{{with .Revision}}<p id="revision">Revision <code>{{.Short}}</code> of {{.Date.Format "2006-01-02 15:04"}}
+by {{.Author}}: {{.Subject}}. <a href="?">Current version</a>.</p>
+{{end}}<article>
+{{.Body}}
+</article>{{with .Footer}}
+<footer id="page-footer">
+{{.}}
+</footer>{{end}}{{with .Info}}
+<footer id="page-info">Updated <time datetime="{{.Modified.Format "2006-01-02T15:04:05Z"}}">{{.Modified.Format "2006-01-02 15:04"}}</time>, {{.SizeText}}
+{{- with .Commit}}; last commit by {{.Author}}: {{.Subject}}{{end}}</footer>{{end}}{{if or .Prev .Next}}
+<nav id="pagenav">{{with .Prev}}<a href="{{call $.Href .File}}" rel="prev">&larr; {{.Title}}</a>{{end}}
+{{with .Next}}<a href="{{call $.Href .File}}" rel="next">{{.Title}} &rarr;</a>{{end}}</nav>{{end}}{{with .Backlinks}}
+<footer id="backlinks"><details open><summary>Referenced by</summary><ul>
+{{range .}}<li><a href="{{call $.Href .File}}">{{.Title}}</a></li>
+{{end}}</ul></details></footer>{{end}}</body>
+`
+
+func containsDotDot(v string) bool {
+	if !strings.Contains(v, "..") {
+		return false
+	}
+	for _, ent := range strings.FieldsFunc(v, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if ent == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// style is the default stylesheet embedded into every page
+//
+//go:embed assets/style.css
+var style string
+
+// builtinAssets holds files served under /_assets/ unless overridden by files
+// from Options.Assets directory
+//
+//go:embed assets
+var builtinAssets embed.FS
+
+var testRun bool // used in tests
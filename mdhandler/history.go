@@ -0,0 +1,313 @@
+package mdhandler
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gitHistory gives access to past revisions of documents kept in a git
+// repository.
+type gitHistory struct {
+	repo   string // repository (or work tree) directory
+	ref    string // reference to take history from
+	prefix string // path of served directory inside repository, "" or ends with /
+}
+
+// newGitHistory returns gitHistory for directory dir if it is inside a git
+// work tree, or nil otherwise.
+func newGitHistory(dir string) *gitHistory {
+	if !gitAvailable() {
+		return nil
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--is-inside-work-tree", "--show-toplevel", "--show-prefix").Output()
+	if err != nil {
+		return nil
+	}
+	fields := strings.Split(string(out), "\n")
+	if len(fields) < 3 || fields[0] != "true" {
+		return nil
+	}
+	return &gitHistory{repo: fields[1], ref: "HEAD", prefix: fields[2]}
+}
+
+// gitAvailable reports whether git command, which document history relies
+// on, can be found.
+func gitAvailable() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+type gitCommit struct {
+	Hash, Author, Subject string
+	Date                  time.Time
+}
+
+// Short returns abbreviated commit hash
+func (c gitCommit) Short() string {
+	if len(c.Hash) > 10 {
+		return c.Hash[:10]
+	}
+	return c.Hash
+}
+
+const gitLogFormat = "--format=%H%x00%an%x00%at%x00%s"
+
+func (g *gitHistory) git(args ...string) ([]byte, error) { return runGit(g.repo, args...) }
+
+// runGit runs git command with args in repository repo and returns its
+// output. Returned error includes git error message, if any.
+func runGit(repo string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// log returns up to 200 most recent commits changing document file, newest
+// first.
+func (g *gitHistory) log(file string) ([]gitCommit, error) {
+	out, err := g.git("log", "-n", "200", "--follow", gitLogFormat, g.ref, "--", g.prefix+file)
+	if err != nil {
+		return nil, err
+	}
+	var commits []gitCommit
+	for _, line := range strings.Split(string(out), "\n") {
+		if c, ok := parseCommit(line); ok {
+			commits = append(commits, c)
+		}
+	}
+	return commits, nil
+}
+
+// lastCommit returns the most recent commit changing document file
+func (g *gitHistory) lastCommit(file string) (gitCommit, error) {
+	out, err := g.git("log", "-n", "1", gitLogFormat, g.ref, "--", g.prefix+file)
+	if err != nil {
+		return gitCommit{}, err
+	}
+	c, ok := parseCommit(strings.TrimSpace(string(out)))
+	if !ok {
+		return gitCommit{}, fmt.Errorf("no commits changing %s", file)
+	}
+	return c, nil
+}
+
+// commit returns details of a single commit
+func (g *gitHistory) commit(rev string) (gitCommit, error) {
+	out, err := g.git("show", "-s", gitLogFormat, rev+"^{commit}")
+	if err != nil {
+		return gitCommit{}, err
+	}
+	c, ok := parseCommit(strings.TrimSpace(string(out)))
+	if !ok {
+		return gitCommit{}, fmt.Errorf("unexpected git output: %q", out)
+	}
+	return c, nil
+}
+
+// show returns content of document file as of revision rev
+func (g *gitHistory) show(rev, file string) ([]byte, error) {
+	return g.git("cat-file", "blob", rev+":"+g.prefix+file)
+}
+
+// diffLine is a single line of word diff: either a hunk header, or a list of
+// unchanged, removed and added parts.
+type diffLine struct {
+	Hunk  string
+	Parts []diffPart
+}
+
+type diffPart struct {
+	Op   string // " " for unchanged text, "-" for removed, "+" for added
+	Text string
+}
+
+// diff returns word diff of document file between revisions from and to.
+func (g *gitHistory) diff(from, to, file string) ([]diffLine, error) {
+	out, err := g.git("diff", "--no-color", "--no-ext-diff", "--word-diff=porcelain", from, to, "--", g.prefix+file)
+	if err != nil {
+		return nil, err
+	}
+	var lines []diffLine
+	var cur diffLine
+	inHunk := false
+	for _, s := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(s, "@@"):
+			if len(cur.Parts) != 0 {
+				lines = append(lines, cur)
+			}
+			cur = diffLine{}
+			lines = append(lines, diffLine{Hunk: s})
+			inHunk = true
+		case !inHunk || s == "":
+		case s[0] == '~':
+			lines = append(lines, cur)
+			cur = diffLine{}
+		case s[0] == ' ' || s[0] == '-' || s[0] == '+':
+			cur.Parts = append(cur.Parts, diffPart{Op: s[:1], Text: s[1:]})
+		}
+	}
+	if len(cur.Parts) != 0 {
+		lines = append(lines, cur)
+	}
+	return lines, nil
+}
+
+func parseCommit(line string) (gitCommit, bool) {
+	fields := strings.SplitN(line, "\x00", 4)
+	if len(fields) != 4 {
+		return gitCommit{}, false
+	}
+	var sec int64
+	if _, err := fmt.Sscan(fields[2], &sec); err != nil {
+		return gitCommit{}, false
+	}
+	return gitCommit{Hash: fields[0], Author: fields[1], Date: time.Unix(sec, 0).UTC(), Subject: fields[3]}, true
+}
+
+// isRevision reports whether s looks like a (possibly abbreviated) commit
+// hash. Only hashes are accepted as revisions to keep arbitrary input away
+// from git command line.
+var isRevision = regexp.MustCompile(`^[0-9a-f]{4,64}$`).MatchString
+
+// serveHistory renders list of commits changing document with URL path p.
+func (h *Handler) serveHistory(w http.ResponseWriter, r *http.Request, p string) {
+	file := fsPath(p)
+	commits, err := h.history.log(file)
+	if err != nil {
+		log.Printf("history of %q: %v", file, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if len(commits) == 0 {
+		h.notFound(w, r)
+		return
+	}
+	type row struct {
+		gitCommit
+		Previous string // hash of the previous commit changing document
+	}
+	rows := make([]row, len(commits))
+	for i, c := range commits {
+		rows[i].gitCommit = c
+		if i < len(commits)-1 {
+			rows[i].Previous = commits[i+1].Hash
+		}
+	}
+	page := struct {
+		pageHead
+		File    string
+		Commits []row
+	}{
+		pageHead: h.pageHead("History of " + file),
+		File:     path.Base(file),
+		Commits:  rows,
+	}
+	th := h.theme()
+	h.writeTemplate(w, r, http.StatusOK, th.template(historyTemplate), page)
+}
+
+// serveDiff renders word diff of document with URL path p between two
+// revisions given as "from..to".
+func (h *Handler) serveDiff(w http.ResponseWriter, r *http.Request, p, revs string) {
+	from, to, ok := strings.Cut(revs, "..")
+	if !ok || !isRevision(from) || !isRevision(to) {
+		http.Error(w, "invalid revisions, want diff=<commit>..<commit>", http.StatusBadRequest)
+		return
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	file := fsPath(p)
+	lines, err := h.history.diff(from, to, file)
+	if err != nil {
+		http.Error(w, "cannot compare these revisions", http.StatusNotFound)
+		return
+	}
+	page := struct {
+		pageHead
+		File     string
+		From, To string
+		Lines    []diffLine
+	}{
+		pageHead: h.pageHead("Changes of " + file),
+		File:     path.Base(file),
+		From:     from,
+		To:       to,
+		Lines:    lines,
+	}
+	th := h.theme()
+	h.writeTemplate(w, r, http.StatusOK, th.template(diffTemplate), page)
+}
+
+// serveRevision renders document with URL path p as of revision rev.
+func (h *Handler) serveRevision(w http.ResponseWriter, r *http.Request, p, rev string) {
+	if !isRevision(rev) {
+		http.Error(w, "invalid revision", http.StatusBadRequest)
+		return
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	file := fsPath(p)
+	commit, err := h.history.commit(rev)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := h.history.show(commit.Hash, file)
+	if err != nil {
+		h.notFound(w, r)
+		return
+	}
+	l := &lazyReadSeeker{file: file, src: b, revision: &commit, h: h}
+	h.setCSP(w, h.hljs)
+	h.preload(w)
+	http.ServeContent(w, r, "page.html", commit.Date, l)
+}
+
+var historyTemplate = template.Must(parseTemplate("history", historyTpl))
+
+const historyTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{template "head" .}}</head><body id="mdserver-history">
+<nav id="site">{{template "logo" .}}<a href="{{.File}}">document</a> <a href="{{.Root}}?index">index</a></nav>
+<h1>{{.Title}}</h1><table>
+<tr><th>Date</th><th>Author</th><th>Change</th><th></th></tr>
+{{range .Commits}}<tr><td><a href="?rev={{.Hash}}">{{.Date.Format "2006-01-02 15:04"}}</a></td><td>{{.Author}}</td><td>{{.Subject}}</td>
+<td>{{if .Previous}}<a href="?diff={{.Previous}}..{{.Hash}}">diff</a>{{end}}</td></tr>
+{{end}}</table></body>
+`
+
+var diffTemplate = template.Must(parseTemplate("diff", diffTpl))
+
+const diffTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{template "head" .}}</head><body id="mdserver-diff">
+<nav id="site">{{template "logo" .}}<a href="?history">history</a> <a href="{{.File}}">document</a> <a href="{{.Root}}?index">index</a></nav>
+<h1>{{.Title}}</h1>
+<p>From <a href="?rev={{.From}}"><code>{{.From}}</code></a> to <a href="?rev={{.To}}"><code>{{.To}}</code></a></p>
+<pre class="diff">{{range .Lines}}{{if .Hunk}}<span class="hunk">{{.Hunk}}</span>
+{{else}}{{range .Parts}}{{if eq .Op "-"}}<del>{{.Text}}</del>{{else if eq .Op "+"}}<ins>{{.Text}}</ins>{{else}}{{.Text}}{{end}}{{end}}
+{{end}}{{else}}No changes{{end}}</pre></body>
+`
@@ -0,0 +1,54 @@
+package mdhandler
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// otherLetter groups documents which titles don't start with a letter
+const otherLetter = "#"
+
+// byLetter sorts index by document titles and sets Subdir of each record to
+// the first letter of its title, uppercased and without diacritics, so index
+// is grouped by letters when rendered. It returns sorted index and the list
+// of letters in order. Titles not starting with a letter are grouped under
+// "#", which goes first.
+func byLetter(index []indexRecord) ([]indexRecord, []string) {
+	c := collate.New(language.Und, collate.Loose)
+	for i := range index {
+		index[i].Subdir = titleLetter(index[i].Title)
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		a, b := index[i], index[j]
+		if a.Subdir != b.Subdir && (a.Subdir == otherLetter || b.Subdir == otherLetter) {
+			return a.Subdir == otherLetter
+		}
+		if n := c.CompareString(a.Subdir, b.Subdir); n != 0 {
+			return n < 0
+		}
+		return c.CompareString(a.Title, b.Title) < 0
+	})
+	var letters []string
+	for _, rec := range index {
+		if len(letters) == 0 || letters[len(letters)-1] != rec.Subdir {
+			letters = append(letters, rec.Subdir)
+		}
+	}
+	return index, letters
+}
+
+// titleLetter returns uppercased first letter of title without diacritics,
+// or otherLetter if title doesn't start with a letter.
+func titleLetter(title string) string {
+	r, _ := utf8.DecodeRuneInString(norm.NFD.String(strings.TrimSpace(title)))
+	if !unicode.IsLetter(r) {
+		return otherLetter
+	}
+	return string(unicode.ToUpper(r))
+}
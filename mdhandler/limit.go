@@ -0,0 +1,38 @@
+package mdhandler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// renderWait is how long request waits for a free render slot if number of
+// concurrent renders is limited with Options.MaxRenders
+const renderWait = time.Second
+
+// renderSlot takes one of Options.MaxRenders slots for rendering a page,
+// waiting for up to renderWait for one to free up. If none does, it responds
+// with 503 status and returns false. Otherwise caller must call release once
+// page is written.
+func (h *Handler) renderSlot(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	if h.renders == nil {
+		return func() {}, true
+	}
+	select {
+	case h.renders <- struct{}{}:
+		return func() { <-h.renders }, true
+	default:
+	}
+	t := time.NewTimer(renderWait)
+	defer t.Stop()
+	select {
+	case h.renders <- struct{}{}:
+		return func() { <-h.renders }, true
+	case <-r.Context().Done():
+		return nil, false
+	case <-t.C:
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(renderWait/time.Second)))
+	http.Error(w, "Server is busy, try again later", http.StatusServiceUnavailable)
+	return nil, false
+}
@@ -0,0 +1,198 @@
+package mdhandler
+
+import (
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artyom/mdserver/mdrender"
+)
+
+// linkGraph keeps track of links between documents of a directory. It is
+// updated incrementally: only documents changed since the last update are
+// parsed again.
+type linkGraph struct {
+	mu   sync.Mutex
+	docs map[string]*graphNode // keyed by /-separated path relative to dir
+}
+
+type graphNode struct {
+	mtime time.Time
+	size  int64
+	title string
+	links []string // /-separated paths relative to dir, without fragments
+}
+
+// graphLink is a reference to a document
+type graphLink struct {
+	Title, File string
+}
+
+// update walks directory and refreshes graph to reflect its current state.
+func (g *linkGraph) update(h *Handler) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.docs == nil {
+		g.docs = make(map[string]*graphNode)
+	}
+	opts := mdrender.Options{Rewrite: h.rewrite}
+	seen := make(map[string]struct{}, len(g.docs))
+	fn := func(rel string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && rel != "." && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !h.isDocument(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		seen[rel] = struct{}{}
+		if n, ok := g.docs[rel]; ok && n.mtime.Equal(info.ModTime()) && n.size == info.Size() {
+			return nil
+		}
+		b, err := h.readDocument(rel)
+		if err != nil {
+			delete(g.docs, rel)
+			return nil
+		}
+		if h.wikiLinks && opts.WikiLinks == nil {
+			opts.WikiLinks = h.wikiLinkResolver()
+		}
+		doc := mdrender.Parse(b, opts)
+		n := &graphNode{mtime: info.ModTime(), size: info.Size(), title: doc.Title}
+		if n.title == "" {
+			n.title = nameToTitle(path.Base(rel))
+		}
+		for _, dst := range mdrender.Links(doc.AST) {
+			if h.githubWiki {
+				if s, ok := mdrender.GithubWikiLink(dst); ok {
+					dst = s
+				}
+			}
+			if target, ok := resolveLink(rel, dst); ok && target != rel {
+				n.links = append(n.links, target)
+			}
+		}
+		g.docs[rel] = n
+		return nil
+	}
+	_ = fs.WalkDir(h.fsys, ".", fn)
+	for k := range g.docs {
+		if _, ok := seen[k]; !ok {
+			delete(g.docs, k)
+		}
+	}
+}
+
+// backlinks returns documents linking to document file, sorted by title.
+func (g *linkGraph) backlinks(file string) []graphLink {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var out []graphLink
+	for name, n := range g.docs {
+		for _, s := range n.links {
+			if s == file {
+				out = append(out, graphLink{Title: n.title, File: name})
+				break
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Title < out[j].Title })
+	return out
+}
+
+// orphans returns documents not referenced by any other document
+func (g *linkGraph) orphans() []indexRecord {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	referenced := g.referenced()
+	var out []indexRecord
+	for name, n := range g.docs {
+		if _, ok := referenced[name]; ok {
+			continue
+		}
+		out = append(out, graphRecord(name, n.title))
+	}
+	sortIndex(out)
+	return out
+}
+
+// unusedImages walks fsys and returns image files not referenced by any
+// document
+func (g *linkGraph) unusedImages(fsys fs.FS) []indexRecord {
+	g.mu.Lock()
+	referenced := g.referenced()
+	g.mu.Unlock()
+	var out []indexRecord
+	fn := func(rel string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && rel != "." && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !imageExts[strings.ToLower(path.Ext(rel))] {
+			return nil
+		}
+		if _, ok := referenced[rel]; !ok {
+			out = append(out, graphRecord(rel, path.Base(rel)))
+		}
+		return nil
+	}
+	_ = fs.WalkDir(fsys, ".", fn)
+	sortIndex(out)
+	return out
+}
+
+// referenced returns set of all link targets; g.mu must be held
+func (g *linkGraph) referenced() map[string]struct{} {
+	out := make(map[string]struct{})
+	for _, n := range g.docs {
+		for _, s := range n.links {
+			out[s] = struct{}{}
+		}
+	}
+	return out
+}
+
+func graphRecord(file, title string) indexRecord {
+	return indexRecord{
+		Title:   title,
+		File:    file,
+		Subdir:  path.Dir(file),
+		sortKey: strings.ToLower(strings.TrimSuffix(path.Base(file), path.Ext(file))),
+	}
+}
+
+var imageExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true,
+	".svg": true, ".webp": true, ".avif": true, ".bmp": true, ".ico": true,
+}
+
+// resolveLink resolves link destination dst found in document doc to a path
+// relative to served directory. It returns false for external links and links
+// pointing outside of served directory.
+func resolveLink(doc, dst string) (string, bool) {
+	u, err := url.Parse(dst)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join("/", path.Dir(doc), p)
+	}
+	p = path.Clean(p)
+	if p == "/" {
+		return "", false
+	}
+	return strings.TrimPrefix(p, "/"), true
+}
@@ -0,0 +1,1651 @@
+package mdhandler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/artyom/httpgzip"
+	"github.com/artyom/mdserver/mdrender"
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+)
+
+func TestLazyRendering(t *testing.T) {
+	srv := httptest.NewServer(&Handler{dir: "testdata", fsys: os.DirFS("testdata")})
+	defer srv.Close()
+	logBuf := new(bytes.Buffer)
+	log.SetOutput(logBuf)
+	r, err := http.Get(srv.URL + "/hello.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != http.StatusOK {
+		t.Fatalf("invalid status on first call, want 200, got: %q", r.Status)
+	}
+	if _, err := io.Copy(ioutil.Discard, r.Body); err != nil {
+		t.Fatal(err)
+	}
+	lastmod := r.Header.Get("Last-Modified")
+	if lastmod == "" {
+		t.Fatalf("no or empty Last-Modified header; response headers are:\n%v", r.Header)
+	}
+	r.Body.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/hello.md", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-Modified-Since", lastmod)
+	r, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != http.StatusNotModified {
+		t.Fatalf("unexpected status on second call, want 304, got: %q", r.Status)
+	}
+	defer r.Body.Close()
+	if cnt := strings.Count(logBuf.String(), "lazyReadSeeker init()"); cnt != 1 {
+		t.Fatalf("want 1 logged lazyReadSeeker init call, got %d; full log:\n%s", cnt, logBuf.String())
+	}
+}
+
+func init() { testRun = true }
+
+func TestDocumentTags(t *testing.T) {
+	table := []struct {
+		doc  string
+		want []string
+	}{
+		{"# Title\n\nText", nil},
+		{"---\ntitle: Doc\ntags: [Go, http]\n---\n# Title\n", []string{"go", "http"}},
+		{"---\ntags:\n  - one\n  - two\nauthor: me\n---\nTags: ignored\n", []string{"one", "two"}},
+		{"# Title\n\nTags: #b, a, b\n", []string{"a", "b"}},
+		{"---\nnot closed\nkey: x\n", nil},
+	}
+	for _, tc := range table {
+		meta, body := mdrender.FrontMatter([]byte(tc.doc))
+		got := documentTags(meta, body)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("document %q: got tags %q, want %q", tc.doc, got, tc.want)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	srv := httptest.NewServer(httpgzip.New(&Handler{dir: "testdata", fsys: os.DirFS("testdata"), style: style}))
+	defer srv.Close()
+	for _, p := range []string{"/hello.md", "/?index"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		r, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status %q", p, r.Status)
+		}
+		if ce := r.Header.Get("Content-Encoding"); ce != "gzip" {
+			t.Errorf("%s: want gzip Content-Encoding, got %q", p, ce)
+		}
+		if v := r.Header.Get("Vary"); v != "Accept-Encoding" {
+			t.Errorf("%s: want Vary: Accept-Encoding, got %q", p, v)
+		}
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"SUMMARY.md": "# Summary\n\n- [Intro](intro.md)\n- [Setup](guide/setup)\n" +
+			"- [External](https://example.com/)\n- [Intro again](intro.md#more)\n",
+		"intro.md":       "# Intro\n",
+		"guide/setup.md": "# Setup\n",
+	} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{dir: dir, fsys: os.DirFS(dir)}
+	want := []graphLink{{Title: "Intro", File: "intro.md"}, {Title: "Setup", File: "guide/setup.md"}}
+	if got := h.readingOrder(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got reading order %+v, want %+v", got, want)
+	}
+	if prev, next := h.pageNeighbours("guide/setup.md"); next != nil || prev == nil || prev.File != "intro.md" {
+		t.Fatalf("unexpected neighbours: %+v, %+v", prev, next)
+	}
+	if got := h.findUp("guide/setup.md", navFiles...); got != "SUMMARY.md" {
+		t.Fatalf("findUp returned %q, want SUMMARY.md", got)
+	}
+	sidebar := string(h.renderPartial("SUMMARY.md", "guide/setup.md", false))
+	for _, want := range []string{
+		`<h1>Summary</h1>`,
+		`<a href="/intro.md" rel="nofollow">Intro</a>`,
+		`<a class="current" href="/guide/setup.md" rel="nofollow">Setup</a>`,
+		`<a href="/intro.md#more" rel="nofollow">Intro again</a>`,
+	} {
+		if !strings.Contains(sidebar, want) {
+			t.Errorf("sidebar has no %s:\n%s", want, sidebar)
+		}
+	}
+}
+
+func TestBook(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"intro.md":       "# Intro\n\nSee [setup](guide/setup.md#run) and [below](#more).\n\n## More\n",
+		"guide/setup.md": "Setup steps.\n\n## Run\n",
+	} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{dir: dir, fsys: os.DirFS(dir)}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?all", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`<section id="d2">`,
+		`<h1 id="d2:title">setup</h1>`,
+		`<h2 id="d2:run">`,
+		`<a href="#d2:run" rel="nofollow">setup</a>`,
+		`<a href="#d1:more" rel="nofollow">below</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page has no %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"doc.md", "_Footer.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("# Text\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	footerTime := docTime.Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "doc.md"), docTime, docTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "_Footer.md"), footerTime, footerTime); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{dir: dir, fsys: os.DirFS(dir)}
+	if _, mtime, err := h.readerForFile("doc.md"); err != nil || !mtime.Equal(footerTime) {
+		t.Fatalf("got mtime %v (err: %v), want footer mtime %v", mtime, err, footerTime)
+	}
+	h.styleTime = footerTime.Add(time.Minute)
+	if _, mtime, err := h.readerForFile("doc.md"); err != nil || !mtime.Equal(h.styleTime) {
+		t.Fatalf("got mtime %v (err: %v), want stylesheet mtime %v", mtime, err, h.styleTime)
+	}
+}
+
+func TestTheme(t *testing.T) {
+	dir := t.TempDir()
+	cssFile := filepath.Join(dir, "style.css")
+	tplFile := filepath.Join(dir, "page.html")
+	write := func(name, text string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write(cssFile, "body {color:red}", mtime)
+	write(tplFile, "<style>{{.Style}}</style>{{.Body}}", mtime)
+	h := &Handler{dir: "testdata", fsys: os.DirFS("testdata"), themes: &themeWatcher{css: cssFile, dir: dir}}
+	get := func() string {
+		t.Helper()
+		h.themes.checked = time.Time{} // skip throttling
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hello.md", nil))
+		return w.Body.String()
+	}
+	if got, want := get(), "<style>body {color:red}</style><p>Hello, world!</p>\n"; got != want {
+		t.Fatalf("got page %q, want %q", got, want)
+	}
+	write(cssFile, "body {color:blue}", mtime.Add(time.Minute))
+	write(tplFile, "{{.Broken", mtime.Add(time.Minute))
+	if got, want := get(), "<style>body {color:blue}</style><p>Hello, world!</p>\n"; got != want {
+		t.Fatalf("got page %q after reload, want %q", got, want)
+	}
+	write(tplFile, `{{template "head" .}}{{template "logo" .}}{{.Body}}`, mtime.Add(2*time.Minute))
+	if got, want := get(), "<style>body {color:blue}</style><p>Hello, world!</p>\n"; got != want {
+		t.Fatalf("got page %q with shared templates, want %q", got, want)
+	}
+	if err := os.Remove(tplFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); !strings.HasPrefix(got, "<!doctype html>") {
+		t.Fatalf("built-in template not restored, got page %q", got)
+	}
+}
+
+func TestMissingDocuments(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Some-Page.md"), []byte("# Some Page\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{dir: dir, fsys: os.DirFS(dir), style: style, fileServer: http.FileServer(http.Dir(dir))}
+	for p, want := range map[string]string{
+		"/Some-Page":    "/Some-Page.md",
+		"/some-page":    "/Some-Page.md",
+		"/SOME-PAGE.md": "/Some-Page.md",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != http.StatusFound || w.Header().Get("Location") != want {
+			t.Errorf("%s: got %d redirect to %q, want redirect to %q", p, w.Code, w.Header().Get("Location"), want)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other/sone-paeg.md", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if want := `<a href="/Some-Page.md">Some Page</a>`; !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("not found page has no %s:\n%s", want, w.Body)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	h := &Handler{dir: "testdata", fsys: os.DirFS("testdata"), style: style, fileServer: http.FileServer(http.Dir("testdata"))}
+	buf := new(bytes.Buffer)
+	srv := httptest.NewServer(&accessLog{next: h, w: buf, asJSON: true})
+	defer srv.Close()
+	for _, p := range []string{"/hello.md", "/missing.txt"} {
+		r, err := http.Get(srv.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+	var got []string
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec struct {
+			URI    string
+			Status int
+			Kind   string
+		}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprint(rec.URI, " ", rec.Status, " ", rec.Kind))
+	}
+	want := []string{"/hello.md 200 render", "/missing.txt 404 static"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got log records:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %q: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range map[string]string{"index.md": "# Index\n", "sub/page.md": "# Page\n"} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	if err := os.WriteFile(filepath.Join(dir, "uncommitted.md"), []byte("# Draft\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := GitFS(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "index.md", "sub/page.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys, "uncommitted.md"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("uncommitted file: got error %v, want fs.ErrNotExist", err)
+	}
+	hist := newGitHistory(filepath.Join(dir, "sub"))
+	if hist == nil {
+		t.Fatal("work tree not detected")
+	}
+	commits, err := hist.log("page.md")
+	if err != nil || len(commits) != 1 || commits[0].Subject != "initial" {
+		t.Fatalf("got history %+v, %v", commits, err)
+	}
+	if b, err := hist.show(commits[0].Hash, "page.md"); err != nil || string(b) != "# Page\n" {
+		t.Fatalf("got content %q, %v", b, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "page.md"), []byte("# New Page\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git("commit", "-q", "-a", "-m", "rename page")
+	if commits, err = hist.log("page.md"); err != nil || len(commits) != 2 {
+		t.Fatalf("got history %+v, %v", commits, err)
+	}
+	if c, err := hist.lastCommit("page.md"); err != nil || c.Subject != "rename page" || c.Author != "test" {
+		t.Fatalf("got last commit %+v, %v", c, err)
+	}
+	lines, err := hist.diff(commits[1].Hash, commits[0].Hash, "page.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []diffLine{{Hunk: "@@ -1 +1 @@"}, {Parts: []diffPart{{" ", "# "}, {"+", "New"}, {" ", " Page"}}}}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("got diff %+v, want %+v", lines, want)
+	}
+	bare := filepath.Join(t.TempDir(), "wiki.git")
+	git("clone", "-q", "--bare", dir, bare)
+	t.Setenv("PATH", "") // repository must be readable without git command
+	if fsys, err = GitFS(bare, "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := fs.ReadFile(fsys, "sub/page.md"); err != nil || string(b) != "# New Page\n" {
+		t.Fatalf("bare repository: got content %q, %v", b, err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handler{dir: dir, fsys: os.DirFS(dir), style: style, edit: true}
+	post := func(target, origin, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	if w := post("/doc.md?edit", "http://evil.example.com", "text=x"); w.Code != http.StatusForbidden {
+		t.Fatalf("cross-origin save: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := post("/.git/doc.md?edit", "http://example.com", "text=x"); w.Code != http.StatusForbidden {
+		t.Fatalf("save to hidden directory: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); !os.IsNotExist(err) {
+		t.Fatalf("hidden directory was created: %v", err)
+	}
+	if w := post("/doc.md?edit", "http://example.com", "text=%23+Doc%0D%0A"); w.Code != http.StatusSeeOther {
+		t.Fatalf("save: got status %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "doc.md")); err != nil || string(b) != "# Doc\n" {
+		t.Fatalf("saved file: %q, %v", b, err)
+	}
+	if w := post("/doc.md?edit", "http://example.com", "version=stale&text=x"); w.Code != http.StatusConflict {
+		t.Fatalf("conflicting save: got status %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := post("/doc.md?edit", "http://example.com", "version="+h.fileVersion("doc.md")+"&text=x"); w.Code != http.StatusSeeOther {
+		t.Fatalf("second save: got status %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if w := post("/doc.md?preview", "http://example.com", "*text*"); w.Body.String() != "<p><em>text</em></p>\n" {
+		t.Fatalf("preview: got %q", w.Body)
+	}
+}
+
+func TestDAV(t *testing.T) {
+	h := &Handler{dir: "testdata", fsys: os.DirFS("testdata")}
+	h.dav = h.newDAVHandler(false)
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"PROPFIND", "/dav/", http.StatusMultiStatus},
+		{http.MethodGet, "/dav/hello.md", http.StatusOK},
+		{http.MethodPut, "/dav/new.md", http.StatusMethodNotAllowed},
+		{"MKCOL", "/dav/dir", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s %s: got status %d, want %d", tc.method, tc.path, w.Code, tc.status)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	h := &Handler{dir: "testdata", fsys: os.DirFS("testdata"), style: style, assetFS: builtinAssetsFS}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?download=zip", nil))
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]bool)
+	for _, f := range zr.File {
+		files[f.Name] = true
+	}
+	for _, name := range []string{"hello.html", "_index.html", "_assets/toc.js"} {
+		if !files[name] {
+			t.Errorf("archive has no %q file", name)
+		}
+	}
+}
+
+func TestEPUB(t *testing.T) {
+	h := &Handler{dir: "testdata", fsys: os.DirFS("testdata"), style: style}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?download=epub", nil))
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := zr.File[0]; f.Name != "mimetype" || f.Method != zip.Store {
+		t.Fatalf("first file is %q with method %d, want uncompressed mimetype", f.Name, f.Method)
+	}
+	f, err := zr.Open("hello.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := xml.NewDecoder(f).Decode(new(struct{})); err != nil {
+		t.Fatalf("chapter is not a valid XML: %v", err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	h := &Handler{dir: "testdata", fsys: os.DirFS("testdata"), started: time.Now()}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var out struct {
+		Status    string
+		Documents int
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || out.Status != "ok" || out.Documents != 1 {
+		t.Fatalf("got status %d, response %+v", w.Code, out)
+	}
+}
+
+func TestNew(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.md":     {Data: []byte("# Help\n\nSee [usage](usage.md).\n")},
+		"usage.md":     {Data: []byte("# Usage\n")},
+		"img/logo.png": {Data: []byte("PNG")},
+	}
+	h, err := New(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	for p, want := range map[string]string{
+		"/":             `<a href="usage.md" rel="nofollow">usage</a>`,
+		"/usage.md":     `<title>Usage</title>`,
+		"/img/logo.png": "PNG",
+	} {
+		resp, err := http.Get(srv.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(b), want) {
+			t.Errorf("%s: got status %d and body without %q:\n%s", p, resp.StatusCode, want, b)
+		}
+	}
+	resp, err := http.Get(srv.URL + "/usage.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.Header.Get("Link"), "</_assets/toc.js>; rel=preload; as=script"; got != want {
+		t.Errorf("got Link header %q, want %q", got, want)
+	}
+	if _, err := New(fsys, &Options{Edit: true}); err == nil {
+		t.Error("editing enabled without documents directory")
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	fsys := fstest.MapFS{
+		"small.md":  {Data: []byte("# Small\n")},
+		"large.md":  {Data: []byte("# Large\n\n" + strings.Repeat("text ", 100))},
+		"video.bin": {Data: []byte("0123456789")},
+	}
+	h, err := New(fsys, &Options{MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]int{"/small.md": http.StatusOK, "/large.md": http.StatusUnprocessableEntity} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != want {
+			t.Errorf("%s: got status %d, want %d", p, w.Code, want)
+		}
+		if p == "/large.md" && !strings.Contains(w.Body.String(), "<h1>Document is too large</h1>") {
+			t.Errorf("%s: got body without error page:\n%s", p, w.Body)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "/video.bin", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Fatalf("range request: got status %d, body %q", w.Code, w.Body.String())
+	}
+}
+
+func TestFeed(t *testing.T) {
+	now := time.Now()
+	fsys := fstest.MapFS{
+		"old.md": {Data: []byte("# Old\n\nOld text.\n"), ModTime: now.Add(-time.Hour)},
+		"new.md": {Data: []byte("# New\n\nNew *text*.\n"), ModTime: now},
+	}
+	h, err := New(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feed.atom", nil))
+	var feed struct {
+		Entries []struct {
+			Title   string `xml:"title"`
+			Summary string `xml:"summary"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "New" || feed.Entries[0].Summary != "<p>New <em>text</em>.</p>" {
+		t.Fatalf("unexpected feed: %+v", feed)
+	}
+}
+
+func TestIndexPages(t *testing.T) {
+	fsys := make(fstest.MapFS)
+	for i := 0; i < 2*indexPageSize+50; i++ {
+		fsys[fmt.Sprintf("doc%03d.md", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("# Document %d\n", i))}
+	}
+	h, err := New(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(query string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", query, w.Code)
+		}
+		return w.Body.String()
+	}
+	body := get("index&page=3")
+	if n := strings.Count(body, "<li>"); n != 50 {
+		t.Errorf("got %d documents on the last page, want 50", n)
+	}
+	if !strings.Contains(body, `<a href="/?index&amp;page=2" rel="prev">`) || strings.Contains(body, `rel="next"`) {
+		t.Errorf("unexpected links to other pages:\n%s", body)
+	}
+	body = get("index&filter=DOC01")
+	if n := strings.Count(body, "<li>"); n != 10 {
+		t.Errorf("got %d filtered documents, want 10", n)
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	fsys := fstest.MapFS{
+		"long.md": {Data: []byte("# Long\n\n" + strings.Repeat("word ", 450) + "\n")},
+	}
+	h, err := New(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := h.dirIndex(nil, "")
+	if len(index) != 1 || index[0].Words != 451 || index[0].ReadingTime() != 3 {
+		t.Fatalf("unexpected index: %+v", index)
+	}
+	fsys["long.md"].Data = []byte("# Short\n")
+	fsys["long.md"].ModTime = time.Now()
+	if index = h.dirIndex(nil, ""); index[0].Title != "Short" || index[0].Words != 1 {
+		t.Fatalf("cached metadata not updated: %+v", index)
+	}
+}
+
+func TestIndexConcurrent(t *testing.T) {
+	fsys := make(fstest.MapFS)
+	for i := 0; i < 500; i++ {
+		text := "plain text"
+		if i%10 == 0 {
+			text = "needle in text"
+		}
+		fsys[fmt.Sprintf("dir%d/doc%03d.md", i%7, i)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("# Doc %d\n\n%s\n", i, text)),
+		}
+	}
+	h, err := New(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := h.dirIndex(nil, "")
+	if len(index) != 500 {
+		t.Fatalf("got %d records, want 500", len(index))
+	}
+	for i := 1; i < len(index); i++ {
+		if a, b := index[i-1], index[i]; a.Subdir > b.Subdir || a.Subdir == b.Subdir && a.sortKey > b.sortKey {
+			t.Fatalf("records out of order: %q, %q", a.File, b.File)
+		}
+	}
+	for _, rec := range index {
+		if !strings.HasPrefix(rec.Title, "Doc ") {
+			t.Fatalf("unexpected title of %s: %q", rec.File, rec.Title)
+		}
+	}
+	pat := search.New(language.English, search.Loose).CompileString("needle")
+	if found := h.dirIndex(pat, ""); len(found) != 50 {
+		t.Fatalf("search found %d records, want 50", len(found))
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.md":       {Data: []byte("# Home\n\nSee [usage](/usage.md), [guide](guide/setup.md) and [[Usage]].\n")},
+		"usage.md":       {Data: []byte("# Usage\n")},
+		"guide/setup.md": {Data: []byte("# Setup\n")},
+	}
+	h, err := New(fsys, &Options{BaseURL: "/docs/", WikiLinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{"/docs/", []string{`<a href="/docs/usage.md"`, `<a href="guide/setup.md"`,
+			`<a class="wikilink" href="/docs/usage.md"`, `<a href="/docs/?index">index</a>`, `src="/docs/_assets/toc.js"`}},
+		{"/index.md", []string{`<a href="/docs/usage.md"`}}, // prefix stripped by proxy
+		{"/docs/?index", []string{`<a href="guide/setup.md">`, `src="/docs/_assets/filter.js"`}},
+		{"/docs/sitemap.xml", []string{`<loc>http://example.com/docs/guide/setup.md</loc>`}},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", tc.path, w.Code)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: body has no %s:\n%s", tc.path, want, w.Body)
+			}
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if loc := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || loc != "/docs/" {
+		t.Errorf("got status %d, location %q, want redirect to /docs/", w.Code, loc)
+	}
+}
+
+func TestBaseURLLinkStyle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.md":  {Data: []byte("# Home\n")},
+		"style.css": {Data: []byte("body {color: black}\n")},
+	}
+	h, err := New(fsys, &Options{BaseURL: "/docs/", StyleHref: "/style.css"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/missing.md", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if want := `<link rel="stylesheet" href="/docs/style.css">`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("page has no %q:\n%s", want, w.Body)
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"old.markdown": {Data: []byte("# Old\n\nSee [[New]].\n")},
+		"new.md":       {Data: []byte("# New\n")},
+		"notes.txt":    {Data: []byte("# Plain\n")},
+	}
+	h, err := New(fsys, &Options{Extensions: []string{".md", ".markdown"}, WikiLinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, rec := range h.dirIndex(nil, "") {
+		files = append(files, rec.File)
+	}
+	if want := []string{"new.md", "old.markdown"}; !reflect.DeepEqual(files, want) {
+		t.Fatalf("got index %q, want %q", files, want)
+	}
+	for p, want := range map[string]string{
+		"/old.markdown": `<a class="wikilink" href="/new.md"`,
+		"/old":          "", // redirect
+		"/notes.txt":    "# Plain",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		switch {
+		case want == "":
+			if loc := w.Header().Get("Location"); loc != "/old.markdown" {
+				t.Errorf("%s: got status %d, location %q", p, w.Code, loc)
+			}
+		case !strings.Contains(w.Body.String(), want):
+			t.Errorf("%s: body has no %s:\n%s", p, want, w.Body)
+		}
+	}
+	if _, err := New(fsys, &Options{Extensions: []string{"md"}}); err == nil {
+		t.Error("extension without leading dot accepted")
+	}
+}
+
+func TestRenderCode(t *testing.T) {
+	fsys := fstest.MapFS{
+		"run.sh":   {Data: []byte("#!/bin/sh\necho \"<hi>\"\n")},
+		"blob.txt": {Data: []byte("\x00\x01binary")},
+		"logo.png": {Data: []byte("PNG")},
+	}
+	h, err := New(fsys, &Options{RenderCode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path, contentType, want string
+	}{
+		{"/run.sh", "text/html; charset=utf-8", `<a id="L2" href="#L2">2</a>`},
+		{"/run.sh", "", `<code class="language-bash">#!/bin/sh` + "\necho &#34;&lt;hi&gt;&#34;\n</code>"},
+		{"/run.sh?raw", "", "echo \"<hi>\""},
+		{"/blob.txt", "", "\x00\x01binary"},
+		{"/logo.png", "image/png", "PNG"},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s: got status %d, body without %q:\n%s", tc.path, w.Code, tc.want, w.Body)
+		}
+		if ct := w.Header().Get("Content-Type"); tc.contentType != "" && ct != tc.contentType {
+			t.Errorf("%s: got Content-Type %q, want %q", tc.path, ct, tc.contentType)
+		}
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data.csv": {Data: []byte("name,count\n\"a, b\",2\n<c>,10\n")},
+		"data.tsv": {Data: []byte("name\tcount\nx\t1\n")},
+	}
+	h, err := New(fsys, &Options{RenderCSV: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"/data.csv":     "<thead><tr><th>name</th><th>count</th></tr></thead>\n<tbody>\n<tr><td>a, b</td><td>2</td></tr>\n<tr><td>&lt;c&gt;</td><td>10</td></tr>",
+		"/data.tsv":     "<tr><td>x</td><td>1</td></tr>",
+		"/data.csv?raw": "name,count\n",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: got status %d, body without %q:\n%s", p, w.Code, want, w.Body)
+		}
+	}
+}
+
+func TestConverters(t *testing.T) {
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed is not available")
+	}
+	fsys := fstest.MapFS{
+		"doc.adoc": {Data: []byte("= Converted Title\n\n<script>alert(1)</script>\n")},
+		"note.md":  {Data: []byte("# Note\n")},
+	}
+	h, err := New(fsys, &Options{Converters: map[string]string{
+		".adoc": `sed -e s,^=\(.*\)$,<h1>\1</h1>,`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"/doc.adoc":     "<h1> Converted Title</h1>",
+		"/doc.adoc?raw": "= Converted Title\n",
+		"/?index":       "Converted Title",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: got status %d, body without %q:\n%s", p, w.Code, want, w.Body)
+		}
+		if p == "/doc.adoc" && strings.Contains(w.Body.String(), "alert(1)") {
+			t.Errorf("%s: converted html is not sanitized:\n%s", p, w.Body)
+		}
+	}
+	if _, err := New(fsys, &Options{Converters: map[string]string{".md": "cat"}}); err == nil {
+		t.Error("converter for document extension is accepted")
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"page.md":          {Data: []byte("# Page\n\n{{include:snippets/note.md}}\n"), ModTime: mtime},
+		"snippets/note.md": {Data: []byte("Shared *note*\n"), ModTime: mtime.Add(time.Hour)},
+	}
+	h, err := New(fsys, &Options{Includes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page.md", nil))
+	if want := "<p>Shared <em>note</em></p>"; w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("got status %d, body without %q:\n%s", w.Code, want, w.Body)
+	}
+	if got, want := w.Header().Get("Last-Modified"), mtime.Add(time.Hour).Format(http.TimeFormat); got != want {
+		t.Errorf("got Last-Modified %q, want %q of included document", got, want)
+	}
+}
+
+func TestGlossary(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_Glossary.md":     {Data: []byte("# Glossary\n\nSLA\n: Service level agreement\n")},
+		"page.md":          {Data: []byte("# Page\n\nMind the SLA.\n")},
+		"ops/_Glossary.md": {Data: []byte("SLA\n: Standard lead assembly\n")},
+		"ops/runbook.md":   {Data: []byte("# Runbook\n\nMind the SLA.\n")},
+	}
+	h, err := New(fsys, &Options{Glossary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"/page.md":        `Mind the <abbr title="Service level agreement">SLA</abbr>.`,
+		"/ops/runbook.md": `Mind the <abbr title="Standard lead assembly">SLA</abbr>.`,
+		"/_Glossary.md":   "<dt>SLA</dt>",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: got status %d, body without %q:\n%s", p, w.Code, want, w.Body)
+		}
+	}
+}
+
+func TestLinkPreview(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.md":      {Data: []byte("# Page\n\nSee [other](dir/other.md).\n")},
+		"dir/other.md": {Data: []byte("# Other Page\n\nFirst *paragraph*.\n\nSecond one.\n")},
+	}
+	h, err := New(fsys, &Options{Previews: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page.md", nil))
+	if want := `<script src="/_assets/preview.js">`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("page has no %q:\n%s", want, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/preview?path=/dir/other.md", nil))
+	var preview struct{ Title, HTML string }
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("status %d, %v: %s", w.Code, err, w.Body)
+	}
+	if want := "Other Page"; preview.Title != want {
+		t.Errorf("got title %q, want %q", preview.Title, want)
+	}
+	if want := "<p>First <em>paragraph</em>.</p>"; preview.HTML != want {
+		t.Errorf("got html %q, want %q", preview.HTML, want)
+	}
+	for p, code := range map[string]int{
+		"/api/preview?path=/missing.md":    http.StatusNotFound,
+		"/api/preview?path=/../etc/passwd": http.StatusBadRequest,
+		"/api/preview?path=/dir/other.txt": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != code {
+			t.Errorf("%s: got status %d, want %d", p, w.Code, code)
+		}
+	}
+}
+
+func TestSearchLinks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.md":  {Data: []byte("# Page\n\nSome Café text.\n")},
+		"other.md": {Data: []byte("# Other\n\nNothing here.\n")},
+	}
+	h, err := New(fsys, &Options{Search: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"/?q=cafe":         `<a href="page.md?q=cafe">Page</a>`,
+		"/page.md?q=cafe":  `<script src="/_assets/mark.js"></script>`,
+		"/?q=caf%C3%A9+te": `<a href="page.md?q=caf%c3%a9%20te">Page</a>`,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: got status %d, body without %q:\n%s", p, w.Code, want, w.Body)
+		}
+	}
+}
+
+func TestIndexLetters(t *testing.T) {
+	fsys := fstest.MapFS{
+		"zeta.md":      {Data: []byte("# Zeta\n")},
+		"eclair.md":    {Data: []byte("# Éclair\n")},
+		"dir/alpha.md": {Data: []byte("# alpha\n")},
+		"echo.md":      {Data: []byte("# Echo\n")},
+		"2fa.md":       {Data: []byte("# 2FA setup\n")},
+	}
+	h, err := New(fsys, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?index=az", nil))
+	body := w.Body.String()
+	if want := `<nav id="letters"><a href="#letter-%23">#</a> <a href="#letter-A">A</a> <a href="#letter-E">E</a> <a href="#letter-Z">Z</a> `; !strings.Contains(body, want) {
+		t.Fatalf("page has no %q:\n%s", want, body)
+	}
+	for _, s := range []string{`id="letter-#"`, "2FA setup", `id="letter-A"`, "alpha", `id="letter-E"`, "Echo", "Éclair", `id="letter-Z"`, "Zeta"} {
+		i := strings.Index(body, s)
+		if i < 0 {
+			t.Fatalf("page has no %q in this order:\n%s", s, w.Body)
+		}
+		body = body[i:]
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?index=az&filter=ec", nil))
+	if body := w.Body.String(); !strings.Contains(body, "Echo") || strings.Contains(body, "Zeta") {
+		t.Errorf("filtered index has unexpected documents:\n%s", body)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	fsys := fstest.MapFS{"page.md": {Data: []byte("# Page\n")}}
+	h, err := New(fsys, &Options{Keys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/page.md", "/?index"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if want := `<script src="/_assets/keys.js"></script>`; !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: page has no %q:\n%s", p, want, w.Body)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_assets/keys.js", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("keys.js: got status %d", w.Code)
+	}
+}
+
+func TestDirThemes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.md":                 {Data: []byte("# Page\n")},
+		"sec/page.md":             {Data: []byte("# Section page\n")},
+		"sec/sub/page.md":         {Data: []byte("# Subsection page\n")},
+		"sec/.mdserver/style.css": {Data: []byte("body { color: red }\n")},
+		"sec/.mdserver/page.html": {Data: []byte("<title>custom</title>{{.Title}}|{{.DirStyle}}")},
+	}
+	h, err := New(fsys, &Options{DirThemes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ path, want string }{
+		{"/sec/page.md", "<title>custom</title>Section page|/sec/.mdserver/style.css"},
+		{"/sec/sub/page.md", "<title>custom</title>Subsection page|/sec/.mdserver/style.css"},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if got := w.Body.String(); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.path, got, tc.want)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page.md", nil))
+	if body := w.Body.String(); strings.Contains(body, "custom") || strings.Contains(body, ".mdserver") {
+		t.Errorf("root page got directory theme:\n%s", body)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"v1/README.md":    {Data: []byte("# Version 1\n")},
+		"v1/old.md":       {Data: []byte("# Old\n")},
+		"v2/README.md":    {Data: []byte("# Version 2\n")},
+		"v2/guide/new.md": {Data: []byte("# New\n")},
+		"about.md":        {Data: []byte("# About\n")},
+	}
+	h, err := New(fsys, &Options{Versions: []string{"v2", "v1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{"/v1/README.md", []string{
+			`<a href="/v2/README.md">v2</a>`,
+			`<a href="/v1/README.md" class="current">v1</a>`,
+		}},
+		{"/v2/guide/new.md", []string{
+			`<summary>v2</summary>`,
+			`<a href="/v1/README.md" class="missing" title="No such page in this version">v1</a>`,
+		}},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		for _, want := range tc.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: page has no %q:\n%s", tc.path, want, w.Body)
+			}
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about.md", nil))
+	if strings.Contains(w.Body.String(), `id="versions"`) {
+		t.Errorf("page outside of versions has version picker:\n%s", w.Body)
+	}
+}
+
+func TestGitRefsFS(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %q: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	for _, v := range []string{"v1", "v2"} {
+		if err := os.WriteFile(filepath.Join(dir, v+".md"), []byte("# "+v+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		git("add", ".")
+		git("commit", "-q", "-m", v)
+		git("tag", v)
+	}
+	fsys, err := GitRefsFS(dir, []string{"v2", "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "v1/v1.md", "v2/v1.md", "v2/v2.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys, "v1/v2.md"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("file added after v1: got error %v, want fs.ErrNotExist", err)
+	}
+	if _, err := GitRefsFS(dir, []string{"v1", "heads/main"}); err == nil {
+		t.Fatal("ref with slash accepted")
+	}
+}
+
+func TestTrustProxy(t *testing.T) {
+	fsys := fstest.MapFS{"dir/page.md": {Data: []byte("# Page\n")}}
+	request := func(p string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, p, nil)
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "docs.example.com, proxy.internal")
+		return r
+	}
+	for _, tc := range []struct {
+		trust bool
+		want  string
+	}{
+		{false, "http://example.com/docs/dir/page.md"},
+		{true, "https://docs.example.com/docs/dir/page.md"},
+	} {
+		h, err := New(fsys, &Options{TrustProxy: tc.trust, BaseURL: "/docs/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{"/sitemap.xml", "/feed.atom"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request(p))
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("TrustProxy=%v, %s: no %q in\n%s", tc.trust, p, tc.want, w.Body)
+			}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request("/dir/page.md"))
+		if want := `<link rel="canonical" href="` + tc.want + `">`; !strings.Contains(w.Body.String(), want) {
+			t.Errorf("TrustProxy=%v: page has no %q:\n%s", tc.trust, want, w.Body)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	fsys := fstest.MapFS{"page.md": {Data: []byte("# Page\n")}}
+	for _, tc := range []struct {
+		opts                       Options
+		frames, frameOpts, referer string
+	}{
+		{Options{}, "frame-ancestors 'self'", "SAMEORIGIN", "strict-origin-when-cross-origin"},
+		{Options{FrameAncestors: "'none'", ReferrerPolicy: "no-referrer"}, "frame-ancestors 'none'", "DENY", "no-referrer"},
+		{Options{FrameAncestors: "'self' https://example.com"}, "frame-ancestors 'self' https://example.com", "", "strict-origin-when-cross-origin"},
+	} {
+		h, err := New(fsys, &tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{"/page.md", "/?index"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+			hdr := w.Result().Header
+			if csp := hdr.Get("Content-Security-Policy"); !strings.Contains(csp, tc.frames) {
+				t.Errorf("%+v, %s: Content-Security-Policy %q has no %q", tc.opts, p, csp, tc.frames)
+			}
+			for key, want := range map[string]string{
+				"X-Frame-Options":        tc.frameOpts,
+				"Referrer-Policy":        tc.referer,
+				"X-Content-Type-Options": "nosniff",
+			} {
+				if got := hdr.Get(key); got != want {
+					t.Errorf("%+v, %s: %s is %q, want %q", tc.opts, p, key, got, want)
+				}
+			}
+		}
+	}
+	if _, err := New(fsys, &Options{FrameAncestors: "'self'; script-src *"}); err == nil {
+		t.Error("frame ancestors with directive separator accepted")
+	}
+}
+
+func TestMaxRenders(t *testing.T) {
+	fsys := fstest.MapFS{"page.md": {Data: []byte("# Page\n")}}
+	h, err := New(fsys, &Options{MaxRenders: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, ok := h.renderSlot(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ok {
+		t.Fatal("cannot take free render slot")
+	}
+	for _, p := range []string{"/page.md", "/api/preview?path=/page.md", "/feed.atom"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s on busy server: got status %d, Retry-After %q", p, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+	release()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page.md", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d after slot is released", w.Code)
+	}
+}
+
+// panicFS panics on opening "panic.md"
+type panicFS struct{ fstest.MapFS }
+
+func (fsys panicFS) Open(name string) (fs.File, error) {
+	if name == "panic.md" {
+		panic("test panic")
+	}
+	return fsys.MapFS.Open(name)
+}
+
+func TestServerErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"index.html", "page.html"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{{template "missing"}}`), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := fstest.MapFS{"page.md": {Data: []byte("# Page\n")}, "panic.md": {}}
+	h1, err := New(panicFS{fsys}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := New(fsys, &Options{Templates: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3, err := New(panicFS{fsys}, &Options{BaseURL: "/docs/", StyleHref: "/style.css"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.SetOutput(log.Writer())
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	for _, tc := range []struct {
+		h *Handler
+		p string
+	}{{h1, "/panic.md"}, {h2, "/?index"}, {h2, "/page.md"}, {h3, "/docs/panic.md"}} {
+		w := httptest.NewRecorder()
+		tc.h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.p, nil))
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<h1>Internal server error</h1>") {
+			t.Errorf("%s: got status %d and body\n%s", tc.p, w.Code, w.Body)
+		}
+	}
+	w := httptest.NewRecorder()
+	h3.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/panic.md", nil))
+	if want := `<link rel="stylesheet" href="/docs/style.css">`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("error page has no %q:\n%s", want, w.Body)
+	}
+	if rw := (&responseState{ResponseWriter: w}); rw.Unwrap() != http.ResponseWriter(w) {
+		t.Error("responseState.Unwrap does not return the wrapped writer")
+	}
+	if s := logged.String(); !strings.Contains(s, "test panic") || !strings.Contains(s, "goroutine") {
+		t.Errorf("panic is not logged with stack trace:\n%s", s)
+	}
+	w = httptest.NewRecorder()
+	h1.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page.md", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d for a regular page", w.Code)
+	}
+}
+
+func TestHome(t *testing.T) {
+	fsys := fstest.MapFS{
+		"notes.md":  {Data: []byte("# Notes\n"), ModTime: time.Now().Add(-time.Hour)},
+		"README.md": {Data: []byte("# Readme\n")},
+	}
+	h, err := New(fsys, &Options{Home: "notes.md", AutoReload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, want := range []string{`<h1 id="notes">Notes`, `<script src="/_assets/reload.js"></script>`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("page has no %q:\n%s", want, w.Body)
+		}
+	}
+	r := httptest.NewRequest(http.MethodHead, "/", nil)
+	r.Header.Set("If-Modified-Since", w.Header().Get("Last-Modified"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("reload check of unchanged page: got status %d", w.Code)
+	}
+}
+
+func TestWriteDocument(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/page.md": {Data: []byte("# Page\n\nSee [other](other.md) and [root](/index.md).\n")},
+		"image.png":   {Data: []byte("png")},
+	}
+	h, err := New(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := h.WriteDocument(&buf, "dir/page.md"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<title>Page</title>`, `href="other.html"`, `href="../index.html"`, `src="../_assets/toc.js"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("page has no %q:\n%s", want, &buf)
+		}
+	}
+	if err := h.WriteDocument(io.Discard, "image.png"); err == nil {
+		t.Error("non-document rendered without error")
+	}
+}
+
+func TestEditorURL(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "my page.md"), []byte("# Page\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	h, err := New(os.DirFS(dir), &Options{Dir: dir, EditorURL: "vscode://file{path}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/my%20page.md", nil))
+	p := filepath.ToSlash(filepath.Join(dir, "my page.md"))
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	want := `<a href="vscode://file` + (&url.URL{Path: p}).EscapedPath() + `" title="Open source file in editor">edit</a>`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("page has no %q:\n%s", want, w.Body)
+	}
+	if _, err := New(os.DirFS(dir), &Options{EditorURL: "vscode://file{path}"}); err == nil {
+		t.Error("editor URL accepted without Dir")
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.md":     {Data: []byte("[a](a.md) [b](b.md) [c](sub/) [d](a#x) [e](https://example.com/)\n")},
+		"a.md":         {Data: []byte("# A\n")},
+		"sub/index.md": {Data: []byte("# Sub\n")},
+	}
+	h, err := New(fsys, &Options{CheckLinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/index.md", nil))
+	body := w.Body.String()
+	if want := `<a class="broken" title="Link target does not exist" href="b.md" rel="nofollow">b</a>`; !strings.Contains(body, want) {
+		t.Errorf("page has no %q:\n%s", want, body)
+	}
+	if n := strings.Count(body, `class="broken"`); n != 1 {
+		t.Errorf("got %d broken links, want 1:\n%s", n, body)
+	}
+}
+
+func TestIsIDPrefix(t *testing.T) {
+	for s, want := range map[string]bool{
+		"user-content-": true,
+		"doc_":          true,
+		"h":             true,
+		"":              false,
+		"1-":            false,
+		"-x":            false,
+		"bad prefix":    false,
+		"a:b":           false,
+		"x\"y":          false,
+	} {
+		if got := isIDPrefix(s); got != want {
+			t.Errorf("isIDPrefix(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestHeadingIDPrefix(t *testing.T) {
+	fsys := fstest.MapFS{"index.md": {Data: []byte("# Index\n\n[see below](#backlinks)\n\n## Backlinks\n")}}
+	if _, err := New(fsys, &Options{HeadingIDPrefix: "bad prefix"}); err == nil {
+		t.Fatal("New accepted invalid heading id prefix")
+	}
+	h, err := New(fsys, &Options{HeadingIDPrefix: "user-content-", Backlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/index.md", nil))
+	body := w.Body.String()
+	for _, want := range []string{`<h2 id="user-content-backlinks">`, `<a href="#user-content-backlinks" rel="nofollow">see below</a>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page has no %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestThemes(t *testing.T) {
+	dir := t.TempDir()
+	css := filepath.Join(dir, "dark.css")
+	if err := os.WriteFile(css, []byte("body {background: black}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"index.md": {Data: []byte("# Index\n")}}
+	h, err := New(fsys, &Options{Themes: map[string]string{"dark": css}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/index.md", nil))
+	if want := `<link rel="stylesheet" href="/_assets/theme.css">`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("page has no %q:\n%s", want, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/index.md?theme=dark&x=1", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/index.md?x=1" {
+		t.Fatalf("got %d status, location %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "dark" {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/_assets/theme.css", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Body.String() != "body {background: black}\n" {
+		t.Errorf("unexpected theme stylesheet: %q", w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_assets/theme.css", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("default theme: got %d status, body %q", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?theme=light", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown theme: got %d status", w.Code)
+	}
+	if _, err := New(fsys, &Options{Themes: map[string]string{"dark mode": css}}); err == nil {
+		t.Error("invalid theme name accepted")
+	}
+}
+
+func TestBranding(t *testing.T) {
+	dir := t.TempDir()
+	icon, logo := filepath.Join(dir, "icon.PNG"), filepath.Join(dir, "logo.svg")
+	if err := os.WriteFile(icon, []byte("icon"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logo, []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"index.md": {Data: []byte("# Index\n")}}
+	h, err := New(fsys, &Options{Favicon: icon, Logo: logo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/index.md", nil))
+	for _, want := range []string{
+		`<link rel="icon" href="/_assets/favicon.png">`,
+		`<a id="logo" href="/"><img src="/_assets/logo.svg" alt="Home"></a>`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("page has no %q:\n%s", want, w.Body)
+		}
+	}
+	for p, want := range map[string]string{"/_assets/favicon.png": "icon", "/favicon.ico": "icon", "/_assets/logo.svg": "<svg"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), want) {
+			t.Errorf("%s: got %d status, body %q", p, w.Code, w.Body)
+		}
+	}
+	if _, err := New(fsys, &Options{Logo: dir}); err == nil {
+		t.Error("directory accepted as logo")
+	}
+}
+
+func TestSocialMeta(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.md":  {Data: []byte("# Page Title\n\nFirst *paragraph*\nof the page.\n\nSecond one.\n")},
+		"other.md": {Data: []byte("---\ndescription: Custom text\n---\n# Other\n\nBody.\n")},
+	}
+	h, err := New(fsys, &Options{PublicURL: "https://docs.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page.md", nil))
+	for _, want := range []string{
+		`<meta name="description" content="First paragraph of the page.">`,
+		`<link rel="canonical" href="https://docs.example.com/page.md">`,
+		`<meta property="og:url" content="https://docs.example.com/page.md">`,
+		`<meta property="og:title" content="Page Title">`,
+		`<meta property="og:description" content="First paragraph of the page.">`,
+		`<meta name="twitter:card" content="summary">`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("page has no %q:\n%s", want, w.Body)
+		}
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other.md", nil))
+	if want := `<meta property="og:description" content="Custom text">`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("page has no %q:\n%s", want, w.Body)
+	}
+	if got, want := shortenText("one two three", 9), "one two…"; got != want {
+		t.Errorf("shortenText: got %q, want %q", got, want)
+	}
+	if _, err := New(fsys, &Options{PublicURL: "docs.example.com"}); err == nil {
+		t.Error("public URL without scheme accepted")
+	}
+}
+
+func TestPWA(t *testing.T) {
+	fsys := fstest.MapFS{"index.md": {Data: []byte("# Index\n")}}
+	h, err := New(fsys, &Options{PWA: true, BaseURL: "/docs/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/index.md", nil))
+	if want := `<script src="/docs/_assets/pwa.js"></script>`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("page has no %q:\n%s", want, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/_assets/sw.js", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Service-Worker-Allowed") != "/docs/" {
+		t.Errorf("service worker: got %d status, headers %v", w.Code, w.Header())
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/docs/_assets/manifest.json", nil))
+	var manifest struct {
+		Name, Scope string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Name != "example.com" || manifest.Scope != "/docs/" {
+		t.Errorf("unexpected manifest: %s", w.Body)
+	}
+}
+
+func TestCopyButtons(t *testing.T) {
+	fsys := fstest.MapFS{
+		"code.md": {Data: []byte("# Code\n\n```sh\nls -l\n```\n")},
+		"text.md": {Data: []byte("# Text\n\nNo code.\n")},
+	}
+	h, err := New(fsys, &Options{CopyButtons: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const script = `<script src="/_assets/copy.js"></script>`
+	for p, want := range map[string]bool{"/code.md": true, "/text.md": false} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if got := strings.Contains(w.Body.String(), script); got != want {
+			t.Errorf("%s: page has script: %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestPageInfo(t *testing.T) {
+	mtime := time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"doc.md": {Data: bytes.Repeat([]byte("text\n"), 500), ModTime: mtime}}
+	h, err := New(fsys, &Options{PageInfo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/doc.md", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`<footer id="page-info">Updated <time datetime="2024-03-05T14:30:00Z">2024-03-05 14:30</time>, 2.4 KB</footer>`,
+		`<script src="/_assets/pageinfo.js"></script>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page has no %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestOutline(t *testing.T) {
+	fsys := fstest.MapFS{
+		"doc.md":   {Data: []byte("# Design\n\n## Goals\n\n### Non-goals\n\n## Plan & Risks\n")},
+		"short.md": {Data: []byte("# Short\n\nText.\n")},
+	}
+	h, err := New(fsys, &Options{Outline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/outline/doc.md", nil))
+	var out struct {
+		Title   string
+		Outline []outlineItem
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("status %d, %v: %s", w.Code, err, w.Body)
+	}
+	want := []outlineItem{{Level: 1, ID: "design", Text: "Design", Children: []outlineItem{
+		{Level: 2, ID: "goals", Text: "Goals", Children: []outlineItem{{Level: 3, ID: "non-goals", Text: "Non-goals"}}},
+		{Level: 2, ID: "plan--risks", Text: "Plan & Risks"},
+	}}}
+	if out.Title != "Design" || !reflect.DeepEqual(out.Outline, want) {
+		t.Errorf("got %+v", out)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/doc.md", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`<nav id="outline"><details open><summary>On this page</summary>`,
+		`<li><a href="#goals">Goals</a><ul><li><a href="#non-goals">Non-goals</a></li>`,
+		`<li><a href="#plan--risks">Plan &amp; Risks</a></li>`,
+		`<script src="/_assets/outline.js"></script>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page has no %q:\n%s", want, body)
+		}
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/short.md", nil))
+	if strings.Contains(w.Body.String(), `id="outline"`) {
+		t.Errorf("page with a single heading has outline:\n%s", w.Body)
+	}
+}
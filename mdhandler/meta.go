@@ -0,0 +1,70 @@
+package mdhandler
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/artyom/mdserver/mdrender"
+)
+
+// documentTags returns normalized tags of a document, taken either from the
+// "tags" front matter key, or from the first line starting with "Tags:".
+func documentTags(meta, body []byte) []string {
+	var list string
+	if meta != nil {
+		list = mdrender.FrontMatterValue(meta, "tags")
+	}
+	if list == "" {
+		sc := bufio.NewScanner(bytes.NewReader(body))
+		for sc.Scan() {
+			if line := sc.Bytes(); len(line) > 5 && bytes.EqualFold(line[:5], []byte("tags:")) {
+				list = string(line[5:])
+				break
+			}
+		}
+	}
+	list = strings.Trim(strings.TrimSpace(list), "[]")
+	if list == "" {
+		return nil
+	}
+	var tags []string
+	seen := make(map[string]struct{})
+	for _, s := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ';' }) {
+		tag := normalizeTag(strings.Trim(strings.TrimSpace(s), `"'`))
+		if _, ok := seen[tag]; ok || tag == "" {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func normalizeTag(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "#"))
+}
+
+type tagRecord struct {
+	Name  string
+	Count int
+}
+
+// tagsIndex returns all tags found in index sorted by name, along with the
+// number of documents carrying each tag.
+func tagsIndex(index []indexRecord) []tagRecord {
+	counts := make(map[string]int)
+	for _, rec := range index {
+		for _, tag := range rec.Tags {
+			counts[tag]++
+		}
+	}
+	out := make([]tagRecord, 0, len(counts))
+	for name, cnt := range counts {
+		out = append(out, tagRecord{Name: name, Count: cnt})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
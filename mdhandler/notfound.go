@@ -0,0 +1,160 @@
+package mdhandler
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// resolveMissing tries to find a document for request path p which does not
+// exist as is: "/Page" is resolved to "/Page.md", and if there's no exact
+// match, file name is matched case-insensitively against files of the same
+// directory. It returns /-separated path of the found file.
+func (h *Handler) resolveMissing(p string) (string, bool) {
+	p = path.Clean(p)
+	if containsDotDot(p) || p == "/" {
+		return "", false
+	}
+	candidates := []string{path.Base(p)}
+	if !h.isDocument(p) {
+		for _, ext := range h.extensions() {
+			if isRegularFileFS(h.fsys, fsPath(p+ext)) {
+				return p + ext, true
+			}
+		}
+		for _, ext := range h.extensions() {
+			candidates = append(candidates, candidates[0]+ext)
+		}
+	}
+	dir := path.Dir(p)
+	entries, err := fs.ReadDir(h.fsys, fsPath(dir))
+	if err != nil {
+		return "", false
+	}
+	for _, s := range candidates {
+		for _, ent := range entries {
+			if ent.Type().IsRegular() && strings.EqualFold(ent.Name(), s) {
+				return path.Join(dir, ent.Name()), true
+			}
+		}
+	}
+	return "", false
+}
+
+// redirectMissing redirects request for missing file to the document found by
+// resolveMissing. It reports whether redirect was done.
+func (h *Handler) redirectMissing(w http.ResponseWriter, r *http.Request) bool {
+	p, ok := h.resolveMissing(r.URL.Path)
+	if !ok {
+		return false
+	}
+	u := *r.URL
+	u.Path, u.RawPath = h.rootHref(p), ""
+	http.Redirect(w, r, u.String(), http.StatusFound)
+	return true
+}
+
+// notFound responds with a "not found" page listing documents with names
+// similar to the one requested.
+func (h *Handler) notFound(w http.ResponseWriter, r *http.Request) {
+	page := struct {
+		pageHead
+		Path        string
+		Suggestions []indexRecord
+	}{
+		pageHead:    h.pageHead("Page not found"),
+		Path:        r.URL.Path,
+		Suggestions: suggestDocuments(h.dirIndex(nil, ""), h.trimExt(r.URL.Path)),
+	}
+	th := h.theme()
+	h.writeTemplate(w, r, http.StatusNotFound, th.template(notFoundTemplate), page)
+}
+
+// suggestDocuments returns documents from index which names are the closest
+// to the base name of request path p without document extension, ordered by
+// similarity.
+func suggestDocuments(index []indexRecord, p string) []indexRecord {
+	const maxSuggestions = 10
+	key := strings.ToLower(path.Base(p))
+	if key == "" || key == "/" || key == "." {
+		return nil
+	}
+	// allow roughly one typo per three characters
+	maxDist := utf8.RuneCountInString(key) / 3
+	if maxDist < 2 {
+		maxDist = 2
+	}
+	type candidate struct {
+		rec  indexRecord
+		dist int
+	}
+	var candidates []candidate
+	for _, rec := range index {
+		k := rec.sortKey
+		dist := editDistance(key, k)
+		if len(k) > 2 && len(key) > 2 && (strings.Contains(k, key) || strings.Contains(key, k)) {
+			dist = 1 // renamed document with a prefix or a suffix added
+		}
+		if dist <= maxDist {
+			candidates = append(candidates, candidate{rec: rec, dist: dist})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+	var out []indexRecord
+	for _, c := range candidates {
+		out = append(out, c.rec)
+	}
+	return out
+}
+
+// editDistance returns Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range ra {
+		cur[0] = i + 1
+		for j := range rb {
+			cost := 1
+			if ra[i] == rb[j] {
+				cost = 0
+			}
+			cur[j+1] = min3(prev[j+1]+1, cur[j]+1, prev[j]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+var notFoundTemplate = template.Must(parseTemplate("notfound", notFoundTpl))
+
+const notFoundTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{template "head" .}}</head><body id="mdserver-notfound">
+<nav id="site">{{template "logo" .}}<a href="{{.Root}}?index">index</a></nav>
+<h1>{{.Title}}</h1>
+<p>There is no document at <code>{{.Path}}</code>.</p>
+{{with .Suggestions}}<p>Did you mean:</p><ul>
+{{range .}}<li><a href="{{$.Root}}{{.File}}">{{.Title}}</a> <small>{{.File}}</small></li>
+{{end}}</ul>{{end}}</body>
+`
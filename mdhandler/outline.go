@@ -0,0 +1,86 @@
+package mdhandler
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/artyom/mdserver/mdrender"
+)
+
+// outlineItem is a document heading with headings of its section nested
+type outlineItem struct {
+	Level    int           `json:"level"`
+	ID       string        `json:"id"`
+	Text     string        `json:"text"`
+	Children []outlineItem `json:"children,omitempty"`
+}
+
+// outlineTree arranges document headings into a tree, where each heading has
+// the following headings of deeper levels as children. Headings without ids
+// can't be linked to, so they're left out.
+func outlineTree(headings []mdrender.Heading) []outlineItem {
+	var flat []mdrender.Heading
+	for _, h := range headings {
+		if h.ID != "" {
+			flat = append(flat, h)
+		}
+	}
+	var nest func(headings []mdrender.Heading) []outlineItem
+	nest = func(headings []mdrender.Heading) []outlineItem {
+		out := []outlineItem{}
+		for i := 0; i < len(headings); {
+			j := i + 1
+			for j < len(headings) && headings[j].Level > headings[i].Level {
+				j++
+			}
+			out = append(out, outlineItem{
+				Level: headings[i].Level,
+				ID:    headings[i].ID,
+				Text:  headings[i].Text,
+			})
+			if j > i+1 {
+				out[len(out)-1].Children = nest(headings[i+1 : j])
+			}
+			i = j
+		}
+		return out
+	}
+	return nest(flat)
+}
+
+// outlineHTML renders outline as nested lists of links to headings. It
+// returns an empty string if outline has less than two headings, as there's
+// no use in navigating them.
+func outlineHTML(outline []outlineItem) template.HTML {
+	var count func([]outlineItem) int
+	count = func(items []outlineItem) int {
+		n := len(items)
+		for _, it := range items {
+			n += count(it.Children)
+		}
+		return n
+	}
+	if count(outline) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	var write func([]outlineItem)
+	write = func(items []outlineItem) {
+		b.WriteString("<ul>")
+		for _, it := range items {
+			b.WriteString(`<li><a href="#`)
+			b.WriteString(template.HTMLEscapeString(url.PathEscape(it.ID)))
+			b.WriteString(`">`)
+			b.WriteString(template.HTMLEscapeString(it.Text))
+			b.WriteString("</a>")
+			if len(it.Children) != 0 {
+				write(it.Children)
+			}
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</ul>")
+	}
+	write(outline)
+	return template.HTML(b.String())
+}
@@ -0,0 +1,117 @@
+package mdhandler
+
+import (
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/artyom/mdserver/mdrender"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// navFiles are names of documents defining explicit reading order and site
+// navigation, in order of preference: GitHub wiki sidebar and mdBook/GitBook
+// summary.
+var navFiles = []string{"_Sidebar.md", "SUMMARY.md"}
+
+// readingOrder returns documents in the order they are meant to be read: the
+// order of links in the navigation document at the root of served directory,
+// if there is one, or the order of automatically generated index.
+func (h *Handler) readingOrder() []graphLink {
+	for _, name := range navFiles {
+		b, err := fs.ReadFile(h.fsys, name)
+		if err != nil {
+			continue
+		}
+		if out := h.navLinks(name, b); len(out) != 0 {
+			return out
+		}
+	}
+	index := h.dirIndex(nil, "")
+	out := make([]graphLink, 0, len(index))
+	for _, rec := range index {
+		out = append(out, graphLink{Title: rec.Title, File: rec.File})
+	}
+	return out
+}
+
+// navLinks returns unique local documents linked from navigation document
+// file with content b, in order of their appearance.
+func (h *Handler) navLinks(file string, b []byte) []graphLink {
+	opts := mdrender.Options{Rewrite: h.rewrite}
+	if h.wikiLinks {
+		opts.WikiLinks = h.wikiLinkResolver()
+	}
+	doc := mdrender.Parse(b, opts)
+	var out []graphLink
+	seen := make(map[string]struct{})
+	ast.WalkFunc(doc.AST, func(node ast.Node, entering bool) ast.WalkStatus {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering || link.NoteID != 0 {
+			return ast.GoToNext
+		}
+		target, _, ok := h.localLink(file, string(link.Destination))
+		if !ok {
+			return ast.SkipChildren
+		}
+		if _, ok := seen[target]; ok || !h.isDocument(target) {
+			return ast.SkipChildren
+		}
+		seen[target] = struct{}{}
+		title := strings.TrimSpace(mdrender.Text(link))
+		if title == "" {
+			title = nameToTitle(path.Base(target))
+		}
+		out = append(out, graphLink{Title: title, File: target})
+		return ast.SkipChildren
+	})
+	return out
+}
+
+// localLink resolves link destination dst found in document file to a path
+// relative to served directory, returning it along with the link fragment.
+// Links to documents without .md suffix, as GitHub wiki sidebars usually have
+// them, are resolved to matching documents. It returns false for external
+// links.
+func (h *Handler) localLink(file, dst string) (target, fragment string, ok bool) {
+	if h.githubWiki {
+		if s, ok := mdrender.GithubWikiLink(dst); ok {
+			dst = s
+		}
+	}
+	if target, ok = resolveLink(file, dst); !ok {
+		return "", "", false
+	}
+	if !h.isDocument(target) {
+		for _, ext := range h.extensions() {
+			if isRegularFileFS(h.fsys, target+ext) {
+				target += ext
+				break
+			}
+		}
+	}
+	if u, err := url.Parse(dst); err == nil {
+		fragment = u.Fragment
+	}
+	return target, fragment, true
+}
+
+// pageNeighbours returns documents preceding and following file in the
+// reading order. Either of them is nil if there is no such document.
+func (h *Handler) pageNeighbours(file string) (prev, next *graphLink) {
+	order := h.readingOrder()
+	for i := range order {
+		if order[i].File != file {
+			continue
+		}
+		if i > 0 {
+			prev = &order[i-1]
+		}
+		if i < len(order)-1 {
+			next = &order[i+1]
+		}
+		return prev, next
+	}
+	return nil, nil
+}
@@ -0,0 +1,37 @@
+package mdhandler
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path"
+)
+
+// serveManifest serves web app manifest linked by pwa.js, so browsers can
+// install the site as an application if Options.PWA is set.
+func (h *Handler) serveManifest(w http.ResponseWriter, r *http.Request) {
+	_, host := h.requestHost(r)
+	type icon struct {
+		Src   string `json:"src"`
+		Type  string `json:"type,omitempty"`
+		Sizes string `json:"sizes"`
+	}
+	manifest := struct {
+		Name     string `json:"name"`
+		StartURL string `json:"start_url"`
+		Scope    string `json:"scope"`
+		Display  string `json:"display"`
+		Icons    []icon `json:"icons,omitempty"`
+	}{
+		Name:     host,
+		StartURL: h.base + "/",
+		Scope:    h.base + "/",
+		Display:  "standalone",
+	}
+	if h.favicon != "" {
+		manifest.Icons = []icon{{Src: h.rootHref("_assets/" + h.favicon), Type: mime.TypeByExtension(path.Ext(h.favicon)), Sizes: "any"}}
+	}
+	w.Header().Set("Content-Type", "application/manifest+json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(manifest)
+}
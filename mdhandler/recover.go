@@ -0,0 +1,141 @@
+package mdhandler
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// responseState is a http.ResponseWriter recording whether response was
+// started, so a panic can still be reported to the client if it was not.
+type responseState struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *responseState) WriteHeader(code int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseState) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseState) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.started = true
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter, so
+// http.ResponseController can reach its optional methods.
+func (w *responseState) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// recoverPanic recovers panic raised while serving request r, logging it
+// with stack trace. If response was not started yet, client gets error
+// page; otherwise connection is aborted, so truncated response is not taken
+// for a complete one. Must be called deferred.
+func (h *Handler) recoverPanic(w *responseState, r *http.Request) {
+	switch v := recover(); v {
+	case nil:
+		return
+	case http.ErrAbortHandler:
+		panic(v)
+	default:
+		log.Printf("panic serving %s: %v\n%s", r.URL.Path, v, debug.Stack())
+	}
+	if w.started {
+		panic(http.ErrAbortHandler)
+	}
+	h.serverError(w, r, nil)
+}
+
+// serverError logs err, if not nil, and responds with 500 status and error
+// page, unless response was already started.
+func (h *Handler) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		log.Printf("%s: %v", r.URL.Path, err)
+	}
+	h.errorPage(w, r, http.StatusInternalServerError, "Internal server error", "")
+}
+
+// errorPage responds with status and error page with a given title, unless
+// response was already started. Message explains the error to reader; if
+// it's empty, page says that server failed and the error is logged.
+func (h *Handler) errorPage(w http.ResponseWriter, r *http.Request, status int, title, message string) {
+	if rw, ok := w.(*responseState); ok && rw.started {
+		return
+	}
+	page := struct {
+		pageHead
+		Path    string
+		Message string
+	}{
+		pageHead: h.pageHead(title),
+		Path:     r.URL.Path,
+		Message:  message,
+	}
+	th := h.theme()
+	var buf bytes.Buffer
+	if err := th.template(errorTemplate).Execute(&buf, page); err != nil {
+		log.Printf("render error page: %v", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	hdr := w.Header()
+	for _, k := range []string{"Content-Length", "Content-Disposition", "Etag", "Last-Modified"} {
+		hdr.Del(k)
+	}
+	h.setCSP(w, false)
+	hdr.Set("Cache-Control", "no-store")
+	hdr.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// writeTemplate executes t with data and writes result to w with status
+// code. Template is executed to a buffer first, so if it fails, client gets
+// error page instead of a truncated response.
+func (h *Handler) writeTemplate(w http.ResponseWriter, r *http.Request, status int, t *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		h.serverError(w, r, fmt.Errorf("render %s: %w", t.Name(), err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// executeTo executes t with data and writes result to w. Template is executed
+// to a buffer first, so nothing is written if it fails. If w is a
+// http.ResponseWriter, Content-Security-Policy header is set.
+func (h *Handler) executeTo(w io.Writer, t *template.Template, data interface{}) error {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("render %s: %w", t.Name(), err)
+	}
+	if rw, ok := w.(http.ResponseWriter); ok {
+		h.setCSP(rw, false)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var errorTemplate = template.Must(parseTemplate("error", errorTpl))
+
+const errorTpl = `<!doctype html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{template "head" .}}</head><body id="mdserver-error">
+<nav id="site">{{template "logo" .}}<a href="{{.Root}}?index">index</a></nav>
+<h1>{{.Title}}</h1>
+{{with .Message}}<p>{{.}}</p>{{else}}<p>Server failed to respond to request for <code>{{.Path}}</code>. The error
+is logged; please try again later.</p>{{end}}</body>
+`
@@ -0,0 +1,176 @@
+package mdhandler
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/artyom/mdserver/mdrender"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// findUp looks for a file with one of the given names in the directory of
+// document file, then in its parent directories up to the root of h.fsys. It
+// returns path of the found file, or an empty string if none was found.
+func (h *Handler) findUp(file string, names ...string) string {
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		for _, name := range names {
+			p := path.Join(dir, name)
+			if isRegularFileFS(h.fsys, p) {
+				return p
+			}
+		}
+		if dir == "." || dir == "/" {
+			return ""
+		}
+	}
+}
+
+// renderPartial renders document file (path in h.fsys)
+// meant to be embedded into other pages, like a sidebar. Since it's shown on
+// pages from different directories, its local links are rewritten relative
+// to current document, see docHref; links to current document get "current"
+// class. Headings of
+// embedded document get no ids, so they don't clash with ids of the page.
+func (h *Handler) renderPartial(file, current string, offline bool) template.HTML {
+	b, err := fs.ReadFile(h.fsys, file)
+	if err != nil {
+		log.Printf("read %q: %v", file, err)
+		return ""
+	}
+	opts := h.renderOptions()
+	opts.Transform = func(doc ast.Node) {
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			if !entering {
+				return ast.GoToNext
+			}
+			switch n := node.(type) {
+			case *ast.Heading:
+				n.HeadingID = ""
+			case *ast.Link:
+				if n.NoteID != 0 {
+					return ast.GoToNext
+				}
+				target, fragment, ok := h.localLink(file, string(n.Destination))
+				if !ok {
+					return ast.GoToNext
+				}
+				n.Destination = []byte(h.docHref(current, target, fragment, offline))
+				if target != current {
+					return ast.GoToNext
+				}
+				switch {
+				case len(n.AdditionalAttributes) == 0:
+					n.AdditionalAttributes = []string{`class="current"`}
+				case n.AdditionalAttributes[0] == `class="wikilink"`:
+					n.AdditionalAttributes[0] = `class="wikilink current"`
+				}
+			case *ast.Image:
+				if target, ok := resolveLink(file, string(n.Destination)); ok {
+					n.Destination = []byte((&url.URL{Path: h.fileHref(current, target, offline)}).String())
+				}
+			}
+			return ast.GoToNext
+		})
+	}
+	return template.HTML(mdrender.Render(b, opts).HTML)
+}
+
+// docHref returns link to document target (path in h.fsys) with optional
+// fragment, to be used on page of document from. Links are root-relative,
+// unless offline is true: then they're relative to from, and point to .html
+// files instead of .md ones, as in the site archive.
+func (h *Handler) docHref(from, target, fragment string, offline bool) string {
+	if offline && h.isDocument(target) {
+		target = h.trimExt(target) + ".html"
+	}
+	u := url.URL{Path: h.fileHref(from, target, offline), Fragment: fragment}
+	return u.String()
+}
+
+// fileHref returns unescaped path to file target to be used on page of
+// document from; see docHref.
+func (h *Handler) fileHref(from, target string, offline bool) string {
+	if !offline {
+		return h.base + "/" + target
+	}
+	dir := strings.Split(path.Dir(from), "/")
+	if dir[0] == "." {
+		dir = nil
+	}
+	parts := strings.Split(target, "/")
+	for len(dir) != 0 && len(parts) > 1 && dir[0] == parts[0] {
+		dir, parts = dir[1:], parts[1:]
+	}
+	return strings.Repeat("../", len(dir)) + strings.Join(parts, "/")
+}
+
+// baseLinks is a mdrender.Options.Transform function adding Options.BaseURL
+// prefix to root-relative link and image destinations, including ones of
+// wikilinks and rewritten links.
+func (h *Handler) baseLinks(doc ast.Node) {
+	fix := func(dst []byte) []byte {
+		if len(dst) > 1 && dst[0] == '/' && dst[1] != '/' {
+			return append([]byte(h.base), dst...)
+		}
+		return dst
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			if n.NoteID == 0 {
+				n.Destination = fix(n.Destination)
+			}
+		case *ast.Image:
+			n.Destination = fix(n.Destination)
+		}
+		return ast.GoToNext
+	})
+}
+
+// offlineLinks returns mdrender.Options.Transform function rewriting local
+// links of document file for offline copy, see docHref.
+func (h *Handler) offlineLinks(file string) func(ast.Node) {
+	return func(doc ast.Node) {
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			if !entering {
+				return ast.GoToNext
+			}
+			switch n := node.(type) {
+			case *ast.Link:
+				if n.NoteID != 0 || bytes.HasPrefix(n.Destination, []byte("#")) {
+					return ast.GoToNext
+				}
+				if target, fragment, ok := h.localLink(file, string(n.Destination)); ok {
+					n.Destination = []byte(h.docHref(file, target, fragment, true))
+				}
+			case *ast.Image:
+				if target, ok := resolveLink(file, string(n.Destination)); ok {
+					n.Destination = []byte((&url.URL{Path: h.fileHref(file, target, true)}).String())
+				}
+			}
+			return ast.GoToNext
+		})
+	}
+}
+
+// glossaryFile is a name of document defining terms for Options.Glossary
+const glossaryFile = "_Glossary.md"
+
+// readGlossary returns terms defined in glossary document file, see
+// mdrender.Glossary.
+func (h *Handler) readGlossary(file string) map[string]string {
+	b, err := h.readDocument(file)
+	if err != nil {
+		log.Printf("read %q: %v", file, err)
+		return nil
+	}
+	return mdrender.Glossary(b)
+}
@@ -0,0 +1,90 @@
+package mdhandler
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// serveSitemap serves sitemap.xml listing all markdown documents, see
+// https://www.sitemaps.org/protocol.html
+func (h *Handler) serveSitemap(w http.ResponseWriter, r *http.Request) {
+	type sitemapURL struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod,omitempty"`
+	}
+	set := struct {
+		XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []sitemapURL `xml:"url"`
+	}{}
+	base := h.baseURL(r)
+	for _, rec := range h.dirIndex(nil, "") {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     base + (&url.URL{Path: h.base + "/" + rec.File}).String(),
+			LastMod: rec.ModTime.UTC().Format("2006-01-02T15:04:05Z"),
+		})
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(set); err != nil {
+		return
+	}
+	io.WriteString(w, "\n")
+}
+
+// serveRobots serves robots.txt: either the one provided with Options.Robots,
+// the one found in the served directory, or a generated one allowing
+// everything and pointing to sitemap.
+func (h *Handler) serveRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if h.robots != nil {
+		w.Write(h.robots)
+		return
+	}
+	if isRegularFileFS(h.fsys, "robots.txt") {
+		h.fileServer.ServeHTTP(w, r)
+		return
+	}
+	io.WriteString(w, "User-agent: *\nAllow: "+h.base+"/\n\nSitemap: "+h.baseURL(r)+h.base+"/sitemap.xml\n")
+}
+
+// baseURL returns scheme and host part of an absolute URL for the request,
+// without trailing slash.
+func (h *Handler) baseURL(r *http.Request) string {
+	scheme, host := h.requestHost(r)
+	return scheme + "://" + host
+}
+
+// requestHost returns scheme and host the request was made to. If
+// Options.TrustProxy is set, they're taken from X-Forwarded-Proto and
+// X-Forwarded-Host headers, if present and valid. Options.PublicURL, if set,
+// takes precedence over both.
+func (h *Handler) requestHost(r *http.Request) (scheme, host string) {
+	if h.publicURL != "" {
+		scheme, host, _ = strings.Cut(h.publicURL, "://")
+		return scheme, host
+	}
+	scheme, host = "http", strings.TrimSuffix(r.Host, "/")
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if !h.trustProxy {
+		return scheme, host
+	}
+	if s := strings.ToLower(forwardedValue(r.Header, "X-Forwarded-Proto")); s == "http" || s == "https" {
+		scheme = s
+	}
+	if s := forwardedValue(r.Header, "X-Forwarded-Host"); s != "" && !strings.ContainsAny(s, "/\\@?# ") {
+		host = s
+	}
+	return scheme, host
+}
+
+// forwardedValue returns the first value of X-Forwarded-* header, which may
+// hold a comma-separated list if request passed several proxies.
+func forwardedValue(hdr http.Header, key string) string {
+	s, _, _ := strings.Cut(hdr.Get(key), ",")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,84 @@
+package mdhandler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// tableSeparators maps extensions of files rendered with Options.RenderTables
+// to their field separators.
+var tableSeparators = map[string]rune{
+	".csv": ',',
+	".tsv": '\t',
+}
+
+// serveTable renders CSV or TSV file with URL path p as html page with
+// sortable table, which first row is a header. It reports whether page was
+// served: files which are not valid UTF-8 text, can't be parsed, or are
+// larger than Options.MaxSize, are not rendered and should be served as is.
+func (h *Handler) serveTable(w http.ResponseWriter, r *http.Request, p string, comma rune) bool {
+	file := fsPath(p)
+	fi, err := fs.Stat(h.fsys, file)
+	if err != nil || !fi.Mode().IsRegular() || h.checkSize(fi) != nil {
+		return false
+	}
+	b, err := fs.ReadFile(h.fsys, file)
+	if err != nil || !utf8.Valid(b) {
+		return false
+	}
+	release, ok := h.renderSlot(w, r)
+	if !ok {
+		return true
+	}
+	defer release()
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(b, []byte("\ufeff"))))
+	cr.Comma, cr.FieldsPerRecord, cr.LazyQuotes = comma, -1, true
+	var rows [][]string
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false
+		}
+		rows = append(rows, rec)
+	}
+	records := len(rows)
+	if records != 0 {
+		records-- // header
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<h1>%s</h1>\n<p class=\"source-meta\">%d rows · <a href=\"?raw\">raw</a></p>\n",
+		template.HTMLEscapeString(path.Base(file)), records)
+	if len(rows) != 0 {
+		body.WriteString("<div class=\"table-wrapper\"><table class=\"sortable\">\n<thead><tr>")
+		for _, s := range rows[0] {
+			fmt.Fprintf(&body, "<th>%s</th>", template.HTMLEscapeString(s))
+		}
+		body.WriteString("</tr></thead>\n<tbody>\n")
+		for _, row := range rows[1:] {
+			body.WriteString("<tr>")
+			for _, s := range row {
+				fmt.Fprintf(&body, "<td>%s</td>", strings.ReplaceAll(template.HTMLEscapeString(s), "\n", "<br>"))
+			}
+			body.WriteString("</tr>\n")
+		}
+		body.WriteString("</tbody></table></div>\n")
+	}
+	page := pageData{
+		pageHead: h.pageHead(file),
+		Body:     template.HTML(body.String()),
+		Scripts:  []string{"sort.js"},
+	}
+	h.servePage(w, r, page, fi.ModTime())
+	return true
+}
@@ -0,0 +1,252 @@
+package mdhandler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// theme holds stylesheet embedded into pages and templates overriding
+// built-in ones.
+type theme struct {
+	style     string    // stylesheet, or its path if it's linked
+	styleHash string    // sha256-{HASH} value for CSP
+	styleTime time.Time // modification time of Options.CSSFile
+	templates map[string]*template.Template
+}
+
+// template returns template overriding built-in one, or built-in one if it's
+// not overridden.
+func (th *theme) template(builtin *template.Template) *template.Template {
+	if t, ok := th.templates[builtin.Name()]; ok {
+		return t
+	}
+	return builtin
+}
+
+// builtinTemplates are templates that can be overridden by files from
+// Options.Templates directory, named after template name with ".html" suffix.
+var builtinTemplates = []*template.Template{
+	pageTemplate,
+	indexTemplate,
+	tagsTemplate,
+	notFoundTemplate,
+	errorTemplate,
+	historyTemplate,
+	diffTemplate,
+	editTemplate,
+}
+
+// themeWatcher reloads Options.CSSFile and templates from Options.Templates
+// directory when they change, checking files at most once a second.
+type themeWatcher struct {
+	css string // Options.CSSFile, if any
+	dir string // Options.Templates, if any
+
+	mu      sync.Mutex
+	checked time.Time
+	mtimes  map[string]time.Time // modification times of loaded files
+	cur     *theme
+}
+
+// theme returns current theme, reloading it if any of its files changed.
+func (h *Handler) theme() *theme {
+	if h.themes == nil {
+		return &theme{style: h.style, styleHash: h.styleHash, styleTime: h.styleTime}
+	}
+	return h.themes.load(h.linkStyle, h.style)
+}
+
+// load returns current theme, reloading changed files. Stylesheet is only
+// reloaded if it's embedded into pages, linked stylesheet is served as a
+// regular file. Failing to read or parse a file is logged, and previously
+// loaded version is kept.
+func (tw *themeWatcher) load(linkStyle bool, style string) *theme {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.cur != nil && time.Since(tw.checked) < time.Second {
+		return tw.cur
+	}
+	tw.checked = time.Now()
+	if tw.mtimes == nil {
+		tw.mtimes = make(map[string]time.Time)
+	}
+	th := &theme{style: style}
+	if tw.cur != nil {
+		*th = *tw.cur
+	}
+	changed := tw.cur == nil
+	if tw.css != "" && !linkStyle {
+		if fi, err := os.Stat(tw.css); err != nil {
+			log.Printf("stylesheet: %v", err)
+		} else if mtime := fi.ModTime(); !mtime.Equal(tw.mtimes[tw.css]) {
+			if b, err := os.ReadFile(tw.css); err != nil {
+				log.Printf("stylesheet: %v", err)
+			} else {
+				tw.mtimes[tw.css] = mtime
+				th.style, th.styleTime = string(b), mtime
+				changed = true
+			}
+		}
+	}
+	if tw.dir != "" {
+		templates := make(map[string]*template.Template, len(th.templates))
+		for _, builtin := range builtinTemplates {
+			name := filepath.Join(tw.dir, builtin.Name()+".html")
+			fi, err := os.Stat(name)
+			if err != nil {
+				if _, ok := tw.mtimes[name]; ok {
+					delete(tw.mtimes, name)
+					changed = true
+				}
+				continue
+			}
+			if mtime := fi.ModTime(); mtime.Equal(tw.mtimes[name]) {
+				if t, ok := th.templates[builtin.Name()]; ok {
+					templates[builtin.Name()] = t
+				}
+				continue
+			}
+			tw.mtimes[name] = fi.ModTime()
+			changed = true
+			b, err := os.ReadFile(name)
+			if err != nil {
+				log.Printf("template: %v", err)
+				continue
+			}
+			t, err := parseTemplate(builtin.Name(), string(b))
+			if err != nil {
+				log.Printf("template: %v", err)
+				if t, ok := th.templates[builtin.Name()]; ok {
+					templates[builtin.Name()] = t
+				}
+				continue
+			}
+			templates[builtin.Name()] = t
+		}
+		th.templates = templates
+	}
+	if !changed {
+		return tw.cur
+	}
+	if !linkStyle {
+		sum := sha256.Sum256([]byte(th.style))
+		th.styleHash = "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	tw.cur = th
+	return th
+}
+
+// Files in the served tree applied to documents of their parent directory
+// and its subdirectories if Options.DirThemes is set; the nearest one wins.
+const (
+	dirStyleFile    = ".mdserver/style.css"
+	dirTemplateFile = ".mdserver/page.html"
+)
+
+// dirTemplates caches page templates loaded from dirTemplateFile files,
+// keyed by their paths.
+type dirTemplates struct {
+	mu sync.Mutex
+	m  map[string]dirTemplate
+}
+
+type dirTemplate struct {
+	mtime time.Time
+	t     *template.Template // nil if template failed to parse
+}
+
+// dirTemplate returns page template parsed from file, reloading it if file
+// changed. It returns nil if file cannot be read or parsed, in which case
+// error is logged once per file modification.
+func (h *Handler) dirTemplate(file string) *template.Template {
+	fi, err := fs.Stat(h.fsys, file)
+	if err != nil {
+		log.Printf("template: %v", err)
+		return nil
+	}
+	h.dirTpls.mu.Lock()
+	defer h.dirTpls.mu.Unlock()
+	if dt, ok := h.dirTpls.m[file]; ok && dt.mtime.Equal(fi.ModTime()) {
+		return dt.t
+	}
+	if h.dirTpls.m == nil {
+		h.dirTpls.m = make(map[string]dirTemplate)
+	}
+	dt := dirTemplate{mtime: fi.ModTime()}
+	if b, err := fs.ReadFile(h.fsys, file); err != nil {
+		log.Printf("template: %v", err)
+	} else if dt.t, err = parseTemplate(pageTemplate.Name(), string(b)); err != nil {
+		log.Printf("template %s: %v", file, err)
+	}
+	h.dirTpls.m[file] = dt
+	return dt.t
+}
+
+// Stylesheet under /_assets/ pages link if Options.Themes is set, and the
+// cookie keeping theme reader selected for it.
+const (
+	themeCSS    = "theme.css"
+	themeCookie = "mdserver-theme"
+)
+
+// isThemeName reports whether s is a valid name of Options.Themes entry
+var isThemeName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString
+
+// selectTheme handles "?theme=name" query parameter of any page: it keeps name
+// of Options.Themes entry in a cookie and redirects to the same URL without
+// this parameter. Empty name selects the default theme.
+func (h *Handler) selectTheme(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("theme")
+	if _, ok := h.styles[name]; !ok && name != "" {
+		http.Error(w, "unknown theme", http.StatusBadRequest)
+		return
+	}
+	c := &http.Cookie{Name: themeCookie, Value: name, Path: h.base + "/", MaxAge: 365 * 24 * 60 * 60, SameSite: http.SameSiteLaxMode}
+	if name == "" {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+	var query []string
+	for _, s := range strings.Split(r.URL.RawQuery, "&") {
+		if k, _, _ := strings.Cut(s, "="); k != "theme" && s != "" {
+			query = append(query, s)
+		}
+	}
+	u := url.URL{Path: h.rootHref(r.URL.Path), RawQuery: strings.Join(query, "&")}
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// serveThemeCSS serves stylesheet of theme selected with selectTheme, or an
+// empty one if reader uses the default theme. Response depends on cookie, so
+// browsers have to revalidate it on every use.
+func (h *Handler) serveThemeCSS(w http.ResponseWriter, r *http.Request) {
+	markStatic(r)
+	var b []byte
+	if c, err := r.Cookie(themeCookie); err == nil {
+		if name, ok := h.styles[c.Value]; ok {
+			if b, err = os.ReadFile(name); err != nil {
+				log.Printf("theme: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	sum := sha256.Sum256(b)
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Cookie")
+	w.Header().Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:12])+`"`)
+	http.ServeContent(w, r, themeCSS, time.Time{}, bytes.NewReader(b))
+}
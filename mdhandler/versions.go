@@ -0,0 +1,53 @@
+package mdhandler
+
+import (
+	"path"
+	"strings"
+)
+
+// versionLink is an entry of version picker shown on pages of documents
+// kept in directories listed in Options.Versions.
+type versionLink struct {
+	Name    string
+	Href    string
+	Current bool // version of the page itself
+	Missing bool // version has no such document, Href points to its root
+}
+
+// versionLinks returns version picker entries for document file, or nil if
+// it doesn't belong to any of Options.Versions. Each entry links to the
+// document with the same path in another version if it exists, or to the
+// root of that version otherwise.
+func (h *Handler) versionLinks(file string, offline bool) []versionLink {
+	cur, rest, ok := strings.Cut(file, "/")
+	if !ok || !h.isVersion(cur) {
+		return nil
+	}
+	out := make([]versionLink, 0, len(h.versions))
+	for _, v := range h.versions {
+		link := versionLink{Name: v, Current: v == cur}
+		target := path.Join(v, rest)
+		switch {
+		case link.Current || isRegularFileFS(h.fsys, target):
+			link.Href = h.docHref(file, target, "", offline)
+		default:
+			link.Missing = true
+			if p, ok := h.dirReadme("/" + v + "/"); ok {
+				link.Href = h.docHref(file, strings.TrimPrefix(p, "/"), "", offline)
+			} else {
+				link.Href = h.docHref(file, v+"/", "", offline)
+			}
+		}
+		out = append(out, link)
+	}
+	return out
+}
+
+func (h *Handler) isVersion(dir string) bool {
+	for _, v := range h.versions {
+		if v == dir {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package mdhandler
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+
+	"golang.org/x/net/webdav"
+)
+
+// newDAVHandler returns handler serving files over WebDAV under /dav/ path.
+// Unless writable is true, files are served from h.fsys and any attempts to
+// modify them are rejected. Writable handler serves files from h.dir.
+func (h *Handler) newDAVHandler(writable bool) http.Handler {
+	dav := &webdav.Handler{
+		Prefix:     h.base + "/dav",
+		FileSystem: readOnlyDAV{h.fsys},
+		LockSystem: webdav.NewMemLS(),
+	}
+	if writable {
+		dav.FileSystem = webdav.Dir(h.dir)
+		return dav
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+			dav.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+			http.Error(w, "read-only WebDAV access", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// readOnlyDAV is a webdav.FileSystem serving files from fs.FS
+type readOnlyDAV struct{ fsys fs.FS }
+
+func (d readOnlyDAV) OpenFile(_ context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	f, err := http.FS(d.fsys).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{f}, nil
+}
+
+func (d readOnlyDAV) Stat(_ context.Context, name string) (fs.FileInfo, error) {
+	return fs.Stat(d.fsys, fsPath(path.Clean("/"+name)))
+}
+
+func (readOnlyDAV) Mkdir(_ context.Context, name string, _ os.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+}
+
+func (readOnlyDAV) RemoveAll(_ context.Context, name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+}
+
+func (readOnlyDAV) Rename(_ context.Context, oldName, _ string) error {
+	return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrPermission}
+}
+
+type readOnlyFile struct{ http.File }
+
+func (f readOnlyFile) Write([]byte) (int, error) {
+	return 0, fs.ErrPermission
+}
@@ -0,0 +1,55 @@
+package mdhandler
+
+import (
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/artyom/mdserver/mdrender"
+)
+
+// wikiLinkResolver returns mdrender.WikiLinkResolver resolving page names to
+// markdown documents found in h.fsys. Page names are matched against file
+// names without extension case-insensitively, treating spaces, dashes and
+// underscores as equal. Names with slashes are matched against paths relative
+// to the root. If multiple documents have the same name, the one closer to the
+// root wins.
+func (h *Handler) wikiLinkResolver() mdrender.WikiLinkResolver {
+	pages := make(map[string]string) // wikiKey(name) -> /-separated path
+	fn := func(rel string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && rel != "." && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !h.isDocument(rel) {
+			return nil
+		}
+		for _, key := range []string{wikiKey(h.trimExt(path.Base(rel))), wikiKey(h.trimExt(rel))} {
+			if old, ok := pages[key]; !ok || strings.Count(old, "/") > strings.Count(rel, "/") {
+				pages[key] = rel
+			}
+		}
+		return nil
+	}
+	_ = fs.WalkDir(h.fsys, ".", fn)
+	return func(target string) (string, bool) {
+		name, fragment, _ := strings.Cut(target, "#")
+		rel, ok := pages[wikiKey(h.trimExt(strings.TrimPrefix(name, "/")))]
+		if !ok {
+			rel = strings.TrimPrefix(name, "/") + h.extensions()[0]
+		}
+		u := url.URL{Path: "/" + rel, Fragment: fragment}
+		return u.String(), ok
+	}
+}
+
+// wikiKey returns key wikilinks to document with name (without extension)
+// are matched by.
+func wikiKey(name string) string {
+	return wikiKeyReplacer.Replace(strings.ToLower(name))
+}
+
+var wikiKeyReplacer = strings.NewReplacer(" ", "-", "_", "-")
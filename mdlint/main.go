@@ -0,0 +1,179 @@
+// Command mdlint checks markdown files against a set of rules.
+//
+// Arguments are markdown files or directories to check; directories are
+// walked recursively, skipping hidden ones. Each rule can be disabled with
+// -disable flag, -list flag prints all known rules. Rule checking front matter
+// fields is only enabled when fields are listed with -require flag, as in
+// "-require title,tags". Problems are reported one
+// per line, or as JSON array if run with -json flag. Program exits with
+// non-zero code if any problems were found.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/artyom/autoflags"
+	"github.com/artyom/mdserver/mdrender"
+)
+
+func main() {
+	args := runArgs{MaxLine: 120}
+	autoflags.Parse(&args)
+	if err := run(args, flag.Args()); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+}
+
+type runArgs struct {
+	Disable string `flag:"disable,comma-separated list of rules to disable"`
+	MaxLine int    `flag:"max-line,maximum line length for line-length rule"`
+	Require string `flag:"require,comma-separated list of required front matter fields (enables front-matter rule)"`
+	JSON    bool   `flag:"json,report problems as JSON"`
+	List    bool   `flag:"list,list known rules and exit"`
+}
+
+func run(args runArgs, paths []string) error {
+	if args.List {
+		for _, r := range rules {
+			fmt.Printf("%-16s %s\n", r.name, r.desc)
+		}
+		return nil
+	}
+	if len(paths) == 0 {
+		return errors.New("no files to check, provide them as arguments")
+	}
+	cfg := config{maxLine: args.MaxLine, disabled: make(map[string]bool)}
+	for _, s := range splitList(args.Disable) {
+		if ruleByName(s) == nil {
+			return fmt.Errorf("unknown rule %q, run with -list to see known rules", s)
+		}
+		cfg.disabled[s] = true
+	}
+	cfg.required = splitList(args.Require)
+	if len(cfg.required) == 0 {
+		cfg.disabled[ruleFrontMatter] = true
+	}
+	files, err := collectFiles(paths)
+	if err != nil {
+		return err
+	}
+	problems := []problem{}
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, lint(name, b, &cfg)...)
+	}
+	if args.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(problems); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("found %d problem(s)", len(problems))
+	}
+	return nil
+}
+
+// collectFiles returns markdown files found in paths; directories are walked
+// recursively.
+func collectFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		fn := func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && p != "." && strings.HasPrefix(filepath.Base(p), ".") {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && strings.HasSuffix(p, ".md") {
+				files = append(files, p)
+			}
+			return nil
+		}
+		if err := filepath.Walk(p, fn); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// lint checks document against all enabled rules
+func lint(name string, b []byte, cfg *config) []problem {
+	meta, body := mdrender.FrontMatter(b)
+	d := &document{
+		name:  name,
+		meta:  meta,
+		lines: strings.Split(string(b), "\n"),
+		ast:   mdrender.NewParser().Parse(body),
+	}
+	d.bodyLine = strings.Count(string(b[:len(b)-len(body)]), "\n")
+	var out []problem
+	for _, r := range rules {
+		if cfg.disabled[r.name] {
+			continue
+		}
+		for _, p := range r.check(d, cfg) {
+			p.File, p.Rule = name, r.name
+			out = append(out, p)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Line < out[j].Line })
+	return out
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+type config struct {
+	disabled map[string]bool
+	maxLine  int
+	required []string // required front matter fields
+}
+
+type problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (p problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s (%s)", p.File, p.Line, p.Message, p.Rule)
+	}
+	return fmt.Sprintf("%s: %s (%s)", p.File, p.Message, p.Rule)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestLint(t *testing.T) {
+	src := "# One\n\n### Three\n\nSee https://example.com, not <https://example.org>.\n\n# Two\n"
+	cfg := &config{maxLine: 80, disabled: map[string]bool{ruleFrontMatter: true}}
+	want := []problem{
+		{Line: 3, Rule: "heading-levels"},
+		{Line: 5, Rule: "bare-url"},
+		{Line: 7, Rule: "single-h1"},
+	}
+	got := lint("doc.md", []byte(src), cfg)
+	if len(got) != len(want) {
+		t.Fatalf("got problems: %v, want %d", got, len(want))
+	}
+	for i, p := range got {
+		if p.Line != want[i].Line || p.Rule != want[i].Rule {
+			t.Errorf("problem %d: got %v, want rule %s at line %d", i, p, want[i].Rule, want[i].Line)
+		}
+	}
+}
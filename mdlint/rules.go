@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/artyom/mdserver/mdrender"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// rule is a single check applied to every document. To add a new rule,
+// implement its check function and add it to rules list.
+type rule struct {
+	name  string
+	desc  string
+	check func(d *document, cfg *config) []problem
+}
+
+var rules = []rule{
+	{"single-h1", "document has at most one top level header", checkSingleH1},
+	{"heading-levels", "header levels increase by one at a time", checkHeadingLevels},
+	{"bare-url", "URLs are written as links, not as bare text", checkBareURLs},
+	{"line-length", "lines are not longer than -max-line characters", checkLineLength},
+	{ruleFrontMatter, "front matter has all fields listed with -require flag", checkFrontMatter},
+}
+
+const ruleFrontMatter = "front-matter"
+
+func ruleByName(name string) *rule {
+	for i := range rules {
+		if rules[i].name == name {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// document is a parsed markdown file
+type document struct {
+	name     string
+	meta     []byte   // front matter
+	lines    []string // all lines of file, including front matter
+	bodyLine int      // number of lines taken by front matter
+	ast      ast.Node // parsed document body
+}
+
+// headingLine returns 1-based number of the first line after line from
+// which looks like a header with given text, or 0 if no such line found.
+func (d *document) headingLine(text string, from int) int {
+	for i := from; i < len(d.lines); i++ {
+		if l := strings.TrimSpace(d.lines[i]); strings.Contains(l, text) &&
+			(strings.HasPrefix(l, "#") || i+1 < len(d.lines) && isSetextUnderline(d.lines[i+1])) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func isSetextUnderline(s string) bool {
+	s = strings.TrimSpace(s)
+	return s != "" && (strings.Trim(s, "=") == "" || strings.Trim(s, "-") == "")
+}
+
+// heading is a document header along with its line number
+type heading struct {
+	mdrender.Heading
+	line int
+}
+
+// headings returns document headings along with their line numbers
+func (d *document) headings() []heading {
+	var out []heading
+	from := d.bodyLine
+	for _, h := range mdrender.Headings(d.ast) {
+		line := d.headingLine(h.Text, from)
+		if line > 0 {
+			from = line
+		}
+		out = append(out, heading{h, line})
+	}
+	return out
+}
+
+func checkSingleH1(d *document, _ *config) []problem {
+	var out []problem
+	var seen bool
+	for _, h := range d.headings() {
+		if h.Level != 1 {
+			continue
+		}
+		if seen {
+			out = append(out, problem{Line: h.line, Message: fmt.Sprintf("extra top level header %q", h.Text)})
+		}
+		seen = true
+	}
+	return out
+}
+
+func checkHeadingLevels(d *document, _ *config) []problem {
+	var out []problem
+	prev := 0
+	for _, h := range d.headings() {
+		if prev != 0 && h.Level > prev+1 {
+			out = append(out, problem{Line: h.line,
+				Message: fmt.Sprintf("header %q jumps from level %d to %d", h.Text, prev, h.Level)})
+		}
+		prev = h.Level
+	}
+	return out
+}
+
+func checkBareURLs(d *document, _ *config) []problem {
+	var out []problem
+	var fence string
+	for i, line := range d.lines[d.bodyLine:] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		case strings.HasPrefix(trimmed, "```"):
+			fence = "```"
+			continue
+		case strings.HasPrefix(trimmed, "~~~"):
+			fence = "~~~"
+			continue
+		case strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t"):
+			continue // indented code block
+		}
+		line = inlineCode.ReplaceAllString(line, "")
+		for _, m := range bareURL.FindAllStringSubmatchIndex(line, -1) {
+			if m[2] >= 0 { // preceded by a character marking it as a link
+				continue
+			}
+			out = append(out, problem{Line: d.bodyLine + i + 1,
+				Message: fmt.Sprintf("bare URL %s", line[m[4]:m[5]])})
+		}
+	}
+	return out
+}
+
+var (
+	inlineCode = regexp.MustCompile("`[^`]*`")
+	bareURL    = regexp.MustCompile(`([(<\["'=]|\]: *)?(https?://[^\s<>)\]]+)`)
+)
+
+func checkLineLength(d *document, cfg *config) []problem {
+	if cfg.maxLine <= 0 {
+		return nil
+	}
+	var out []problem
+	for i, line := range d.lines {
+		if n := utf8.RuneCountInString(strings.TrimRight(line, "\r")); n > cfg.maxLine {
+			out = append(out, problem{Line: i + 1,
+				Message: fmt.Sprintf("line is %d characters long, limit is %d", n, cfg.maxLine)})
+		}
+	}
+	return out
+}
+
+func checkFrontMatter(d *document, cfg *config) []problem {
+	if d.meta == nil {
+		return []problem{{Line: 1, Message: "no front matter"}}
+	}
+	var out []problem
+	for _, field := range cfg.required {
+		if mdrender.FrontMatterValue(d.meta, field) == "" {
+			out = append(out, problem{Line: 1, Message: fmt.Sprintf("front matter has no %q field", field)})
+		}
+	}
+	return out
+}
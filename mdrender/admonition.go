@@ -0,0 +1,134 @@
+package mdrender
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// admonitionMarker matches GitHub-style admonition marker like "[!NOTE]" at
+// the beginning of blockquote text, optionally followed by a custom title on
+// the same line.
+var admonitionMarker = regexp.MustCompile(`(?i)^\[!(note|tip|important|warning|caution)\][ \t]*([^\n]*)(\n|$)`)
+
+// admonitionTitles are default titles of admonition kinds
+var admonitionTitles = map[string]string{
+	"note":      "Note",
+	"tip":       "Tip",
+	"important": "Important",
+	"warning":   "Warning",
+	"caution":   "Caution",
+}
+
+const admonitionClass = "admonition"
+
+// admonitions finds blockquotes starting with GitHub-style markers like
+// "[!NOTE]" or "[!WARNING]", removes these markers and marks such
+// blockquotes to be rendered as admonitions by renderAdmonition.
+//
+// Parser merges consecutive blockquotes separated by blank lines into one,
+// so blockquote is split before each paragraph starting with a marker.
+func admonitions(doc ast.Node) {
+	var quotes []*ast.BlockQuote
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if quote, ok := node.(*ast.BlockQuote); ok && entering && !isDetails(quote) {
+			quotes = append(quotes, quote)
+		}
+		return ast.GoToNext
+	})
+	for _, quote := range quotes {
+		var out []ast.Node
+		children := quote.GetChildren()
+		cur := quote
+		cur.Children = nil
+		for _, child := range children {
+			if kind, title, ok := admonitionStart(child); ok {
+				if len(cur.Children) != 0 {
+					out = append(out, cur)
+				}
+				cur = &ast.BlockQuote{}
+				cur.Attribute = &ast.Attribute{
+					Classes: [][]byte{[]byte(admonitionClass), []byte(kind)},
+					Attrs:   map[string][]byte{"title": []byte(title)},
+				}
+				if len(child.GetChildren()) == 0 {
+					continue
+				}
+			}
+			child.SetParent(cur)
+			cur.Children = append(cur.Children, child)
+		}
+		if len(cur.Children) != 0 || cur.Attribute != nil {
+			out = append(out, cur)
+		}
+		replaceNode(quote, out)
+	}
+}
+
+// admonitionStart reports whether node is a paragraph starting with
+// admonition marker, removing the marker. Returned title is either the one
+// following the marker, or the default one for its kind.
+func admonitionStart(node ast.Node) (kind, title string, ok bool) {
+	para, ok := node.(*ast.Paragraph)
+	if !ok {
+		return "", "", false
+	}
+	text, ok := ast.GetFirstChild(para).(*ast.Text)
+	if !ok {
+		return "", "", false
+	}
+	m := admonitionMarker.FindSubmatch(text.Literal)
+	if m == nil {
+		return "", "", false
+	}
+	kind = strings.ToLower(string(m[1]))
+	if title = string(bytes.TrimSpace(m[2])); title == "" {
+		title = admonitionTitles[kind]
+	}
+	if text.Literal = text.Literal[len(m[0]):]; len(text.Literal) == 0 {
+		ast.RemoveFromTree(text)
+	}
+	return kind, title, true
+}
+
+// replaceNode replaces node in its parent children with nodes
+func replaceNode(node ast.Node, nodes []ast.Node) {
+	parent := node.GetParent()
+	if parent == nil {
+		return
+	}
+	var children []ast.Node
+	for _, child := range parent.GetChildren() {
+		if child != node {
+			children = append(children, child)
+			continue
+		}
+		for _, n := range nodes {
+			n.SetParent(parent)
+			children = append(children, n)
+		}
+	}
+	parent.SetChildren(children)
+}
+
+// renderAdmonition is a html.RenderNodeFunc rendering blockquotes marked by
+// admonitions as div elements with a title paragraph.
+func renderAdmonition(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	quote, ok := node.(*ast.BlockQuote)
+	if !ok || quote.Attribute == nil || len(quote.Attribute.Classes) != 2 ||
+		!bytes.Equal(quote.Attribute.Classes[0], []byte(admonitionClass)) {
+		return ast.GoToNext, false
+	}
+	if !entering {
+		io.WriteString(w, "</div>\n")
+		return ast.GoToNext, true
+	}
+	fmt.Fprintf(w, "\n<div class=\"%[1]s %[2]s\"><p class=\"%[1]s-title\">%[3]s</p>\n", admonitionClass,
+		quote.Attribute.Classes[1], html.EscapeString(string(quote.Attribute.Attrs["title"])))
+	return ast.GoToNext, true
+}
@@ -0,0 +1,183 @@
+package mdrender
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// codeAttrs are attributes of fenced code block given in braces after its
+// language, like "```go {linenos=true, hl_lines=[3, "5-7"]}", in the same
+// form Hugo takes them, see fenceAttrs.
+type codeAttrs struct {
+	lang      string
+	linenos   bool
+	start     int          // number of the first line, linenostart
+	highlight map[int]bool // numbers of highlighted lines, hl_lines
+}
+
+// parseCodeInfo parses info string of fenced code block, which is made by
+// parser from "```{go linenos=true}" line as "go linenos=true". It reports
+// false if info has no attributes.
+func parseCodeInfo(info string) (codeAttrs, bool) {
+	if !strings.Contains(info, "=") {
+		return codeAttrs{}, false
+	}
+	attrs := codeAttrs{start: 1}
+	fields := splitCodeAttrs(info)
+	if len(fields) != 0 && !strings.Contains(fields[0], "=") {
+		attrs.lang, fields = fields[0], fields[1:]
+	}
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "linenos":
+			attrs.linenos = value != "false"
+		case "linenostart":
+			if n, err := strconv.Atoi(value); err == nil {
+				attrs.start = n
+			}
+		case "hl_lines":
+			attrs.highlight = parseLineRanges(value)
+		}
+	}
+	return attrs, true
+}
+
+// fenceAttr matches opening line of fenced code block with attributes in
+// braces after the language, like "```go {linenos=true}"
+var fenceAttr = regexp.MustCompile("^( *)(```+|~~~+)[ \t]*([^\\s`{}]+)[ \t]*\\{([^`{}]*)\\}[ \t]*$")
+
+// fenceAttrs returns markdown document src with opening lines of fenced code
+// blocks like "```go {linenos=true}" rewritten as "```{go linenos=true}":
+// parser only takes a single word or braces alone as code block info, and
+// the former makes such lines plain text.
+func fenceAttrs(src []byte) []byte {
+	if !bytes.Contains(src, []byte("}")) {
+		return src
+	}
+	var out bytes.Buffer
+	var fence []byte // opening fence of current code block, if any
+	for rest := src; len(rest) != 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+		trimmed := bytes.TrimLeft(line, " ")
+		switch {
+		case fence != nil:
+			if bytes.HasPrefix(trimmed, fence) && len(bytes.TrimSpace(bytes.TrimLeft(trimmed, string(fence[:1])))) == 0 {
+				fence = nil
+			}
+		case bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")):
+			fence = trimmed[:len(trimmed)-len(bytes.TrimLeft(trimmed, string(trimmed[:1])))]
+			if m := fenceAttr.FindSubmatch(bytes.TrimRight(line, "\r\n")); m != nil {
+				fmt.Fprintf(&out, "%s%s{%s %s}%s", m[1], m[2], m[3], bytes.TrimSpace(m[4]), line[len(bytes.TrimRight(line, "\r\n")):])
+				continue
+			}
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// splitCodeAttrs splits attributes separated by commas or spaces, keeping
+// lists in square brackets whole.
+func splitCodeAttrs(s string) []string {
+	var out []string
+	var depth, start int
+	for i, r := range s {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case (r == ',' || r == ' ') && depth == 0:
+			if f := strings.TrimSpace(s[start:i]); f != "" {
+				out = append(out, f)
+			}
+			start = i + 1
+		}
+	}
+	if f := strings.TrimSpace(s[start:]); f != "" {
+		out = append(out, f)
+	}
+	// join "key = value" split on spaces
+	for i := 0; i < len(out); i++ {
+		for i+1 < len(out) && (strings.HasSuffix(out[i], "=") || strings.HasPrefix(out[i+1], "=")) {
+			out[i] += out[i+1]
+			out = append(out[:i+1], out[i+2:]...)
+		}
+	}
+	return out
+}
+
+// parseLineRanges parses list of line numbers and ranges like "[3, "5-7"]"
+// or "3 5-7".
+func parseLineRanges(s string) map[int]bool {
+	lines := make(map[int]bool)
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune("[], \"'", r) }) {
+		from, to, ok := strings.Cut(f, "-")
+		a, err := strconv.Atoi(from)
+		if err != nil {
+			continue
+		}
+		b := a
+		if ok {
+			if b, err = strconv.Atoi(to); err != nil || b < a || b-a > 10000 {
+				continue
+			}
+		}
+		for n := a; n <= b; n++ {
+			lines[n] = true
+		}
+	}
+	return lines
+}
+
+// renderCodeBlock is a html.RenderNodeFunc rendering fenced code blocks with
+// attributes (see codeAttrs) line by line: each line is a "line" span, with
+// "hl" class if it's highlighted, and is prefixed with "lineno" span if
+// line numbers are enabled.
+func renderCodeBlock(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	block, ok := node.(*ast.CodeBlock)
+	if !ok {
+		return ast.GoToNext, false
+	}
+	attrs, ok := parseCodeInfo(string(block.Info))
+	if !ok {
+		return ast.GoToNext, false
+	}
+	io.WriteString(w, "\n<pre><code")
+	if attrs.lang != "" {
+		fmt.Fprintf(w, ` class="language-%s"`, html.EscapeString(attrs.lang))
+	}
+	io.WriteString(w, ">")
+	lines := bytes.SplitAfter(block.Literal, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		n := attrs.start + i
+		if attrs.highlight[n] {
+			io.WriteString(w, `<span class="line hl">`)
+		} else {
+			io.WriteString(w, `<span class="line">`)
+		}
+		if attrs.linenos {
+			fmt.Fprintf(w, `<span class="lineno">%d</span>`, n)
+		}
+		io.WriteString(w, html.EscapeString(string(line)))
+		io.WriteString(w, "</span>")
+	}
+	io.WriteString(w, "</code></pre>\n")
+	return ast.GoToNext, true
+}
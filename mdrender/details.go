@@ -0,0 +1,90 @@
+package mdrender
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+var (
+	detailsOpen    = regexp.MustCompile(`(?i)^<details\b[^>]*>[ \t]*(\r?\n)?[ \t]*(<summary\b[^>]*>(?s:.*?)</summary>)?`)
+	detailsTagOpen = regexp.MustCompile(`(?i)<details\b`)
+	detailsClose   = regexp.MustCompile(`(?i)</details\s*>`)
+)
+
+// detailsAttr is the attribute of blockquotes holding contents of
+// <details> elements, set to the opening <details> and <summary> tags.
+const detailsAttr = "details"
+
+// parseDetails is a parser.BlockFunc handling blocks starting with <details>
+// tag. Parser treats the whole element as raw html, so markdown inside it
+// is left unrendered; this hook makes a blockquote node marked with
+// detailsAttr holding the element contents parsed as markdown, so it's
+// rendered by renderDetails. Elements without closing tag are left to
+// parser.
+func parseDetails(data []byte) (ast.Node, []byte, int) {
+	m := detailsOpen.FindIndex(data)
+	if m == nil {
+		return nil, nil, 0
+	}
+	head := data[:m[1]]
+	depth := 1
+	var fence []byte // opening fence of current code block, if any
+	for off := m[1]; off < len(data); {
+		line := data[off:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		trimmed := bytes.TrimLeft(line, " ")
+		switch {
+		case fence != nil:
+			if bytes.HasPrefix(trimmed, fence) {
+				fence = nil
+			}
+		case bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")):
+			fence = trimmed[:3]
+		default:
+			opens := detailsTagOpen.FindAllIndex(line, -1)
+			for _, c := range detailsClose.FindAllIndex(line, -1) {
+				for len(opens) != 0 && opens[0][0] < c[0] {
+					opens, depth = opens[1:], depth+1
+				}
+				if depth--; depth != 0 {
+					continue
+				}
+				end := off + c[0]
+				inner := append(bytes.TrimSpace(data[m[1]:end:end]), '\n')
+				node := &ast.BlockQuote{}
+				node.Attribute = &ast.Attribute{Attrs: map[string][]byte{detailsAttr: head}}
+				return node, inner, off + len(line)
+			}
+			depth += len(opens)
+		}
+		off += len(line)
+	}
+	return nil, nil, 0
+}
+
+// isDetails reports whether node is a blockquote made by parseDetails
+func isDetails(node ast.Node) bool {
+	quote, ok := node.(*ast.BlockQuote)
+	return ok && quote.Attribute != nil && quote.Attribute.Attrs[detailsAttr] != nil
+}
+
+// renderDetails is a html.RenderNodeFunc rendering blockquotes made by
+// parseDetails as <details> elements.
+func renderDetails(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	if !isDetails(node) {
+		return ast.GoToNext, false
+	}
+	if entering {
+		io.WriteString(w, "\n")
+		w.Write(node.(*ast.BlockQuote).Attribute.Attrs[detailsAttr])
+		io.WriteString(w, "\n")
+	} else {
+		io.WriteString(w, "</details>\n")
+	}
+	return ast.GoToNext, true
+}
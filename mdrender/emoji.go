@@ -0,0 +1,54 @@
+package mdrender
+
+import (
+	"bytes"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// emojiShortcodes replaces ":shortcode:" emoji found in text nodes of doc with
+// their Unicode representation. Shortcodes not found in emoji table are left
+// as is.
+func emojiShortcodes(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.CodeBlock, *ast.HTMLBlock:
+			return ast.SkipChildren
+		case *ast.Text:
+			if bytes.Count(n.Literal, []byte(":")) > 1 {
+				n.Literal = replaceEmoji(n.Literal)
+			}
+		}
+		return ast.GoToNext
+	})
+}
+
+// replaceEmoji returns text with known ":shortcode:" sequences replaced.
+func replaceEmoji(text []byte) []byte {
+	var out []byte
+	var last int // end of the text already copied to out
+	for i := 0; i < len(text); i++ {
+		if text[i] != ':' {
+			continue
+		}
+		j := bytes.IndexByte(text[i+1:], ':')
+		if j < 1 {
+			continue
+		}
+		j += i + 1
+		s, ok := emoji[string(text[i+1:j])]
+		if !ok {
+			continue
+		}
+		out = append(append(out, text[last:i]...), s...)
+		last = j + 1
+		i = j
+	}
+	if out == nil {
+		return text
+	}
+	return append(out, text[last:]...)
+}
@@ -0,0 +1,426 @@
+package mdrender
+
+// emoji maps GitHub emoji shortcodes (without colons) to their Unicode
+// representation. Only the commonly used part of the GitHub set is included.
+var emoji = map[string]string{
+	"+1":                           "👍",
+	"-1":                           "👎",
+	"100":                          "💯",
+	"1234":                         "🔢",
+	"airplane":                     "✈️",
+	"alarm_clock":                  "⏰",
+	"ambulance":                    "🚑",
+	"anchor":                       "⚓",
+	"angry":                        "😠",
+	"ant":                          "🐜",
+	"apple":                        "🍎",
+	"arrow_backward":               "◀️",
+	"arrow_down":                   "⬇️",
+	"arrow_down_small":             "🔽",
+	"arrow_forward":                "▶️",
+	"arrow_left":                   "⬅️",
+	"arrow_right":                  "➡️",
+	"arrow_right_hook":             "↪️",
+	"arrow_up":                     "⬆️",
+	"arrow_up_small":               "🔼",
+	"arrows_counterclockwise":      "🔄",
+	"art":                          "🎨",
+	"astonished":                   "😲",
+	"baby":                         "👶",
+	"balloon":                      "🎈",
+	"ballot_box_with_check":        "☑️",
+	"banana":                       "🍌",
+	"bangbang":                     "‼️",
+	"bar_chart":                    "📊",
+	"battery":                      "🔋",
+	"beer":                         "🍺",
+	"beers":                        "🍻",
+	"beetle":                       "🐞",
+	"bell":                         "🔔",
+	"bike":                         "🚲",
+	"bird":                         "🐦",
+	"birthday":                     "🎂",
+	"black_circle":                 "⚫",
+	"black_heart":                  "🖤",
+	"blue_heart":                   "💙",
+	"blush":                        "😊",
+	"bomb":                         "💣",
+	"book":                         "📖",
+	"bookmark":                     "🔖",
+	"books":                        "📚",
+	"boom":                         "💥",
+	"bow":                          "🙇",
+	"brain":                        "🧠",
+	"bricks":                       "🧱",
+	"broken_heart":                 "💔",
+	"bug":                          "🐛",
+	"bulb":                         "💡",
+	"bullettrain_side":             "🚄",
+	"bus":                          "🚌",
+	"cactus":                       "🌵",
+	"cake":                         "🍰",
+	"calendar":                     "📆",
+	"calendar_spiral":              "🗓️",
+	"camera":                       "📷",
+	"car":                          "🚗",
+	"card_file_box":                "🗃️",
+	"card_index":                   "🗂️",
+	"cat":                          "🐱",
+	"cd":                           "💿",
+	"champagne":                    "🍾",
+	"chart":                        "💹",
+	"chart_with_downwards_trend":   "📉",
+	"chart_with_upwards_trend":     "📈",
+	"check":                        "✔️",
+	"checkered_flag":               "🏁",
+	"cherries":                     "🍒",
+	"children_crossing":            "🚸",
+	"clap":                         "👏",
+	"clipboard":                    "📋",
+	"clock1":                       "🕐",
+	"closed_lock_with_key":         "🔐",
+	"cloud":                        "☁️",
+	"clown_face":                   "🤡",
+	"cocktail":                     "🍸",
+	"coffee":                       "☕",
+	"cold_sweat":                   "😰",
+	"computer":                     "💻",
+	"confused":                     "😕",
+	"construction":                 "🚧",
+	"construction_worker":          "👷",
+	"cookie":                       "🍪",
+	"cool":                         "🆒",
+	"copyright":                    "©️",
+	"credit_card":                  "💳",
+	"cry":                          "😢",
+	"crystal_ball":                 "🔮",
+	"dart":                         "🎯",
+	"dash":                         "💨",
+	"date":                         "📅",
+	"deciduous_tree":               "🌳",
+	"desktop_computer":             "🖥️",
+	"disappointed":                 "😞",
+	"dizzy":                        "💫",
+	"dna":                          "🧬",
+	"dog":                          "🐶",
+	"dollar":                       "💵",
+	"door":                         "🚪",
+	"doughnut":                     "🍩",
+	"dragon":                       "🐉",
+	"droplet":                      "💧",
+	"dvd":                          "📀",
+	"ear":                          "👂",
+	"earth_africa":                 "🌍",
+	"earth_americas":               "🌎",
+	"earth_asia":                   "🌏",
+	"egg":                          "🥚",
+	"eight":                        "8️⃣",
+	"electric_plug":                "🔌",
+	"email":                        "📧",
+	"envelope":                     "✉️",
+	"euro":                         "💶",
+	"evergreen_tree":               "🌲",
+	"exclamation":                  "❗",
+	"eyes":                         "👀",
+	"face_with_head_bandage":       "🤕",
+	"facepunch":                    "👊",
+	"fallen_leaf":                  "🍂",
+	"fast_forward":                 "⏩",
+	"file_cabinet":                 "🗄️",
+	"file_folder":                  "📁",
+	"fire":                         "🔥",
+	"fire_engine":                  "🚒",
+	"fireworks":                    "🎆",
+	"fish":                         "🐟",
+	"fist":                         "✊",
+	"five":                         "5️⃣",
+	"flags":                        "🎏",
+	"flashlight":                   "🔦",
+	"floppy_disk":                  "💾",
+	"flushed":                      "😳",
+	"four":                         "4️⃣",
+	"free":                         "🆓",
+	"fries":                        "🍟",
+	"frog":                         "🐸",
+	"frowning":                     "😦",
+	"gear":                         "⚙️",
+	"gem":                          "💎",
+	"ghost":                        "👻",
+	"gift":                         "🎁",
+	"globe_with_meridians":         "🌐",
+	"goal_net":                     "🥅",
+	"golf":                         "⛳",
+	"grapes":                       "🍇",
+	"green_heart":                  "💚",
+	"grey_exclamation":             "❕",
+	"grey_question":                "❔",
+	"grimacing":                    "😬",
+	"grin":                         "😁",
+	"grinning":                     "😀",
+	"hamburger":                    "🍔",
+	"hammer":                       "🔨",
+	"hammer_and_wrench":            "🛠️",
+	"hand":                         "✋",
+	"handshake":                    "🤝",
+	"hankey":                       "💩",
+	"hash":                         "#️⃣",
+	"hatching_chick":               "🐣",
+	"headphones":                   "🎧",
+	"hear_no_evil":                 "🙉",
+	"heart":                        "❤️",
+	"heart_eyes":                   "😍",
+	"hearts":                       "♥️",
+	"heavy_check_mark":             "✔️",
+	"heavy_division_sign":          "➗",
+	"heavy_dollar_sign":            "💲",
+	"heavy_exclamation_mark":       "❗",
+	"heavy_heart_exclamation":      "❣️",
+	"heavy_minus_sign":             "➖",
+	"heavy_multiplication_x":       "✖️",
+	"heavy_plus_sign":              "➕",
+	"hibiscus":                     "🌺",
+	"hospital":                     "🏥",
+	"hourglass":                    "⌛",
+	"hourglass_flowing_sand":       "⏳",
+	"house":                        "🏠",
+	"hugs":                         "🤗",
+	"hushed":                       "😯",
+	"id":                           "🆔",
+	"inbox_tray":                   "📥",
+	"information_source":           "ℹ️",
+	"innocent":                     "😇",
+	"interrobang":                  "⁉️",
+	"iphone":                       "📱",
+	"jack_o_lantern":               "🎃",
+	"joy":                          "😂",
+	"key":                          "🔑",
+	"keyboard":                     "⌨️",
+	"kiss":                         "💋",
+	"kissing":                      "😗",
+	"label":                        "🏷️",
+	"lady_beetle":                  "🐞",
+	"large_blue_circle":            "🔵",
+	"laughing":                     "😆",
+	"leaves":                       "🍃",
+	"ledger":                       "📒",
+	"leftwards_arrow_with_hook":    "↩️",
+	"lemon":                        "🍋",
+	"link":                         "🔗",
+	"lipstick":                     "💄",
+	"lock":                         "🔒",
+	"lock_with_ink_pen":            "🔏",
+	"loud_sound":                   "🔊",
+	"loudspeaker":                  "📢",
+	"love_letter":                  "💌",
+	"mag":                          "🔍",
+	"mag_right":                    "🔎",
+	"mailbox":                      "📫",
+	"maple_leaf":                   "🍁",
+	"mask":                         "😷",
+	"memo":                         "📝",
+	"microphone":                   "🎤",
+	"microscope":                   "🔬",
+	"money_with_wings":             "💸",
+	"moneybag":                     "💰",
+	"monkey":                       "🐒",
+	"moon":                         "🌔",
+	"mortar_board":                 "🎓",
+	"mountain":                     "⛰️",
+	"mouse":                        "🐭",
+	"movie_camera":                 "🎥",
+	"muscle":                       "💪",
+	"mushroom":                     "🍄",
+	"musical_note":                 "🎵",
+	"mute":                         "🔇",
+	"necktie":                      "👔",
+	"negative_squared_cross_mark":  "❎",
+	"neutral_face":                 "😐",
+	"new":                          "🆕",
+	"newspaper":                    "📰",
+	"nine":                         "9️⃣",
+	"no_bell":                      "🔕",
+	"no_entry":                     "⛔",
+	"no_entry_sign":                "🚫",
+	"no_good":                      "🙅",
+	"notebook":                     "📓",
+	"notes":                        "🎶",
+	"ok":                           "🆗",
+	"ok_hand":                      "👌",
+	"ok_woman":                     "🙆",
+	"one":                          "1️⃣",
+	"open_file_folder":             "📂",
+	"open_mouth":                   "😮",
+	"orange_heart":                 "🧡",
+	"outbox_tray":                  "📤",
+	"package":                      "📦",
+	"page_facing_up":               "📄",
+	"page_with_curl":               "📃",
+	"palm_tree":                    "🌴",
+	"paperclip":                    "📎",
+	"partly_sunny":                 "⛅",
+	"party_popper":                 "🎉",
+	"peach":                        "🍑",
+	"pencil":                       "📝",
+	"pencil2":                      "✏️",
+	"penguin":                      "🐧",
+	"pensive":                      "😔",
+	"persevere":                    "😣",
+	"phone":                        "☎️",
+	"pig":                          "🐷",
+	"pill":                         "💊",
+	"pin":                          "📍",
+	"pizza":                        "🍕",
+	"point_down":                   "👇",
+	"point_left":                   "👈",
+	"point_right":                  "👉",
+	"point_up":                     "☝️",
+	"point_up_2":                   "👆",
+	"police_car":                   "🚓",
+	"poop":                         "💩",
+	"popcorn":                      "🍿",
+	"pound":                        "💷",
+	"pouting_cat":                  "😾",
+	"pray":                         "🙏",
+	"printer":                      "🖨️",
+	"purple_heart":                 "💜",
+	"pushpin":                      "📌",
+	"question":                     "❓",
+	"rabbit":                       "🐰",
+	"racehorse":                    "🐎",
+	"radioactive":                  "☢️",
+	"rage":                         "😡",
+	"rainbow":                      "🌈",
+	"raised_hand":                  "✋",
+	"raised_hands":                 "🙌",
+	"recycle":                      "♻️",
+	"red_circle":                   "🔴",
+	"registered":                   "®️",
+	"relaxed":                      "☺️",
+	"relieved":                     "😌",
+	"repeat":                       "🔁",
+	"rewind":                       "⏪",
+	"rice":                         "🍚",
+	"robot":                        "🤖",
+	"rocket":                       "🚀",
+	"rofl":                         "🤣",
+	"rose":                         "🌹",
+	"rotating_light":               "🚨",
+	"round_pushpin":                "📍",
+	"ruler":                        "📏",
+	"runner":                       "🏃",
+	"running":                      "🏃",
+	"sad":                          "😞",
+	"satellite":                    "📡",
+	"satisfied":                    "😆",
+	"scissors":                     "✂️",
+	"scream":                       "😱",
+	"see_no_evil":                  "🙈",
+	"seedling":                     "🌱",
+	"seven":                        "7️⃣",
+	"shield":                       "🛡️",
+	"shipit":                       "🐿️",
+	"shrug":                        "🤷",
+	"six":                          "6️⃣",
+	"skull":                        "💀",
+	"sleeping":                     "😴",
+	"sleepy":                       "😪",
+	"slightly_frowning_face":       "🙁",
+	"slightly_smiling_face":        "🙂",
+	"smile":                        "😄",
+	"smiley":                       "😃",
+	"smiling_imp":                  "😈",
+	"smirk":                        "😏",
+	"snail":                        "🐌",
+	"snake":                        "🐍",
+	"snowflake":                    "❄️",
+	"snowman":                      "⛄",
+	"sob":                          "😭",
+	"soccer":                       "⚽",
+	"sos":                          "🆘",
+	"sound":                        "🔉",
+	"sparkles":                     "✨",
+	"sparkling_heart":              "💖",
+	"speak_no_evil":                "🙊",
+	"speech_balloon":               "💬",
+	"spider":                       "🕷️",
+	"spider_web":                   "🕸️",
+	"spiral_notepad":               "🗒️",
+	"star":                         "⭐",
+	"star2":                        "🌟",
+	"stars":                        "🌠",
+	"stop_sign":                    "🛑",
+	"stopwatch":                    "⏱️",
+	"straight_ruler":               "📏",
+	"strawberry":                   "🍓",
+	"stuck_out_tongue":             "😛",
+	"stuck_out_tongue_winking_eye": "😜",
+	"sun_with_face":                "🌞",
+	"sunflower":                    "🌻",
+	"sunglasses":                   "😎",
+	"sunny":                        "☀️",
+	"sweat":                        "😓",
+	"sweat_drops":                  "💦",
+	"sweat_smile":                  "😅",
+	"syringe":                      "💉",
+	"tada":                         "🎉",
+	"tea":                          "🍵",
+	"telephone":                    "☎️",
+	"telescope":                    "🔭",
+	"ten":                          "🔟",
+	"tent":                         "⛺",
+	"test_tube":                    "🧪",
+	"thinking":                     "🤔",
+	"thought_balloon":              "💭",
+	"three":                        "3️⃣",
+	"thumbsdown":                   "👎",
+	"thumbsup":                     "👍",
+	"ticket":                       "🎫",
+	"timer_clock":                  "⏲️",
+	"tired_face":                   "😫",
+	"tm":                           "™️",
+	"toilet":                       "🚽",
+	"tongue":                       "👅",
+	"tophat":                       "🎩",
+	"tractor":                      "🚜",
+	"traffic_light":                "🚥",
+	"train":                        "🚋",
+	"triangular_flag_on_post":      "🚩",
+	"trophy":                       "🏆",
+	"truck":                        "🚚",
+	"tulip":                        "🌷",
+	"turtle":                       "🐢",
+	"tv":                           "📺",
+	"two":                          "2️⃣",
+	"umbrella":                     "☔",
+	"unamused":                     "😒",
+	"unlock":                       "🔓",
+	"up":                           "🆙",
+	"v":                            "✌️",
+	"vertical_traffic_light":       "🚦",
+	"vhs":                          "📼",
+	"video_game":                   "🎮",
+	"violin":                       "🎻",
+	"warning":                      "⚠️",
+	"wastebasket":                  "🗑️",
+	"watch":                        "⌚",
+	"watermelon":                   "🍉",
+	"wave":                         "👋",
+	"wavy_dash":                    "〰️",
+	"whale":                        "🐳",
+	"wheelchair":                   "♿",
+	"white_check_mark":             "✅",
+	"white_circle":                 "⚪",
+	"white_flag":                   "🏳️",
+	"white_heart":                  "🤍",
+	"wine_glass":                   "🍷",
+	"wink":                         "😉",
+	"wrench":                       "🔧",
+	"x":                            "❌",
+	"yellow_heart":                 "💛",
+	"yen":                          "💴",
+	"yum":                          "😋",
+	"zap":                          "⚡",
+	"zero":                         "0️⃣",
+	"zipper_mouth_face":            "🤐",
+	"zzz":                          "💤",
+}
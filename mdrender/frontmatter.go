@@ -0,0 +1,81 @@
+package mdrender
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// FrontMatter splits document into front matter block delimited by "---"
+// lines at the very beginning of the document and the rest of the document.
+// If document has no front matter, meta is nil and body is the whole
+// document.
+func FrontMatter(b []byte) (meta, body []byte) {
+	const delim = "---"
+	rest := bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	line, rest, ok := cutLine(rest)
+	if !ok || string(bytes.TrimRight(line, " \t\r")) != delim {
+		return nil, b
+	}
+	start := len(b) - len(rest)
+	for len(rest) > 0 {
+		var line []byte
+		end := len(b) - len(rest)
+		line, rest, _ = cutLine(rest)
+		if l := string(bytes.TrimRight(line, " \t\r")); l == delim || l == "..." {
+			return b[start:end], rest
+		}
+	}
+	return nil, b
+}
+
+// cutLine returns first line of b without trailing newline and the rest of b
+// after that line. ok is false if b is empty.
+func cutLine(b []byte) (line, rest []byte, ok bool) {
+	if len(b) == 0 {
+		return nil, nil, false
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i], b[i+1:], true
+	}
+	return b, nil, true
+}
+
+// FrontMatterValue returns value of a top level "key: value" entry from front
+// matter. Values of YAML block sequences ("key:" followed by "- item" lines)
+// are returned joined with commas.
+func FrontMatterValue(meta []byte, key string) string {
+	var items []string
+	var inList bool
+	sc := bufio.NewScanner(bytes.NewReader(meta))
+	for sc.Scan() {
+		line := sc.Text()
+		if inList {
+			item := strings.TrimSpace(line)
+			if strings.HasPrefix(item, "- ") || item == "-" {
+				items = append(items, strings.TrimSpace(strings.TrimPrefix(item, "-")))
+				continue
+			}
+			if item == "" || strings.HasPrefix(item, "#") {
+				continue
+			}
+			break
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), key) || k != strings.TrimLeft(k, " \t") {
+			continue
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			return unquote(v)
+		}
+		inList = true
+	}
+	return strings.Join(items, ",")
+}
+
+func unquote(s string) string {
+	if len(s) > 1 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+package mdrender
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Glossary returns terms defined in markdown document src with a definition
+// list, mapped to plain text of their definitions:
+//
+//	SLA
+//	: Service level agreement
+//
+// If term has several definitions, they're joined with "; ".
+func Glossary(src []byte) map[string]string {
+	_, body := FrontMatter(src)
+	out := make(map[string]string)
+	var terms []string // terms of the current list item group
+	ast.WalkFunc(NewParser().Parse(body), func(node ast.Node, entering bool) ast.WalkStatus {
+		item, ok := node.(*ast.ListItem)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		text := strings.Join(strings.Fields(string(childLiterals(item))), " ")
+		switch {
+		case item.ListFlags&ast.ListTypeTerm != 0:
+			if len(terms) != 0 && out[terms[0]] != "" {
+				terms = nil // previous group is complete
+			}
+			if text != "" {
+				terms = append(terms, text)
+			}
+		case item.ListFlags&ast.ListTypeDefinition != 0:
+			for _, term := range terms {
+				if out[term] != "" {
+					out[term] += "; "
+				}
+				out[term] += text
+			}
+		}
+		return ast.SkipChildren
+	})
+	for term, def := range out {
+		if def == "" {
+			delete(out, term)
+		}
+	}
+	return out
+}
+
+// glossaryTerms wraps occurrences of glossary terms in document text into
+// <abbr> elements titled with term definitions. Text of headings, links and
+// code is left intact.
+func glossaryTerms(doc ast.Node, glossary map[string]string) {
+	terms := make([]string, 0, len(glossary))
+	for term := range glossary {
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	// prefer longer terms, so "SLA" does not shadow "SLA breach"
+	sort.Slice(terms, func(i, j int) bool {
+		if len(terms[i]) != len(terms[j]) {
+			return len(terms[i]) > len(terms[j])
+		}
+		return terms[i] < terms[j]
+	})
+	re := regexp.MustCompile(strings.Join(terms, "|"))
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Heading, *ast.Link, *ast.Image, *ast.CodeBlock:
+			return ast.SkipChildren
+		case *ast.Text:
+			if entering && re.Match(n.Literal) {
+				texts = append(texts, n)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, text := range texts {
+		var nodes []ast.Node
+		lit := text.Literal
+		for off := 0; off < len(lit); {
+			m := re.FindIndex(lit[off:])
+			if m == nil {
+				break
+			}
+			start, end := off+m[0], off+m[1]
+			if !wordBoundary(lit, start, end) {
+				off = start + 1
+				continue
+			}
+			term := string(lit[start:end])
+			nodes = append(nodes,
+				&ast.Text{Leaf: ast.Leaf{Literal: lit[:start]}},
+				&ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte(`<abbr title="` + html.EscapeString(glossary[term]) + `">`)}},
+				&ast.Text{Leaf: ast.Leaf{Literal: lit[start:end]}},
+				&ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte(`</abbr>`)}},
+			)
+			lit, off = lit[end:], 0
+		}
+		if nodes == nil {
+			continue
+		}
+		nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: lit}})
+		replaceNode(text, nodes)
+	}
+}
+
+// wordBoundary reports whether b[start:end] is a whole word of b
+func wordBoundary(b []byte, start, end int) bool {
+	if r, _ := utf8.DecodeLastRune(b[:start]); start != 0 && isWordRune(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRune(b[end:]); end != len(b) && isWordRune(r) {
+		return false
+	}
+	return true
+}
+
+func isWordRune(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
@@ -0,0 +1,123 @@
+package mdrender
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth limits nesting of included documents
+const maxIncludeDepth = 8
+
+// includeDirective matches a line with either `<!--#include file="name.md"-->`
+// or `{{include:name.md}}` directive.
+var includeDirective = regexp.MustCompile(`^ {0,3}(?:<!--\s*#include\s+file="([^"]+)"\s*-->|\{\{\s*include:\s*([^}]+?)\s*\}\})\s*$`)
+
+// ExpandIncludes replaces include directives in markdown document src read
+// from file in fsys with contents of included documents, and returns the
+// result along with paths of all included documents in fsys.
+//
+// Directive is either `<!--#include file="name.md"-->` or
+// `{{include:name.md}}` on its own line outside of fenced code blocks. Name
+// is relative to directory of the including document, or to the fsys root if
+// it starts with "/"; documents outside of fsys can't be included. Included
+// documents lose their front matter and may include other documents
+// themselves. Directives which can't be resolved, like ones forming a cycle,
+// are replaced with an error message.
+func ExpandIncludes(fsys fs.FS, file string, src []byte) ([]byte, []string) {
+	if !bytes.Contains(src, []byte("#include")) && !bytes.Contains(src, []byte("{{")) {
+		return src, nil
+	}
+	x := &includer{fsys: fsys, seen: make(map[string]bool)}
+	out := x.expand(src, []string{file})
+	return out, x.files
+}
+
+type includer struct {
+	fsys  fs.FS
+	files []string        // included documents, in order of their inclusion
+	seen  map[string]bool // files already added to files
+}
+
+// expand returns src with include directives expanded; stack holds the
+// document src was read from, preceded by documents including it.
+func (x *includer) expand(src []byte, stack []string) []byte {
+	var out bytes.Buffer
+	var fence string // opening fence of current code block, if any
+	for len(src) != 0 {
+		var line []byte
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			line, src = src[:i+1], src[i+1:]
+		} else {
+			line, src = src, nil
+		}
+		trimmed := strings.TrimLeft(string(line), " ")
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		default:
+			m := includeDirective.FindSubmatch(bytes.TrimRight(line, "\r\n"))
+			if m == nil {
+				break
+			}
+			name := string(m[1])
+			if name == "" {
+				name = string(m[2])
+			}
+			b, err := x.include(name, stack)
+			if err != nil {
+				fmt.Fprintf(&out, "\n**Cannot include `%s`:** %v.\n\n", strings.ReplaceAll(name, "`", ""), err)
+				continue
+			}
+			out.Write(b)
+			if len(b) != 0 && b[len(b)-1] != '\n' {
+				out.WriteByte('\n')
+			}
+			continue
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// include returns expanded contents of document name referenced from the
+// last document of stack.
+func (x *includer) include(name string, stack []string) ([]byte, error) {
+	file := path.Join(path.Dir(stack[len(stack)-1]), name)
+	if strings.HasPrefix(name, "/") {
+		file = path.Clean(strings.TrimPrefix(name, "/"))
+	}
+	if !fs.ValidPath(file) || file == "." {
+		return nil, errors.New("invalid path")
+	}
+	for _, s := range stack {
+		if s == file {
+			return nil, errors.New("include cycle")
+		}
+	}
+	if len(stack) > maxIncludeDepth {
+		return nil, errors.New("includes are nested too deep")
+	}
+	b, err := fs.ReadFile(x.fsys, file)
+	if err != nil {
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return nil, err
+	}
+	if !x.seen[file] {
+		x.seen[file] = true
+		x.files = append(x.files, file)
+	}
+	_, body := FrontMatter(b)
+	return x.expand(body, append(stack[:len(stack):len(stack)], file)), nil
+}
@@ -0,0 +1,396 @@
+// Package mdrender renders markdown documents to html the same way mdserver
+// does: it uses the same parser extensions and renderer options, sanitizes
+// output with the same bluemonday policy, and extracts document titles using
+// the same rules.
+package mdrender
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Extensions is a set of parser extensions used to render documents. Heading
+// ids are not generated by parser, but by HeadingIDs called from Parse.
+const Extensions = parser.CommonExtensions | parser.Footnotes ^ parser.MathJax
+
+// Options configure rendering.
+type Options struct {
+	// GithubWiki enables rendering of absolute links to github wikis like
+	// "https://github.com/user/project/wiki/Page" as relative ones like
+	// "Page.md".
+	GithubWiki bool
+
+	// WikiLinks, if set, enables rendering of "[[Page Name]]" and
+	// "[[Page Name|label]]" wikilinks, resolving them with this function.
+	WikiLinks WikiLinkResolver
+
+	// Emoji enables rendering of GitHub emoji shortcodes like ":tada:" as
+	// Unicode emoji.
+	Emoji bool
+
+	// ExternalLinks marks links to other sites, i.e. absolute http and
+	// https links, with "external" class.
+	ExternalLinks bool
+
+	// ExternalTab makes links to other sites open in a new tab, adding
+	// target="_blank" and rel="noopener" attributes to them.
+	ExternalTab bool
+
+	// Rewrite rules are applied to link and image destinations, so links
+	// to external wikis or repositories can be rendered as local ones.
+	Rewrite []RewriteRule
+
+	// Glossary maps terms to their definitions, see Glossary function.
+	// Occurrences of terms in document text are rendered as <abbr>
+	// elements with definitions as titles.
+	Glossary map[string]string
+
+	// HeadingIDPrefix, if set, is prepended to ids of document headings,
+	// like "user-content-" GitHub uses, so they don't collide with ids of
+	// elements on page around document. Links to headings within document
+	// are rewritten to match; ones that already have the prefix are kept.
+	// Footnote ids and links between footnotes and their references get
+	// the prefix too, as "fn:user-content-1".
+	HeadingIDPrefix string
+
+	// Transform, if set, is called with parsed document AST after all other
+	// transformations, and may modify it before it is rendered.
+	Transform func(doc ast.Node)
+}
+
+// Document is a rendered markdown document.
+type Document struct {
+	Meta  []byte   // front matter, nil if document has none
+	AST   ast.Node // parsed document without front matter
+	HTML  []byte   // rendered and sanitized html
+	Title string   // front matter "title" value or the first h1 header text
+}
+
+// Render parses markdown document src and renders it to sanitized html.
+func Render(src []byte, opts Options) *Document {
+	out := Parse(src, opts)
+	hooks := []html.RenderNodeFunc{renderTaskItem, renderDetails, renderAdmonition, renderCodeBlock, wrapTable, headingAnchor}
+	if opts.GithubWiki {
+		hooks = append(hooks, RewriteGithubWikiLinks)
+	}
+	ropts := html.RendererOptions{
+		Flags:                      html.CommonFlags | html.FootnoteReturnLinks,
+		FootnoteAnchorPrefix:       opts.HeadingIDPrefix,
+		FootnoteReturnLinkContents: "\u21a9\ufe0e", // leftwards arrow with hook, text presentation
+		RenderNodeHook:             chainHooks(hooks),
+	}
+	p := policy
+	if opts.ExternalTab {
+		p = tabPolicy
+	}
+	out.HTML = p.SanitizeBytes(markdown.Render(out.AST, html.NewRenderer(ropts)))
+	return out
+}
+
+// Parse parses markdown document src, applying the same transformations to
+// its AST as Render does. HTML field of returned Document is nil.
+func Parse(src []byte, opts Options) *Document {
+	meta, body := FrontMatter(src)
+	doc := NewParser().Parse(fenceAttrs(body))
+	HeadingIDs(doc)
+	if opts.HeadingIDPrefix != "" {
+		prefixHeadingIDs(doc, opts.HeadingIDPrefix)
+	}
+	taskLists(doc)
+	admonitions(doc)
+	if len(opts.Rewrite) != 0 {
+		rewriteLinks(doc, opts.Rewrite)
+	}
+	if opts.WikiLinks != nil {
+		wikiLinks(doc, opts.WikiLinks)
+	}
+	if opts.Emoji {
+		emojiShortcodes(doc)
+	}
+	if opts.ExternalLinks {
+		externalLinks(doc)
+	}
+	if len(opts.Glossary) != 0 {
+		glossaryTerms(doc, opts.Glossary)
+	}
+	if opts.Transform != nil {
+		opts.Transform(doc)
+	}
+	out := &Document{Meta: meta, AST: doc}
+	if out.Title = FrontMatterValue(meta, "title"); out.Title == "" {
+		out.Title = Title(doc)
+	}
+	return out
+}
+
+// chainHooks returns html.RenderNodeFunc calling hooks in order until one of
+// them reports that it has rendered the node.
+func chainHooks(hooks []html.RenderNodeFunc) html.RenderNodeFunc {
+	return func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		for _, fn := range hooks {
+			if status, ok := fn(w, node, entering); ok {
+				return status, true
+			}
+		}
+		return ast.GoToNext, false
+	}
+}
+
+// wrapTable is a html.RenderNodeFunc wrapping tables into div elements, so
+// wide tables can be scrolled horizontally without breaking page layout.
+func wrapTable(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	if _, ok := node.(*ast.Table); !ok {
+		return ast.GoToNext, false
+	}
+	if entering {
+		io.WriteString(w, "\n<div class=\"table-wrapper\">")
+		return ast.GoToNext, false // let renderer output opening tag
+	}
+	io.WriteString(w, "</table></div>\n")
+	return ast.GoToNext, true
+}
+
+// headingAnchor is a html.RenderNodeFunc adding "¶" link to heading id at the
+// end of each heading, so links to document sections are easy to copy.
+func headingAnchor(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	h, ok := node.(*ast.Heading)
+	if !ok || entering || h.HeadingID == "" || h.IsTitleblock {
+		return ast.GoToNext, false
+	}
+	fmt.Fprintf(w, `<a class="anchor" href="#%s">¶</a>`, url.PathEscape(h.HeadingID))
+	return ast.GoToNext, false // let renderer output closing tag
+}
+
+// NewParser returns a new parser configured with Extensions. Parser should
+// not be reused across documents. Parsed document headings only have explicit
+// ids; use Parse, or call HeadingIDs to get the same ids Render generates.
+func NewParser() *parser.Parser {
+	p := parser.NewWithExtensions(Extensions)
+	p.Opts.ParserHook = parseDetails
+	return p
+}
+
+// Policy returns a new copy of bluemonday policy used to sanitize rendered
+// html.
+func Policy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").OnElements("code")
+	for elem, re := range allowedClasses {
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^(` + re + `)$`)).OnElements(elem)
+	}
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("disabled", "checked").Matching(regexp.MustCompile(`^(|disabled|checked)$`)).OnElements("input")
+	// UGC policy only allows ids having ASCII letters, digits or ":-_."
+	// characters, this also allows ids like "日本語" made by Slug from
+	// non-Latin headings. Regexp must not match ids allowed by UGC policy,
+	// otherwise bluemonday would keep such attribute twice.
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[^\x00-\x7f]+$`)).Globally()
+	// UGC policy only allows titles made of letters, digits, spaces and some
+	// punctuation; glossary definitions used as abbr titles are often
+	// richer. Regexp only matches titles not allowed by UGC policy for the
+	// same reason as above.
+	p.AllowAttrs("title").Matching(regexp.MustCompile(`(?s)^.*[^\p{L}\p{N}\s\-_',\[\]!\./\\\(\)].*$`)).OnElements("abbr")
+	return p
+}
+
+var policy = Policy()
+
+// tabPolicy is policy with links to other sites opened in a new tab
+var tabPolicy = func() *bluemonday.Policy {
+	p := Policy()
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// allowedClasses maps html elements to regular expressions matching values of
+// class attributes that renderer may emit for them
+var allowedClasses = map[string]string{
+	"a":    `wikilink( broken)?( current)?|footnote-return|anchor|current|external|broken`,
+	"li":   `task`,
+	"sup":  `footnote-ref`,
+	"div":  `footnotes|table-wrapper|admonition (note|tip|important|warning|caution)`,
+	"p":    `admonition-title`,
+	"span": `line( hl)?|lineno`,
+}
+
+// DocumentTitle returns title of markdown document src: value of front matter
+// "title" key, or the text of the first h1 header. It returns an empty string
+// if document has neither.
+func DocumentTitle(src []byte) string {
+	meta, body := FrontMatter(src)
+	if title := FrontMatterValue(meta, "title"); title != "" {
+		return title
+	}
+	return Title(parser.New().Parse(body))
+}
+
+// Title returns text of the first h1 header of parsed document, or an empty
+// string if document has no such header.
+func Title(doc ast.Node) string {
+	var title string
+	walkFn := func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Heading:
+			if n.Level != 1 {
+				return ast.GoToNext
+			}
+			title = string(childLiterals(n))
+			return ast.Terminate
+		case *ast.Code, *ast.CodeBlock, *ast.BlockQuote:
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	}
+	_ = ast.Walk(doc, ast.NodeVisitorFunc(walkFn))
+	return title
+}
+
+// Summary returns plain text of the first top-level paragraph of parsed
+// document with runs of white space collapsed, or an empty string if document
+// has no paragraphs.
+func Summary(doc ast.Node) string {
+	for _, n := range doc.GetChildren() {
+		if p, ok := n.(*ast.Paragraph); ok {
+			return strings.Join(strings.Fields(string(childLiterals(p))), " ")
+		}
+	}
+	return ""
+}
+
+// Text returns concatenated text of node and all its descendants, i.e. plain
+// text of a header or a link label.
+func Text(node ast.Node) string { return string(childLiterals(node)) }
+
+func childLiterals(node ast.Node) []byte {
+	if l := node.AsLeaf(); l != nil {
+		return l.Literal
+	}
+	var out [][]byte
+	for _, n := range node.GetChildren() {
+		if lit := childLiterals(n); lit != nil {
+			out = append(out, lit)
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	return bytes.Join(out, nil)
+}
+
+// Words returns the number of words in parsed document, counting words of
+// text and code.
+func Words(doc ast.Node) int {
+	var n int
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if l := node.AsLeaf(); l != nil && entering {
+			n += len(bytes.Fields(l.Literal))
+		}
+		return ast.GoToNext
+	})
+	return n
+}
+
+// Heading describes a single document header.
+type Heading struct {
+	Level int    `json:"level"`
+	ID    string `json:"id,omitempty"`
+	Text  string `json:"text"`
+}
+
+// Headings returns all headings of parsed document in order of their
+// appearance.
+func Headings(doc ast.Node) []Heading {
+	out := []Heading{}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Heading:
+			out = append(out, Heading{Level: n.Level, ID: n.HeadingID, Text: string(childLiterals(n))})
+			return ast.SkipChildren
+		case *ast.CodeBlock, *ast.BlockQuote:
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	})
+	return out
+}
+
+// Links returns unique destinations of all links and images of parsed
+// document in order of their appearance.
+func Links(doc ast.Node) []string {
+	out := []string{}
+	seen := make(map[string]struct{})
+	add := func(dst []byte) {
+		if len(dst) == 0 {
+			return
+		}
+		if _, ok := seen[string(dst)]; ok {
+			return
+		}
+		seen[string(dst)] = struct{}{}
+		out = append(out, string(dst))
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			if n.NoteID == 0 {
+				add(n.Destination)
+			}
+		case *ast.Image:
+			add(n.Destination)
+		}
+		return ast.GoToNext
+	})
+	return out
+}
+
+// RewriteGithubWikiLinks is a html.RenderNodeFunc which renders links
+// with github wiki destinations as local ones.
+//
+// Link with "https://github.com/user/project/wiki/Page" destination would be
+// rendered as a link to "Page.md"
+func RewriteGithubWikiLinks(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	link, ok := node.(*ast.Link)
+	if !ok || !entering {
+		return ast.GoToNext, false
+	}
+	if dst, ok := GithubWikiLink(string(link.Destination)); ok {
+		fmt.Fprintf(w, "<a href=\"%s\">", dst)
+		return ast.GoToNext, true
+	}
+	return ast.GoToNext, false
+}
+
+// GithubWikiLink reports whether dst is a link to github wiki page and returns
+// its local equivalent: for "https://github.com/user/project/wiki/Page#top"
+// it returns "Page.md#top".
+func GithubWikiLink(dst string) (string, bool) {
+	u, err := url.Parse(dst)
+	if err != nil || u.Host != "github.com" || !strings.HasSuffix(path.Dir(u.Path), "/wiki") {
+		return "", false
+	}
+	local := url.QueryEscape(path.Base(u.Path) + ".md")
+	if u.Fragment != "" {
+		local += "#" + url.QueryEscape(u.Fragment)
+	}
+	return local, true
+}
@@ -0,0 +1,327 @@
+package mdrender
+
+import (
+	"bytes"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRender(t *testing.T) {
+	src := []byte("---\ntitle: Front Title\n---\n# Header\n\n" +
+		"[page](https://github.com/user/project/wiki/Some-Page#section)\n\n" +
+		"<script>alert(1)</script>\n")
+	doc := Render(src, Options{GithubWiki: true})
+	if doc.Title != "Front Title" {
+		t.Errorf("got title %q, want %q", doc.Title, "Front Title")
+	}
+	if want := []byte(`<a href="Some-Page.md#section"`); !bytes.Contains(doc.HTML, want) {
+		t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+	}
+	if want := []byte(`<h1 id="header">Header<a class="anchor" href="#header" rel="nofollow">¶</a></h1>`); !bytes.Contains(doc.HTML, want) {
+		t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+	}
+	if bytes.Contains(doc.HTML, []byte("<script>")) {
+		t.Errorf("rendered html is not sanitized:\n%s", doc.HTML)
+	}
+	if got := DocumentTitle([]byte("text\n\n# Header\n")); got != "Header" {
+		t.Errorf("got title %q, want %q", got, "Header")
+	}
+}
+
+func TestWikiLinks(t *testing.T) {
+	resolve := func(target string) (string, bool) { return "/" + target + ".md", target == "Known" }
+	doc := Render([]byte("[[Known]], [[Unknown|label]], `[[Code]]`\n"), Options{WikiLinks: resolve})
+	for _, want := range []string{
+		`<a class="wikilink" href="/Known.md"`,
+		`<a class="wikilink broken" href="/Unknown.md" rel="nofollow">label</a>`,
+		`<code>[[Code]]</code>`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestTaskLists(t *testing.T) {
+	doc := Render([]byte("- [ ] todo\n- [x] done\n- [y] text\n"), Options{})
+	for _, want := range []string{
+		`<li class="task"><input type="checkbox" disabled=""> todo</li>`,
+		`<li class="task"><input type="checkbox" disabled="" checked=""> done</li>`,
+		`<li>[y] text</li>`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestFootnotes(t *testing.T) {
+	doc := Render([]byte("Text[^1].\n\n[^1]: Note.\n"), Options{})
+	for _, want := range []string{
+		`<sup class="footnote-ref" id="fnref:1"><a href="#fn:1"`,
+		`<div class="footnotes">`,
+		`<li id="fn:1">Note. <a class="footnote-return" href="#fnref:1"`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	doc := Render([]byte("| a | b |\n|:--|--:|\n| 1 | 2 |\n"), Options{})
+	for _, want := range []string{
+		`<div class="table-wrapper"><table>`,
+		`<th align="left">a</th>`,
+		`<td align="right">2</td>`,
+		`</table></div>`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestEmoji(t *testing.T) {
+	doc := Render([]byte("Done :tada: at 10:30:00, :nosuchemoji: `:tada:`\n"), Options{Emoji: true})
+	want := "<p>Done \U0001f389 at 10:30:00, :nosuchemoji: <code>:tada:</code></p>\n"
+	if got := string(doc.HTML); got != want {
+		t.Fatalf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestWords(t *testing.T) {
+	doc := Parse([]byte("# Title\n\nSome *emphasized* text and `code`.\n\n```\nx := 1\n```\n"), Options{})
+	if got, want := Words(doc.AST), 10; got != want {
+		t.Fatalf("got %d words, want %d", got, want)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	doc := Parse([]byte("# Title\n\n> quote\n\nFirst  line\nsecond *emphasized* `code`.\n\nNext paragraph.\n"), Options{})
+	if got, want := Summary(doc.AST), "First line second emphasized code."; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestHeadingIDs(t *testing.T) {
+	for text, want := range map[string]string{
+		"Hello, World!":         "hello-world",
+		"snake_case and C++":    "snake_case-and-c",
+		"a - b":                 "a---b",
+		"Привет, мир":           "привет-мир",
+		"Cafe\u0301 au lait":    "café-au-lait",
+		"日本語のテキスト":              "日本語のテキスト",
+		"Use `fmt.Println` now": "use-fmtprintln-now",
+		"!!!":                   "",
+	} {
+		if got := Slug(text); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", text, got, want)
+		}
+	}
+	src := []byte("# Заголовок\n\n## Раздел\n\n## Раздел\n\n## Custom {#own}\n\n## [Link](https://example.com/)\n")
+	doc := Render(src, Options{})
+	for _, want := range []string{
+		`<h1 id="заголовок">`,
+		`<h2 id="раздел">`,
+		`<h2 id="раздел-1">`,
+		`<h2 id="own">`,
+		`<h2 id="link">`,
+		`href="#%D1%80%D0%B0%D0%B7%D0%B4%D0%B5%D0%BB-1"`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+	if n := bytes.Count(doc.HTML, []byte(` id="`)); n != 5 {
+		t.Errorf("got %d id attributes, want 5:\n%s", n, doc.HTML)
+	}
+}
+
+func TestHeadingIDPrefix(t *testing.T) {
+	src := []byte("# Title\n\nSee [usage](#usage), [copied](#user-content-usage), [missing](#nowhere) and note[^1].\n\n## Usage\n\n[^1]: Note.\n")
+	doc := Render(src, Options{HeadingIDPrefix: "user-content-"})
+	for _, want := range []string{
+		`<h1 id="user-content-title">`,
+		`<h2 id="user-content-usage">`,
+		`<a href="#user-content-usage" rel="nofollow">usage</a>`,
+		`<a href="#user-content-usage" rel="nofollow">copied</a>`,
+		`<a href="#nowhere" rel="nofollow">missing</a>`,
+		`<a class="anchor" href="#user-content-usage" rel="nofollow">`,
+		`<sup class="footnote-ref" id="fnref:user-content-1"><a href="#fn:user-content-1" rel="nofollow">`,
+		`<li id="fn:user-content-1">`,
+		`<a class="footnote-return" href="#fnref:user-content-1" rel="nofollow">`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	var rules []RewriteRule
+	for _, s := range []string{
+		`^https://gitlab\.com/group/project/-/wikis/([^#]+) => $1.md`,
+		`^https://example\.com/repo/blob/main/ => ../`,
+	} {
+		r, err := ParseRewriteRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+	if _, err := ParseRewriteRule("no arrow"); err == nil {
+		t.Error("rule without replacement parsed without error")
+	}
+	src := []byte("[a](https://gitlab.com/group/project/-/wikis/Some-Page#top) " +
+		"![b](https://example.com/repo/blob/main/img/b.png) [c](https://example.org/)\n")
+	doc := Render(src, Options{Rewrite: rules})
+	for _, want := range []string{
+		`<a href="Some-Page.md#top"`,
+		`<img src="../img/b.png"`,
+		`<a href="https://example.org/"`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestExpandIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/page.md": {Data: []byte("# Page\n\n<!--#include file=\"../snippets/warning.md\"-->\n" +
+			"{{include: /snippets/missing.md}}\n{{include:../../etc/passwd}}\n" +
+			"```\n{{include:/snippets/warning.md}}\n```\n")},
+		"snippets/warning.md": {Data: []byte("---\ntitle: Warning\n---\n**Warning**\n{{include:loop.md}}\n")},
+		"snippets/loop.md":    {Data: []byte("Loop\n{{include:warning.md}}")},
+	}
+	src, err := fs.ReadFile(fsys, "docs/page.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, files := ExpandIncludes(fsys, "docs/page.md", src)
+	if want := []string{"snippets/warning.md", "snippets/loop.md"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got included files %q, want %q", files, want)
+	}
+	for _, want := range []string{
+		"# Page\n\n**Warning**\nLoop\n\n**Cannot include `warning.md`:** include cycle.\n",
+		"**Cannot include `/snippets/missing.md`:** file does not exist.",
+		"**Cannot include `../../etc/passwd`:** invalid path.",
+		"```\n{{include:/snippets/warning.md}}\n```\n",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("expanded document has no %q:\n%s", want, out)
+		}
+	}
+	if bytes.Contains(out, []byte("title: Warning")) {
+		t.Errorf("front matter of included document is kept:\n%s", out)
+	}
+}
+
+func TestAdmonitions(t *testing.T) {
+	src := []byte("> [!NOTE]\n> Some *text*\n\n" +
+		"> [!warning] Mind the \"gap\"\n> body\n")
+	doc := Render(src, Options{})
+	for _, want := range []string{
+		"<div class=\"admonition note\"><p class=\"admonition-title\">Note</p>\n<p>Some <em>text</em></p>\n</div>",
+		"<div class=\"admonition warning\"><p class=\"admonition-title\">Mind the &#34;gap&#34;</p>\n\n<p>body</p>\n</div>",
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %q:\n%s", want, doc.HTML)
+		}
+	}
+	doc = Render([]byte("> quote\n\n> [!UNKNOWN]\n> text\n"), Options{})
+	for _, want := range []string{
+		"<blockquote>\n<p>quote</p>\n\n<p>[!UNKNOWN]\ntext</p>\n</blockquote>",
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %q:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestDetails(t *testing.T) {
+	src := []byte("<details open>\n<summary>Click <b>me</b></summary>\n\nHidden *text*\n\n" +
+		"<details><summary>Inner</summary>\n\n```\n</details>\n```\n\n</details>\n\nOuter [link]\n</details>\n\n" +
+		"[link]: https://example.com/\n")
+	doc := Render(src, Options{})
+	want := "<details open=\"\">\n<summary>Click <b>me</b></summary>\n<p>Hidden <em>text</em></p>\n\n" +
+		"<details><summary>Inner</summary>\n\n<pre><code>&lt;/details&gt;\n</code></pre>\n</details>\n\n" +
+		"<p>Outer <a href=\"https://example.com/\" rel=\"nofollow\">link</a></p>\n</details>\n"
+	if !bytes.Contains(doc.HTML, []byte(want)) {
+		t.Errorf("rendered html has no %q:\n%s", want, doc.HTML)
+	}
+}
+
+func TestGlossary(t *testing.T) {
+	glossary := Glossary([]byte("# Glossary\n\nSLA\n: Service level agreement\n\n" +
+		"SLA breach\n: Failure to meet the *SLA*\n\nK8s\n: Kubernetes\n: Container \"orchestrator\"\n"))
+	want := map[string]string{
+		"SLA":        "Service level agreement",
+		"SLA breach": "Failure to meet the SLA",
+		"K8s":        "Kubernetes; Container \"orchestrator\"",
+	}
+	if !reflect.DeepEqual(glossary, want) {
+		t.Fatalf("got glossary %q, want %q", glossary, want)
+	}
+	src := []byte("## SLA\n\nOur SLA, an SLA breach, SLAs and [SLA](sla.md) on K8s: `SLA`.\n")
+	doc := Render(src, Options{Glossary: glossary})
+	for _, want := range []string{
+		`<h2 id="sla">SLA<a`,
+		`Our <abbr title="Service level agreement">SLA</abbr>, an <abbr title="Failure to meet the SLA">SLA breach</abbr>, SLAs and `,
+		`<a href="sla.md" rel="nofollow">SLA</a> on <abbr title="Kubernetes; Container &#34;orchestrator&#34;">K8s</abbr>: <code>SLA</code>.`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %q:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestExternalLinks(t *testing.T) {
+	src := []byte("[ext](https://example.com/) [local](page.md) [root](/page.md) [[Wiki]]\n")
+	resolve := func(string) (string, bool) { return "/Wiki.md", true }
+	doc := Render(src, Options{ExternalLinks: true, ExternalTab: true, WikiLinks: resolve})
+	for _, want := range []string{
+		`<a class="external" href="https://example.com/" rel="nofollow noopener" target="_blank">ext</a>`,
+		`<a href="page.md" rel="nofollow">local</a>`,
+		`<a href="/page.md" rel="nofollow">root</a>`,
+		`<a class="wikilink" href="/Wiki.md" rel="nofollow">`,
+	} {
+		if !bytes.Contains(doc.HTML, []byte(want)) {
+			t.Errorf("rendered html has no %s:\n%s", want, doc.HTML)
+		}
+	}
+}
+
+func TestCodeBlockAttrs(t *testing.T) {
+	src := "Text\n```go {linenos=true, hl_lines=[2,\"4-5\"], linenostart=1}\na\n<b>\nc\nd\ne\n```\n"
+	got := string(Render([]byte(src), Options{}).HTML)
+	want := `<pre><code class="language-go"><span class="line"><span class="lineno">1</span>a
+</span><span class="line hl"><span class="lineno">2</span>&lt;b&gt;
+</span><span class="line"><span class="lineno">3</span>c
+</span><span class="line hl"><span class="lineno">4</span>d
+</span><span class="line hl"><span class="lineno">5</span>e
+</span></code></pre>`
+	if !strings.Contains(got, want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	for info, want := range map[string]codeAttrs{
+		"sh hl_lines=3 linenos=false":       {lang: "sh", start: 1, highlight: map[int]bool{3: true}},
+		"linenos = table, linenostart = 10": {linenos: true, start: 10},
+	} {
+		got, ok := parseCodeInfo(info)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %+v, want %+v", info, got, want)
+		}
+	}
+	if _, ok := parseCodeInfo("go"); ok {
+		t.Error("info without attributes parsed")
+	}
+	// fence lines inside other code blocks are kept as is
+	if src, want := "~~~\n```go {linenos=true}\n~~~\n", "```go {linenos=true}\n"; !bytes.Contains(fenceAttrs([]byte(src)), []byte(want)) {
+		t.Errorf("fenceAttrs changed nested fence line: %q", fenceAttrs([]byte(src)))
+	}
+}
@@ -0,0 +1,84 @@
+package mdrender
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// RewriteRule rewrites link destinations matching Pattern to Replacement,
+// which may refer to Pattern submatches as $1 or ${name}, see
+// regexp.Regexp.Expand.
+type RewriteRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// ParseRewriteRule parses rule in "regexp => replacement" form, like
+// `^https://gitlab\.com/group/project/-/wikis/(.+)$ => $1.md`.
+func ParseRewriteRule(s string) (RewriteRule, error) {
+	expr, repl, ok := strings.Cut(s, "=>")
+	if !ok {
+		return RewriteRule{}, fmt.Errorf("invalid rewrite rule %q, want \"regexp => replacement\"", s)
+	}
+	re, err := regexp.Compile(strings.TrimSpace(expr))
+	if err != nil {
+		return RewriteRule{}, err
+	}
+	return RewriteRule{Pattern: re, Replacement: strings.TrimSpace(repl)}, nil
+}
+
+func (r RewriteRule) String() string { return r.Pattern.String() + " => " + r.Replacement }
+
+// RewriteLink returns dst rewritten by the first of rules matching it, and
+// reports whether any rule matched.
+func RewriteLink(rules []RewriteRule, dst string) (string, bool) {
+	for _, r := range rules {
+		if m := r.Pattern.FindStringSubmatchIndex(dst); m != nil {
+			out := dst[:m[0]] + string(r.Pattern.ExpandString(nil, r.Replacement, dst, m)) + dst[m[1]:]
+			return out, true
+		}
+	}
+	return dst, false
+}
+
+// rewriteLinks rewrites destinations of document links and images with rules
+func rewriteLinks(doc ast.Node, rules []RewriteRule) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			if n.NoteID == 0 {
+				if dst, ok := RewriteLink(rules, string(n.Destination)); ok {
+					n.Destination = []byte(dst)
+				}
+			}
+		case *ast.Image:
+			if dst, ok := RewriteLink(rules, string(n.Destination)); ok {
+				n.Destination = []byte(dst)
+			}
+		}
+		return ast.GoToNext
+	})
+}
+
+// externalLinks adds "external" class to links with absolute http and https
+// destinations.
+func externalLinks(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering || link.NoteID != 0 || len(link.AdditionalAttributes) != 0 {
+			return ast.GoToNext
+		}
+		if u, err := url.Parse(string(link.Destination)); err == nil && u.Host != "" &&
+			(u.Scheme == "http" || u.Scheme == "https") {
+			link.AdditionalAttributes = []string{`class="external"`}
+		}
+		return ast.GoToNext
+	})
+}
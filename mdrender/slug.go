@@ -0,0 +1,98 @@
+package mdrender
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slug returns heading id for heading text the same way GitHub does: text is
+// lowercased, spaces are replaced with hyphens, and all punctuation and
+// symbols except hyphens and underscores are removed. Letters and digits of
+// any script are kept as is, so "Привет, мир!" becomes "привет-мир". Text is
+// normalized to NFC form first, so headings written with combining characters
+// get the same ids as their precomposed equivalents.
+func Slug(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFC.String(strings.TrimSpace(text)) {
+		switch {
+		case r == ' ' || r == '-':
+			b.WriteByte('-')
+		case unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) || unicode.Is(unicode.Pc, r):
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// HeadingIDs sets ids of document headings that don't have explicit "{#id}"
+// ones, using Slug of their text. Duplicate ids get "-1", "-2", etc. suffixes,
+// like GitHub does. Headings with text producing empty slug get no id.
+func HeadingIDs(doc ast.Node) {
+	taken := make(map[string]bool)
+	var auto []*ast.Heading
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		h, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		switch {
+		case h.HeadingID != "":
+			taken[h.HeadingID] = true
+		case !h.IsTitleblock:
+			auto = append(auto, h)
+		}
+		return ast.SkipChildren
+	})
+	for _, h := range auto {
+		slug := Slug(Text(h))
+		if slug == "" {
+			continue
+		}
+		id := slug
+		for n := 1; taken[id]; n++ {
+			id = slug + "-" + strconv.Itoa(n)
+		}
+		taken[id] = true
+		h.HeadingID = id
+	}
+}
+
+// prefixHeadingIDs adds prefix to ids of document headings, and rewrites
+// links to them within the document to match. Links already having prefix,
+// like ones copied from GitHub, are kept as is.
+func prefixHeadingIDs(doc ast.Node, prefix string) {
+	ids := make(map[string]bool)
+	var links []*ast.Link
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Heading:
+			if n.HeadingID != "" && !n.IsTitleblock {
+				ids[n.HeadingID] = true
+				n.HeadingID = prefix + n.HeadingID
+			}
+			return ast.SkipChildren
+		case *ast.Link:
+			if n.NoteID == 0 && len(n.Destination) > 1 && n.Destination[0] == '#' {
+				links = append(links, n)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, link := range links {
+		frag := string(link.Destination[1:])
+		if s, err := url.PathUnescape(frag); err == nil {
+			frag = s
+		}
+		if ids[frag] {
+			link.Destination = []byte("#" + url.PathEscape(prefix+frag))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package mdrender
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// taskLists finds list items starting with "[ ] " or "[x] " markers, replaces
+// these markers with disabled checkboxes and marks such items with "task"
+// class.
+func taskLists(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		item, ok := node.(*ast.ListItem)
+		if !ok || !entering || item.ListFlags&(ast.ListTypeTerm|ast.ListTypeDefinition) != 0 {
+			return ast.GoToNext
+		}
+		para, ok := ast.GetFirstChild(item).(*ast.Paragraph)
+		if !ok {
+			return ast.GoToNext
+		}
+		text, ok := ast.GetFirstChild(para).(*ast.Text)
+		if !ok || len(text.Literal) < 4 || text.Literal[0] != '[' || text.Literal[2] != ']' || text.Literal[3] != ' ' {
+			return ast.GoToNext
+		}
+		var box string
+		switch text.Literal[1] {
+		case ' ':
+			box = `<input type="checkbox" disabled>`
+		case 'x', 'X':
+			box = `<input type="checkbox" disabled checked>`
+		default:
+			return ast.GoToNext
+		}
+		text.Literal = text.Literal[3:]
+		span := &ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte(box)}}
+		span.SetParent(para)
+		para.SetChildren(append([]ast.Node{span}, para.GetChildren()...))
+		item.Attribute = &ast.Attribute{Classes: [][]byte{[]byte(taskClass)}}
+		return ast.GoToNext
+	})
+}
+
+const taskClass = "task"
+
+// renderTaskItem is a html.RenderNodeFunc rendering opening tag of list items
+// marked by taskLists with a "task" class.
+func renderTaskItem(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	item, ok := node.(*ast.ListItem)
+	if !ok || !entering || item.Attribute == nil || len(item.Attribute.Classes) == 0 ||
+		!bytes.Equal(item.Attribute.Classes[0], []byte(taskClass)) {
+		return ast.GoToNext, false
+	}
+	io.WriteString(w, "\n<li class=\""+taskClass+"\">")
+	return ast.GoToNext, true
+}
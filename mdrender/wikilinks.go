@@ -0,0 +1,103 @@
+package mdrender
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// WikiLinkResolver resolves wikilink target to link destination. Target is
+// the page name from "[[Page Name]]" or "[[Page Name|label]]" link, possibly
+// followed by "#fragment". If ok is false, link is rendered as broken one,
+// with "wikilink broken" class.
+type WikiLinkResolver func(target string) (dst string, ok bool)
+
+// wikiLinks replaces "[[Page]]" and "[[Page|label]]" syntax found in text
+// nodes of doc with links resolved by fn.
+func wikiLinks(doc ast.Node, fn WikiLinkResolver) {
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Link, *ast.Image, *ast.CodeBlock, *ast.HTMLBlock:
+			return ast.SkipChildren
+		case *ast.Text:
+			if bytes.Contains(n.Literal, []byte("[[")) {
+				texts = append(texts, n)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, text := range texts {
+		nodes := splitWikiLinks(text.Literal, fn)
+		if nodes == nil {
+			continue
+		}
+		parent := text.Parent
+		var children []ast.Node
+		for _, n := range parent.GetChildren() {
+			if n != text {
+				children = append(children, n)
+				continue
+			}
+			for _, n := range nodes {
+				n.SetParent(parent)
+				children = append(children, n)
+			}
+		}
+		parent.SetChildren(children)
+	}
+}
+
+// splitWikiLinks splits text into text and link nodes. It returns nil if text
+// has no wikilinks.
+func splitWikiLinks(text []byte, fn WikiLinkResolver) []ast.Node {
+	var out []ast.Node
+	var pos int // offset in text to search for the next link from
+	for {
+		i := bytes.Index(text[pos:], []byte("[["))
+		if i < 0 {
+			break
+		}
+		i += pos
+		j := bytes.Index(text[i+2:], []byte("]]"))
+		if j < 0 {
+			break
+		}
+		j += i + 2
+		inner := string(text[i+2 : j])
+		if strings.TrimSpace(inner) == "" || strings.ContainsAny(inner, "[]\n") {
+			pos = i + 2
+			continue
+		}
+		target, label, _ := strings.Cut(inner, "|")
+		target = strings.TrimSpace(target)
+		if label = strings.TrimSpace(label); label == "" {
+			label = target
+		}
+		dst, ok := fn(target)
+		link := &ast.Link{Destination: []byte(dst)}
+		switch {
+		case ok:
+			link.AdditionalAttributes = []string{`class="wikilink"`}
+		default:
+			link.AdditionalAttributes = []string{`class="wikilink broken"`}
+		}
+		ast.AppendChild(link, &ast.Text{Leaf: ast.Leaf{Literal: []byte(label)}})
+		if i > 0 {
+			out = append(out, &ast.Text{Leaf: ast.Leaf{Literal: text[:i]}})
+		}
+		out = append(out, link)
+		text, pos = text[j+2:], 0
+	}
+	if out == nil {
+		return nil
+	}
+	if len(text) > 0 {
+		out = append(out, &ast.Text{Leaf: ast.Leaf{Literal: text}})
+	}
+	return out
+}
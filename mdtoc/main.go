@@ -0,0 +1,159 @@
+// Command mdtoc inserts or updates table of contents in markdown files.
+//
+// Table of contents is placed between "<!-- toc -->" and "<!-- /toc -->"
+// lines. If file only has the opening marker, table of contents is inserted
+// right after it, followed by the closing marker. Files without markers are
+// left intact.
+//
+// Table of contents links use the same heading ids as mdserver generates when
+// rendering documents.
+//
+// When run with -check flag, files are not modified; instead the program
+// reports files with missing or outdated table of contents and exits with
+// non-zero code if there are any, which is handy for CI.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/artyom/autoflags"
+	"github.com/artyom/mdserver/mdrender"
+)
+
+func main() {
+	args := runArgs{MinLevel: 1, MaxLevel: 6}
+	autoflags.Parse(&args)
+	if err := run(args, flag.Args()); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+}
+
+type runArgs struct {
+	Check    bool `flag:"check,only check whether table of contents is up to date, do not modify files"`
+	MinLevel int  `flag:"min,minimal level of headers to include"`
+	MaxLevel int  `flag:"max,maximum level of headers to include"`
+}
+
+func run(args runArgs, files []string) error {
+	if len(files) == 0 {
+		return errors.New("no files to process, provide them as arguments")
+	}
+	if args.MinLevel < 1 || args.MaxLevel > 6 || args.MinLevel > args.MaxLevel {
+		return errors.New("header levels should satisfy 1 <= min <= max <= 6")
+	}
+	var outdated []string
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		out, ok := updateTOC(b, args.MinLevel, args.MaxLevel)
+		if !ok || bytes.Equal(b, out) {
+			continue
+		}
+		if args.Check {
+			outdated = append(outdated, name)
+			continue
+		}
+		if err := writeFile(name, out); err != nil {
+			return err
+		}
+	}
+	if len(outdated) != 0 {
+		return fmt.Errorf("table of contents is not up to date in these files:\n%s",
+			strings.Join(outdated, "\n"))
+	}
+	return nil
+}
+
+const (
+	startMarker = "<!-- toc -->"
+	endMarker   = "<!-- /toc -->"
+)
+
+// updateTOC returns document with table of contents updated. It returns false
+// if document has no table of contents markers.
+func updateTOC(b []byte, minLevel, maxLevel int) ([]byte, bool) {
+	start, end := -1, -1 // offsets of the end of start marker line and the start of end marker line
+	for off := 0; off < len(b); {
+		line := b[off:]
+		next := len(b)
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, next = line[:i], off+i+1
+		}
+		switch strings.TrimSpace(string(line)) {
+		case startMarker:
+			if start < 0 {
+				start = next
+			}
+		case endMarker:
+			if start >= 0 && end < 0 {
+				end = off
+			}
+		}
+		off = next
+	}
+	if start < 0 {
+		return nil, false
+	}
+	toc := renderTOC(b, minLevel, maxLevel)
+	out := make([]byte, 0, len(b)+len(toc)+len(endMarker)+2)
+	out = append(out, b[:start]...)
+	if start > 0 && b[start-1] != '\n' {
+		out = append(out, '\n')
+	}
+	out = append(out, toc...)
+	switch {
+	case end < 0:
+		out = append(out, endMarker+"\n"...)
+		out = append(out, b[start:]...)
+	default:
+		out = append(out, b[end:]...)
+	}
+	return out, true
+}
+
+// renderTOC returns markdown list of links to document headers
+func renderTOC(b []byte, minLevel, maxLevel int) []byte {
+	var headings []mdrender.Heading
+	for _, h := range mdrender.Headings(mdrender.Parse(b, mdrender.Options{}).AST) {
+		if h.Level >= minLevel && h.Level <= maxLevel && h.ID != "" {
+			headings = append(headings, h)
+		}
+	}
+	if len(headings) == 0 {
+		return nil
+	}
+	top := maxLevel
+	for _, h := range headings {
+		if h.Level < top {
+			top = h.Level
+		}
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte('\n')
+	for _, h := range headings {
+		fmt.Fprintf(buf, "%s- [%s](#%s)\n", strings.Repeat("  ", h.Level-top),
+			linkTextEscaper.Replace(h.Text), h.ID)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+var linkTextEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+// writeFile overwrites existing file keeping its permissions
+func writeFile(name string, b []byte) error {
+	st, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, b, st.Mode().Perm())
+}
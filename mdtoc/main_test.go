@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUpdateTOC(t *testing.T) {
+	src := []byte("# Title\n\n<!-- toc -->\nstale\n<!-- /toc -->\n\n## Section\n\n### Sub\n")
+	want := []byte("# Title\n\n<!-- toc -->\n\n- [Section](#section)\n  - [Sub](#sub)\n\n" +
+		"<!-- /toc -->\n\n## Section\n\n### Sub\n")
+	out, ok := updateTOC(src, 2, 6)
+	if !ok {
+		t.Fatal("markers not found")
+	}
+	if !bytes.Equal(out, want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", out, want)
+	}
+	if out2, _ := updateTOC(out, 2, 6); !bytes.Equal(out, out2) {
+		t.Fatalf("second update changed document:\n%s", out2)
+	}
+	if _, ok := updateTOC([]byte("# Title\n"), 1, 6); ok {
+		t.Fatal("document without markers reported as having them")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a http.Handler limiting rate of requests from a single
+// client address to the wrapped handler, responding with 429 status to
+// requests over the limit. Each client may make a burst of requests up to
+// rateBurst seconds worth of the limit, so pages load along with their
+// stylesheets and scripts.
+type rateLimiter struct {
+	next       http.Handler
+	rate       float64 // requests per second
+	trustProxy bool    // take client address from X-Forwarded-For header
+
+	mu      sync.Mutex
+	swept   time.Time
+	clients map[string]*tokenBucket
+}
+
+// rateBurst is the number of seconds worth of requests a client may make at
+// once
+const rateBurst = 10
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time // when tokens were last updated
+}
+
+func newRateLimiter(next http.Handler, rate float64, trustProxy bool) *rateLimiter {
+	return &rateLimiter{
+		next:       next,
+		rate:       rate,
+		trustProxy: trustProxy,
+		clients:    make(map[string]*tokenBucket),
+	}
+}
+
+func (rl *rateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if wait := rl.take(clientAddr(r, rl.trustProxy), time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	rl.next.ServeHTTP(w, r)
+}
+
+// take takes a token from bucket of client at time now. If bucket is empty,
+// it returns time until a token is available.
+func (rl *rateLimiter) take(client string, now time.Time) time.Duration {
+	burst := math.Max(rl.rate*rateBurst, 1)
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if now.Sub(rl.swept) > time.Minute {
+		// forget clients whose buckets got full again
+		for k, b := range rl.clients {
+			if now.Sub(b.last).Seconds()*rl.rate >= burst {
+				delete(rl.clients, k)
+			}
+		}
+		rl.swept = now
+	}
+	b, ok := rl.clients[client]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		rl.clients[client] = b
+	}
+	b.tokens = math.Min(b.tokens+now.Sub(b.last).Seconds()*rl.rate, burst)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"log"
+	"sync"
+	"time"
+)
+
+// stdinName is the name document read from stdin is served as
+const stdinName = "stdin.md"
+
+// stdinFS is a fs.FS serving document read from a reader, usually stdin, as
+// file name, and other files from the wrapped fs.FS. Document grows as more
+// data is read, so output of a running program can be followed.
+type stdinFS struct {
+	fs.FS
+	name string
+
+	mu    sync.Mutex
+	data  []byte
+	mtime time.Time
+}
+
+// newStdinFS returns stdinFS serving data read from r as file name. Reading
+// is done in background until r returns an error.
+func newStdinFS(fsys fs.FS, name string, r io.Reader) *stdinFS {
+	s := &stdinFS{FS: fsys, name: name, mtime: time.Now()}
+	go func() {
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				s.mu.Lock()
+				s.data = append(s.data, buf[:n]...)
+				s.mtime = time.Now()
+				s.mu.Unlock()
+			}
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("read stdin: %v", err)
+				}
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *stdinFS) Open(name string) (fs.File, error) {
+	if name != s.name {
+		return s.FS.Open(name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := memFileInfo{name: name, size: int64(len(s.data)), mtime: s.mtime}
+	return &memFile{Reader: bytes.NewReader(s.data[:len(s.data):len(s.data)]), info: info}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+	info memFileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memFileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi memFileInfo) ModTime() time.Time { return fi.mtime }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }